@@ -15,28 +15,34 @@ Gallo.ready = function(fn) {
   }
 };
 
-(function(G) {
-  if (window.navigator.standalone) {
-    G.ready(function() {
-      /**
-       * Override all link clicks, to avoid fullscreen mode opening in the
-       * external browser
-       */
-      [].forEach.call(document.querySelectorAll("a"), function(link) {
-        link.onclick = function(e) {
-          e.preventDefault();
+/**
+ * Overrides clicks on links, to avoid fullscreen mode opening them in the
+ * external browser. Only needed in standalone mode on iOS.
+ *
+ * @param {NodeList} links - Links to override clicks on.
+ */
+Gallo.keepInStandalone = function(links) {
+  [].forEach.call(links, function(link) {
+    link.onclick = function(e) {
+      e.preventDefault();
+
+      var href = this.getAttribute("href");
 
-          var href = this.getAttribute("href");
+      if (this.getAttribute("target") !== null) {
+        window.open(href, this.getAttribute("target"))
+      } else {
+        window.location = href;
+      }
 
-          if (this.getAttribute("target") !== null) {
-            window.open(href, this.getAttribute("target"))
-          } else {
-            window.location = href;
-          }
+      return false;
+    };
+  });
+};
 
-          return false;
-        };
-      });
+(function(G) {
+  if (window.navigator.standalone) {
+    G.ready(function() {
+      G.keepInStandalone(document.querySelectorAll("a"));
 
       /**
        * Adds class signifying fullscreen standalone mode for iOS devices */
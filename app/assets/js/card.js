@@ -18,6 +18,13 @@ Gallo.DOM_WIDTH_LIMIT = 22500;
 // case. E.g. if all images are portrait, there's probaly room for 3-4.
 Gallo.IMAGE_LOAD_WAIT_COUNT = 5;
 
+// How images are fitted to the screen. With 'cover' they fill the height of
+// the screen, and with 'contain' they are scaled down to fit entirely.
+Gallo.IMAGE_FIT = 'cover';
+
+// Amount of time the cover is shown, before beginning to cycle images in ms.
+Gallo.COVER_DURATION = 10000;
+
 //------------------------------------------------------------------------------
 
 /**
@@ -186,12 +193,19 @@ Gallo.sizes = function(image) {
  * takes care of fading from cover to the image view, as well as the animation
  * and change between individual images.
  *
+ * Videos are shown in between images, and play for their duration instead of
+ * Gallo.SHOW_DURATION. Since that duration isn't known beforehand, onCycle is
+ * invoked once all images and videos have been shown, if there are any videos.
+ *
  * @param {Object} G Gallo root object
  * @param {Document} d Global document
  * @param {Window} w Global window
  * @param {console} c Global console
+ * @param {Function} [onCycle] - Invoked after showing everything once.
+ * @returns {Object} Presentation with a stop() function, which halts it, and
+ *                   a hasVideos property.
  */
-Gallo.present = function(G, d, w, c) {
+Gallo.present = function(G, d, w, c, onCycle) {
   var imagesEl = d.querySelector('.images') ||
     c.assert(!!imagesEl, 'Images element not found!');
   var coverEl = d.querySelector('.cover') ||
@@ -201,6 +215,7 @@ Gallo.present = function(G, d, w, c) {
   //----------------------------------------------------------------------------
 
   var state;
+  var stopped = false, timeout = null;
   var transform = G.whichTransform();
   var transitionEvent = G.whichTransitionEvent();
   var presentationWidth = d.querySelector('body').offsetWidth;
@@ -208,7 +223,19 @@ Gallo.present = function(G, d, w, c) {
   // Shuffle previews so the order is different on each load
   var shuffledImages = G.shuffle(G.IMAGES);
   var preview, image, imageElements = [], imagesLoadedCounter = 0, div;
-  var totalWidth = 0;
+  var totalWidth = 0, hasVideos = false;
+  var captions = [], captionEl = d.querySelector('.overlay .caption');
+
+  var onImageLoad = function() {
+    if (stopped) { return; }
+
+    if(++imagesLoadedCounter >= Math.min(
+      G.IMAGE_LOAD_WAIT_COUNT,
+      imageElements.length
+    )) {
+      state.imagesLoad();
+    }
+  };
 
   for(var i = 0; i < shuffledImages.length; i++) {
     image = shuffledImages[i];
@@ -217,17 +244,35 @@ Gallo.present = function(G, d, w, c) {
     // calculate the width it's going to have from the aspect ratio.
     var lastPreview = image.previews[image.previews.length - 1];
     var imageAspectRatio = lastPreview.width / lastPreview.height;
-    var imageRenderedWidth = d.documentElement.clientHeight *
-      (lastPreview.width / lastPreview.height);
+    var imageRenderedHeight = d.documentElement.clientHeight;
+
+    // Unless it's supposed to fit on screen, in which case wide images are
+    // limited by the viewport width instead
+    if (G.IMAGE_FIT === 'contain') {
+      imageRenderedHeight = Math.min(
+        imageRenderedHeight,
+        Math.floor(presentationWidth / imageAspectRatio)
+      );
+    }
+
+    var imageRenderedWidth = imageRenderedHeight * imageAspectRatio;
 
     // See comment for DOM_WIDTH_LIMIT
     if (totalWidth + imageRenderedWidth > G.DOM_WIDTH_LIMIT) {
       break;
     }
 
-    imageEl = new Image();
-    imageEl.setAttribute('srcset', G.srcSet(image));
-    imageEl.setAttribute('sizes', G.sizes(image));
+    if (image.video) {
+      imageEl = G.videoElement(image, d);
+      imageEl.addEventListener('loadedmetadata', onImageLoad);
+      hasVideos = true;
+    } else {
+      imageEl = new Image();
+      imageEl.setAttribute('srcset', G.srcSet(image));
+      imageEl.setAttribute('sizes', G.sizes(image));
+      imageEl.addEventListener('load', onImageLoad);
+    }
+
     imageEl.classList.add('image');
 
     /**
@@ -236,20 +281,21 @@ Gallo.present = function(G, d, w, c) {
      * results in an ever increasing zoom level, this manual setting of the
      * height directly on the element, is the effective workaround.
      */
-    imageEl.style.cssText = 'height: ' + d.documentElement.clientHeight + 'px;';
-
-    imageEl.addEventListener('load', function() {
-      if(++imagesLoadedCounter >= Math.min(
-        G.IMAGE_LOAD_WAIT_COUNT,
-        imageElements.length
-      )) {
-        state.imagesLoad();
-      }
-    });
+    imageEl.style.cssText = 'height: ' + imageRenderedHeight + 'px;' +
+      'vertical-align: top;' +
+      'margin-top: ' +
+      Math.floor((d.documentElement.clientHeight - imageRenderedHeight) / 2) +
+      'px;';
+
+    // Videos don't take their width from the poster
+    if (image.video) {
+      imageEl.style.width = Math.floor(imageRenderedWidth) + 'px';
+    }
 
     imageEl.addEventListener('onerror', console.error);
 
     imageElements.push(imageEl);
+    captions.push(image.caption || '');
     imagesEl.appendChild(imageEl);
 
     totalWidth += imageRenderedWidth;
@@ -274,9 +320,9 @@ Gallo.present = function(G, d, w, c) {
         var that = this;
 
         var onDoneFadingOut = function() {
-          that.doneFadingOutCover();
-
           that.coverEl.removeEventListener(that.transitionEvent, onDoneFadingOut);
+
+          if (!stopped) { that.doneFadingOutCover(); }
         };
 
         this.coverEl.addEventListener(this.transitionEvent, onDoneFadingOut);
@@ -289,6 +335,8 @@ Gallo.present = function(G, d, w, c) {
 
         var moveToNextImage = function() {
           var currentImage = that.imageElements[currentImageIndex];
+          var isLast = currentImageIndex === that.imageElements.length - 1;
+          var duration = G.SHOW_DURATION;
           var x;
 
           if (currentImageIndex === 0) {
@@ -296,25 +344,44 @@ Gallo.present = function(G, d, w, c) {
             x = 0;
           } else if (currentImageIndex === that.imageElements.length - 1) {
             // Align right edge of last image with right edge of viewport
-            x = -currentImage.offsetLeft + (presentationWidth - currentImage.width);
+            x = -currentImage.offsetLeft + (presentationWidth - currentImage.offsetWidth);
           } else {
             // Align horizontal center of other images with center viewport
-            x = -currentImage.offsetLeft + (presentationWidth - currentImage.width) / 2;
+            x = -currentImage.offsetLeft + (presentationWidth - currentImage.offsetWidth) / 2;
           }
 
           that.imagesEl.style.cssText = transform + ': translate3d(' + x + 'px, 0, 0)';
 
+          // Videos play from the start, for as long as they last
+          if (currentImage.tagName === 'VIDEO') {
+            if (isFinite(currentImage.duration) && currentImage.duration > 0) {
+              duration = currentImage.duration * 1000;
+            }
+
+            currentImage.currentTime = 0;
+            currentImage.play();
+          }
+
+          if (captionEl) {
+            captionEl.textContent = captions[currentImageIndex];
+          }
+
           currentImage.classList.add('focus');
-          setTimeout(function() {
+          currentImageIndex = (currentImageIndex + 1) % that.imageElements.length;
+
+          // Only the next move is ever pending, so stop() can cancel it
+          timeout = setTimeout(function() {
             currentImage.classList.remove('focus');
-          }, G.SHOW_DURATION);
 
-          currentImageIndex = (currentImageIndex + 1) % that.imageElements.length;
+            if (currentImage.tagName === 'VIDEO') { currentImage.pause(); }
+
+            if (isLast && hasVideos && onCycle) { onCycle(); }
+            if (!stopped) { moveToNextImage(); }
+          }, duration);
         }
 
         this.imagesEl.classList.safeRemove('transparent', 'hidden');
 
-        setInterval(moveToNextImage, G.SHOW_DURATION);
         moveToNextImage();
       },
     },
@@ -328,15 +395,284 @@ Gallo.present = function(G, d, w, c) {
 
   picturefill({ reevaluate: true, elements: imageElements });
 
-  // Let the cover stay for 10 seconds before beginning to cycle imageElements
-  setTimeout(function() { state.coverTimeout(); }, 10000);
+  // Let the cover stay for a while before beginning to cycle imageElements
+  timeout = setTimeout(function() { state.coverTimeout(); }, G.COVER_DURATION);
+
+  return {
+    hasVideos: hasVideos,
+    stop: function() {
+      stopped = true;
+
+      clearTimeout(timeout);
+
+      imageElements.fooEach(function(el) {
+        if (el.tagName === 'VIDEO') { el.pause(); }
+      });
+    }
+  };
+};
+
+/**
+ * Creates a muted video element for an entry of Gallo.IMAGES with a video,
+ * which shows the poster until it's played.
+ *
+ * @param {Object} image - Image data object with previews and video properties.
+ * @param {Document} d Global document
+ * @returns {HTMLVideoElement}
+ */
+Gallo.videoElement = function(image, d) {
+  var videoEl = d.createElement('video');
+  var lastPreview = image.previews[image.previews.length - 1];
+
+  // Muted inline videos are the only ones allowed to play without a tap
+  videoEl.muted = true;
+  videoEl.setAttribute('muted', '');
+  videoEl.setAttribute('playsinline', '');
+  videoEl.setAttribute('webkit-playsinline', '');
+  videoEl.setAttribute('preload', 'metadata');
+  videoEl.setAttribute('poster', lastPreview.url);
+
+  var sourceEl = d.createElement('source');
+  sourceEl.setAttribute('src', image.video.url);
+  if (image.video.mimeType) {
+    sourceEl.setAttribute('type', image.video.mimeType);
+  }
+  videoEl.appendChild(sourceEl);
+
+  return videoEl;
+};
+
+/**
+ * Fetches the next cards of the current shuffle from Gallo.PLAYLIST_URL.
+ *
+ * @param {Object} G Gallo root object
+ * @param {Function} callback - Invoked with an array of playlist entries, or
+ *                              null if the request failed.
+ */
+Gallo.fetchPlaylist = function(G, callback) {
+  var xhr = new XMLHttpRequest();
+
+  xhr.open('GET', G.PLAYLIST_URL, true);
+  xhr.setRequestHeader('Accept', 'application/json');
+
+  xhr.onreadystatechange = function() {
+    if (xhr.readyState !== 4) { return; }
+
+    if (xhr.status !== 200) {
+      callback(null);
+      return;
+    }
+
+    try {
+      callback(JSON.parse(xhr.responseText).cards);
+    } catch (e) {
+      callback(null);
+    }
+  };
+
+  xhr.send();
+};
+
+/**
+ * Replaces the cover, background and images of the page with the ones of a
+ * playlist entry.
+ *
+ * @param {Object} G Gallo root object
+ * @param {Object} entry - Playlist entry as returned by the playlist endpoint.
+ * @param {Document} d Global document
+ */
+Gallo.showEntry = function(G, entry, d) {
+  var coverEl = d.querySelector('.cover');
+  var imagesEl = d.querySelector('.images');
+  var body = d.querySelector('body');
+  var el;
+
+  while (coverEl.firstChild) { coverEl.removeChild(coverEl.firstChild); }
+
+  el = d.createElement('h1');
+  el.className = 'title';
+  el.textContent = entry.card.name;
+  coverEl.appendChild(el);
+
+  if (entry.date) {
+    el = d.createElement('p');
+    el.textContent = '-';
+    coverEl.appendChild(el);
+
+    el = d.createElement('h2');
+    el.className = 'date';
+    el.textContent = entry.date;
+    coverEl.appendChild(el);
+  }
+
+  if (entry.location) {
+    el = d.createElement('p');
+    el.className = 'location';
+    el.textContent = entry.location;
+    coverEl.appendChild(el);
+  }
+
+  if (entry.people) {
+    el = d.createElement('p');
+    el.className = 'people';
+    el.textContent = entry.people.join(', ');
+    coverEl.appendChild(el);
+  }
+
+  while (imagesEl.firstChild) { imagesEl.removeChild(imagesEl.firstChild); }
+  imagesEl.style.cssText = '';
+
+  G.showOverlay(entry.overlay, d);
+
+  body.classList.remove('light');
+  body.classList.remove('dark');
+  body.classList.add(entry.backgroundClass);
+  body.style.background = entry.backgroundColor;
+
+  if (entry.listPath) {
+    d.querySelector('.navigation-icon').setAttribute('href', entry.listPath);
+  }
+};
+
+/**
+ * Replaces the description and comments of the overlay with the ones of a
+ * playlist entry, or hides it if the entry has no overlay. Descriptions and
+ * comments are rendered and sanitized by gallo, hence are inserted as is.
+ *
+ * @param {Object} [overlay] - Overlay of a playlist entry.
+ * @param {Document} d Global document
+ */
+Gallo.showOverlay = function(overlay, d) {
+  var overlayEl = d.querySelector('.overlay');
+  var captionEl = overlayEl.querySelector('.caption');
+  var el, commentEl;
+
+  while (overlayEl.lastChild && overlayEl.lastChild !== captionEl) {
+    overlayEl.removeChild(overlayEl.lastChild);
+  }
+
+  captionEl.textContent = '';
+
+  if (!overlay) {
+    overlayEl.classList.add('hidden');
+    return;
+  }
+
+  overlayEl.classList.remove('hidden');
+
+  el = d.createElement('div');
+  el.className = 'description';
+  el.innerHTML = overlay.description;
+  overlayEl.appendChild(el);
+
+  if (!overlay.comments || overlay.comments.length === 0) { return; }
+
+  el = d.createElement('ul');
+  el.className = 'comments';
+
+  overlay.comments.fooEach(function(comment) {
+    commentEl = d.createElement('li');
+    commentEl.className = 'comment';
+    commentEl.innerHTML = comment.html;
+
+    var authorEl = d.createElement('span');
+    authorEl.className = 'author';
+    authorEl.textContent = comment.author;
+    commentEl.insertBefore(authorEl, commentEl.firstChild);
+
+    el.appendChild(commentEl);
+  });
+
+  overlayEl.appendChild(el);
+};
+
+/**
+ * Plays the cards of the current shuffle one after another, fetching more
+ * from the playlist endpoint as needed, instead of reloading the page for each
+ * card. Falls back to reloading if the playlist can't be fetched.
+ *
+ * @param {Object} G Gallo root object
+ * @param {Document} d Global document
+ * @param {Window} w Global window
+ * @param {console} c Global console
+ */
+Gallo.play = function(G, d, w, c) {
+  var queue = [], fetching = false;
+  var presentation;
+
+  var fill = function(callback) {
+    if (fetching) { return; }
+    fetching = true;
+
+    G.fetchPlaylist(G, function(entries) {
+      fetching = false;
+
+      if (entries) {
+        entries.fooEach(function(entry) { queue.push(entry); });
+      }
+
+      if (callback) { callback(); }
+    });
+  };
+
+  var next = function() {
+    if (queue.length === 0) {
+      fill(function() {
+        if (queue.length === 0) {
+          w.location.reload();
+        } else {
+          next();
+        }
+      });
+
+      return;
+    }
+
+    var entry = queue.shift();
+
+    presentation.stop();
+
+    // Fade back to the cover, before swapping out the contents underneath
+    d.querySelector('.images').classList.add('transparent');
+    d.querySelector('.cover').classList.remove('transparent');
+
+    setTimeout(function() {
+      G.showEntry(G, entry, d);
+      G.IMAGES = entry.images;
+
+      presentation = G.present(G, d, w, c, next);
+
+      if (!presentation.hasVideos) {
+        setTimeout(next, G.SHOW_DURATION * entry.images.length);
+      }
+
+      // Have the following cards ready in time
+      if (queue.length === 0) { fill(); }
+    }, G.FADE_DURATION);
+  };
+
+  presentation = G.present(G, d, w, c, next);
+
+  if (!presentation.hasVideos) {
+    setTimeout(next, G.REFRESH);
+  }
+
+  fill();
 };
 
 Gallo.ready(function() {
-  Gallo.present(Gallo, document, window, console);
+  if (Gallo.REFRESH && Gallo.PLAYLIST_URL) {
+    Gallo.play(Gallo, document, window, console);
+    return;
+  }
+
+  var reload = function() { location.reload(); };
+  var presentation = Gallo.present(
+    Gallo, document, window, console, Gallo.REFRESH ? reload : null
+  );
 
-  if (Gallo.REFRESH) {
-    setTimeout(function() { location.reload(); }, Gallo.REFRESH);
+  if (Gallo.REFRESH && !presentation.hasVideos) {
+    setTimeout(reload, Gallo.REFRESH);
   }
 });
 
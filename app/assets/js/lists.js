@@ -0,0 +1,158 @@
+var Gallo = window.Gallo || {};
+
+// How far below the bottom of the viewport the link to the following page of
+// cards is, when it's loaded, in screen heights.
+Gallo.LOAD_AHEAD = 2;
+
+//------------------------------------------------------------------------------
+
+/**
+ * Adds the card groups of a following page to the card groups of the page.
+ * Cards of a group which is already on the page are added to it, since pages
+ * can begin in the middle of e.g. a year. Groups and cards are put in place by
+ * their sort keys, in the order they're sorted on the server, since that's only
+ * done for a page at a time.
+ *
+ * @param {Element} groupsEl - Card groups element of the page.
+ * @param {Element} pageEl - Element containing the following page.
+ * @returns {Array} The cover images added to the page.
+ */
+Gallo.mergeCardGroups = function(groupsEl, pageEl) {
+  var covers = [];
+  var descending = groupsEl.getAttribute('data-descending') === 'true';
+  var cardsDescending = groupsEl.getAttribute('data-cards-descending') === 'true';
+
+  // Whether group a comes before group b. The group of cards without e.g. a
+  // date stays last.
+  var before = function(a, b) {
+    var keyA = a.getAttribute('data-key'), keyB = b.getAttribute('data-key');
+
+    if (keyA === 'other' || keyB === 'other') {
+      return keyB === 'other' && keyA !== 'other';
+    }
+
+    var sortA = a.getAttribute('data-sort'), sortB = b.getAttribute('data-sort');
+
+    return descending ? sortA > sortB : sortA < sortB;
+  };
+
+  // Whether card a comes before card b within a group. Undated cards stay
+  // last.
+  var cardBefore = function(a, b) {
+    var sortA = a.getAttribute('data-sort'), sortB = b.getAttribute('data-sort');
+
+    if (sortA === '' || sortB === '') {
+      return sortA !== '' && sortB === '';
+    }
+
+    return cardsDescending ? sortA > sortB : sortA < sortB;
+  };
+
+  [].forEach.call(pageEl.querySelectorAll('.card-group'), function(groupEl) {
+    var key = groupEl.getAttribute('data-key');
+    var existingEl = null;
+    var nextEl = null;
+
+    // Keys can be any label or custom field value, so they aren't put in a
+    // selector
+    [].forEach.call(groupsEl.querySelectorAll('.card-group'), function(el) {
+      if (el.getAttribute('data-key') === key) { existingEl = el; }
+      if (!nextEl && before(groupEl, el)) { nextEl = el; }
+    });
+
+    [].forEach.call(groupEl.querySelectorAll('.card .cover'), function(coverEl) {
+      covers.push(coverEl);
+    });
+
+    if (!existingEl) {
+      groupsEl.insertBefore(groupEl, nextEl);
+      return;
+    }
+
+    var columnsEl = existingEl.querySelector('.columns');
+
+    [].forEach.call(groupEl.querySelectorAll('.card'), function(cardEl) {
+      var nextCardEl = null;
+
+      [].forEach.call(columnsEl.querySelectorAll('.card'), function(el) {
+        if (!nextCardEl && cardBefore(cardEl, el)) { nextCardEl = el; }
+      });
+
+      columnsEl.insertBefore(cardEl.parentNode, nextCardEl && nextCardEl.parentNode);
+    });
+  });
+
+  return covers;
+};
+
+/**
+ * Loads the following pages of cards on a list, as the link to them is
+ * scrolled near, instead of leaving the page. If a page can't be loaded, the
+ * link is left for going to it instead.
+ *
+ * @param {Object} G Gallo root object
+ * @param {Document} d Global document
+ * @param {Window} w Global window
+ */
+Gallo.loadPages = function(G, d, w) {
+  var loading = false;
+
+  var load = function() {
+    var moreEl = d.querySelector('.more');
+
+    if (loading || !moreEl) { return; }
+
+    if (moreEl.getBoundingClientRect().top > w.innerHeight * G.LOAD_AHEAD) {
+      return;
+    }
+
+    loading = true;
+
+    var xhr = new XMLHttpRequest();
+
+    xhr.open('GET', moreEl.querySelector('a').getAttribute('href'), true);
+
+    xhr.onreadystatechange = function() {
+      if (xhr.readyState !== 4) { return; }
+
+      if (xhr.status !== 200) {
+        w.removeEventListener('scroll', load);
+        return;
+      }
+
+      var pageEl = d.createElement('div');
+      pageEl.innerHTML = xhr.responseText;
+
+      var covers = G.mergeCardGroups(d.querySelector('.card-groups'), pageEl);
+      var nextEl = pageEl.querySelector('.more');
+
+      if (nextEl) {
+        moreEl.parentNode.replaceChild(nextEl, moreEl);
+      } else {
+        moreEl.parentNode.removeChild(moreEl);
+      }
+
+      if (w.picturefill) {
+        w.picturefill({ reevaluate: true, elements: covers });
+      }
+
+      if (w.navigator.standalone) {
+        G.keepInStandalone(d.querySelectorAll('.card-groups a, .more a'));
+      }
+
+      loading = false;
+
+      load();
+    };
+
+    xhr.send();
+  };
+
+  w.addEventListener('scroll', load);
+
+  load();
+};
+
+Gallo.ready(function() {
+  Gallo.loadPages(Gallo, document, window);
+});
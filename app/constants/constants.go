@@ -4,3 +4,6 @@ const SessionName = "gallo"
 const TrelloClientContextKey = "ctx-trello-client"
 const TrelloTokenContextKey = "ctx-trello-token"
 const TrelloTokenSessionKey = "session-trello-token"
+const SourceContextKey = "ctx-source"
+const ShuffleBagSessionKey = "session-shuffle-bag"
+const SettingsContextKey = "ctx-settings"
@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"gallo/app/models"
+	"gallo/app/views"
+	"gallo/lib"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// AdminController lets the operators of the app purge cached responses from
+// Trello and rendered pages, and see how well responses are cached. Requests
+// must carry Token as a bearer token.
+type AdminController struct {
+	Token   string
+	Caches  []models.CachePurger
+	Metrics *lib.CacheMetrics
+}
+
+// Purge purges the entries with any of the tags given in the form, see
+// lib.PurgeTags.
+func (c AdminController) Purge(w http.ResponseWriter, r *http.Request) {
+	if !c.authorize(w, r) {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		views.ExecuteJSONError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tags := lib.PurgeTags(r.Form)
+	if len(tags) == 0 {
+		views.ExecuteJSONError(w, r, http.StatusBadRequest, "Nothing to purge by")
+		return
+	}
+
+	purged, err := purgeCaches(r.Context(), tags, c.Caches)
+	if err != nil {
+		log.Println(err)
+		views.ExecuteJSONError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	views.ExecuteJSON(w, r, http.StatusOK, struct {
+		Tags   []string `json:"tags"`
+		Purged int      `json:"purged"`
+	}{tags, purged})
+}
+
+// ShowMetrics shows the counts of how requests to Trello were answered, in the
+// Prometheus text format.
+func (c AdminController) ShowMetrics(w http.ResponseWriter, r *http.Request) {
+	if !c.authorize(w, r) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	err := c.Metrics.WritePrometheus(w, "gallo_trello_cache")
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// Tells whether r carries the token, and answers it as unauthorized if not.
+func (c AdminController) authorize(w http.ResponseWriter, r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(c.Token)) != 1 {
+		views.ExecuteJSONError(w, r, http.StatusUnauthorized, "")
+		return false
+	}
+
+	return true
+}
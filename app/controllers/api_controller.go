@@ -0,0 +1,247 @@
+package controllers
+
+import (
+	"gallo/app/controllers/middlewares"
+	"gallo/app/models"
+	"gallo/app/views"
+	"gallo/lib"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// APIController exposes the same boards, lists and cards as the HTML pages, as
+// JSON for native clients. Failures are rendered as views.ErrorBody.
+type APIController struct {
+	Analyzer *models.ImageAnalyzer
+	Shuffler Shuffler
+}
+
+type apiCard struct {
+	Card   *models.Card   `json:"card"`
+	Images []models.Image `json:"images"`
+	Videos []models.Video `json:"videos"`
+}
+
+func (c APIController) Boards(w http.ResponseWriter, r *http.Request) {
+	defer lib.Track(lib.RunningTime("APIController.Boards"))
+
+	boards, err := models.GetValidBoards(r.Context())
+	if err != nil {
+		log.Println(err)
+		views.ExecuteJSONError(w, r, http.StatusInternalServerError, "")
+		return
+	}
+
+	views.ExecuteJSON(w, r, http.StatusOK, struct {
+		Boards []*models.Board `json:"boards"`
+	}{boards})
+}
+
+func (c APIController) Board(w http.ResponseWriter, r *http.Request) {
+	board, err := models.GetBoard(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		log.Println(err)
+		views.ExecuteJSONError(w, r, http.StatusNotFound, "Board not found")
+		return
+	}
+
+	lists, err := board.GetValidLists(r.Context())
+	if err != nil {
+		log.Println(err)
+		views.ExecuteJSONError(w, r, http.StatusInternalServerError, "")
+		return
+	}
+
+	views.ExecuteJSON(w, r, http.StatusOK, struct {
+		Board *models.Board  `json:"board"`
+		Lists []*models.List `json:"lists"`
+	}{board, lists})
+}
+
+func (c APIController) List(w http.ResponseWriter, r *http.Request) {
+	list, err := models.GetList(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		log.Println(err)
+		views.ExecuteJSONError(w, r, http.StatusNotFound, "List not found")
+		return
+	}
+
+	views.ExecuteJSON(w, r, http.StatusOK, struct {
+		List *models.List `json:"list"`
+	}{list})
+}
+
+func (c APIController) ListCards(w http.ResponseWriter, r *http.Request) {
+	list, page, ok := c.getListCards(w, r)
+	if !ok {
+		return
+	}
+
+	views.ExecuteJSON(w, r, http.StatusOK, struct {
+		List  *models.List   `json:"list"`
+		Cards []*models.Card `json:"cards"`
+		Next  string         `json:"next,omitempty"`
+	}{list, page.Cards, page.Next})
+}
+
+func (c APIController) ListCardGroups(w http.ResponseWriter, r *http.Request) {
+	list, page, ok := c.getListCards(w, r)
+	if !ok {
+		return
+	}
+
+	views.ExecuteJSON(w, r, http.StatusOK, struct {
+		List       *models.List       `json:"list"`
+		CardGroups []models.CardGroup `json:"cardGroups"`
+		Next       string             `json:"next,omitempty"`
+	}{list, groupCards(r, list, page.Cards), page.Next})
+}
+
+func (c APIController) Card(w http.ResponseWriter, r *http.Request) {
+	card, err := models.GetCard(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		log.Println(err)
+		views.ExecuteJSONError(w, r, http.StatusNotFound, "Card not found")
+		return
+	}
+
+	views.ExecuteJSON(w, r, http.StatusOK, c.newAPICard(r, card))
+}
+
+// Shuffle picks a random card in the same manner as BoardsController.Shuffle.
+func (c APIController) Shuffle(w http.ResponseWriter, r *http.Request) {
+	strategy, err := c.Shuffler.Strategy(w, r, boardShuffleScope(r))
+	if err != nil {
+		views.ExecuteJSONError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	card, err := getRandomBoardCard(r, strategy)
+	if err != nil {
+		log.Println(err)
+		views.ExecuteJSONError(w, r, http.StatusInternalServerError, "")
+		return
+	}
+
+	views.ExecuteJSON(w, r, http.StatusOK, c.newAPICard(r, card))
+}
+
+// Daily picks the card of the day from a board.
+func (c APIController) Daily(w http.ResponseWriter, r *http.Request) {
+	board, err := models.GetBoard(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		log.Println(err)
+		views.ExecuteJSONError(w, r, http.StatusNotFound, "Board not found")
+		return
+	}
+
+	card, err := board.GetDailyCard(r.Context(), time.Now())
+	if err != nil {
+		log.Println(err)
+		views.ExecuteJSONError(w, r, http.StatusInternalServerError, "")
+		return
+	}
+
+	views.ExecuteJSON(w, r, http.StatusOK, c.newAPICard(r, card))
+}
+
+// ListShuffle picks a random card from a list.
+func (c APIController) ListShuffle(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	list, err := models.GetList(r.Context(), id)
+	if err != nil {
+		log.Println(err)
+		views.ExecuteJSONError(w, r, http.StatusNotFound, "List not found")
+		return
+	}
+
+	strategy, err := c.Shuffler.Strategy(w, r, "list-"+id)
+	if err != nil {
+		views.ExecuteJSONError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	card, err := list.GetRandomCard(r.Context(), strategy)
+	if err != nil {
+		log.Println(err)
+		views.ExecuteJSONError(w, r, http.StatusInternalServerError, "")
+		return
+	}
+
+	views.ExecuteJSON(w, r, http.StatusOK, c.newAPICard(r, card))
+}
+
+func (c APIController) NotFound(w http.ResponseWriter, r *http.Request) {
+	views.ExecuteJSONError(w, r, http.StatusNotFound, "")
+}
+
+func (c APIController) MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	views.ExecuteJSONError(w, r, http.StatusMethodNotAllowed, "")
+}
+
+// Fetches the list given by the id route variable along with a page of its
+// cards. All cards are on a single page, unless a page is asked for with the
+// before or limit query parameters. If that fails, an error is rendered and
+// ok is false.
+func (c APIController) getListCards(
+	w http.ResponseWriter,
+	r *http.Request,
+) (list *models.List, page *models.ListPage, ok bool) {
+	list, err := models.GetList(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		log.Println(err)
+		views.ExecuteJSONError(w, r, http.StatusNotFound, "List not found")
+		return nil, nil, false
+	}
+
+	query := r.URL.Query()
+
+	if query.Get("before") == "" && query.Get("limit") == "" {
+		cards, err := list.GetCards()
+		if err != nil {
+			log.Println(err)
+			views.ExecuteJSONError(w, r, http.StatusInternalServerError, "")
+			return nil, nil, false
+		}
+
+		page = &models.ListPage{Cards: cards}
+	} else {
+		before, limit, err := listPageParams(r, models.DefaultListPageSize)
+		if err != nil {
+			log.Println(err)
+			views.ExecuteJSONError(w, r, http.StatusBadRequest, "Invalid page")
+			return nil, nil, false
+		}
+
+		page, err = list.GetCardsPage(before, limit)
+		if err != nil {
+			log.Println(err)
+			views.ExecuteJSONError(w, r, http.StatusInternalServerError, "")
+			return nil, nil, false
+		}
+	}
+
+	models.UseCollageCovers(r.Context(), list, page.Cards)
+
+	coverImages := make([]models.Image, len(page.Cards))
+	for i := range page.Cards {
+		coverImages[i] = page.Cards[i].CoverImage
+	}
+	if !c.Analyzer.FillAnalyzedEdgeColors(r.Context(), coverImages) {
+		middlewares.NoStore(w)
+	}
+
+	return list, page, true
+}
+
+func (c APIController) newAPICard(r *http.Request, card *models.Card) apiCard {
+	images := card.GetImages()
+	c.Analyzer.FillEdgeColors(r.Context(), images)
+	loadPhoto(r, card)
+
+	return apiCard{card, images, card.GetVideos()}
+}
@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"gallo/app/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/adlio/trello"
+	"github.com/gorilla/mux"
+	"gotest.tools/assert"
+)
+
+// fakeSource is a models.Source serving a single board, with its lists and
+// cards loaded. Only the methods the handlers under test need are implemented,
+// the embedded Source is nil.
+type fakeSource struct {
+	models.Source
+
+	board *models.Board
+}
+
+func (s fakeSource) GetBoard(id string) (*models.Board, error) {
+	if id != s.board.ID() {
+		return nil, errors.New("board not found")
+	}
+
+	return s.board, nil
+}
+
+func newFakeSource() fakeSource {
+	card := &models.Card{Name: "Bar", TrelloCard: &trello.Card{ID: "12"}}
+
+	return fakeSource{board: &models.Board{
+		Name: "Foo",
+		Lists: []*models.List{
+			&models.List{
+				Name:       "Watched",
+				Cards:      []*models.Card{card},
+				TrelloList: &trello.List{ID: "a", Subscribed: true},
+			},
+			&models.List{
+				Name:       "Empty",
+				Cards:      []*models.Card{},
+				TrelloList: &trello.List{ID: "b", Subscribed: true},
+			},
+			&models.List{
+				Name:       "Unwatched",
+				Cards:      []*models.Card{card},
+				TrelloList: &trello.List{ID: "c"},
+			},
+		},
+		TrelloBoard: &trello.Board{ID: "1"},
+	}}
+}
+
+func TestAPIControllerBoard(t *testing.T) {
+	source := newFakeSource()
+
+	request := func(id string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/api/v1/boards/"+id, nil)
+		r = r.WithContext(models.NewSourceContext(context.Background(), source))
+		r = mux.SetURLVars(r, map[string]string{"id": id})
+
+		w := httptest.NewRecorder()
+		APIController{}.Board(w, r)
+
+		return w
+	}
+
+	t.Run("Only watched lists with cards are included", func(t *testing.T) {
+		w := request("1")
+		assert.Equal(t, w.Code, http.StatusOK)
+
+		var body struct {
+			Board struct {
+				ID   string `json:"id"`
+				Name string `json:"name"`
+			} `json:"board"`
+			Lists []struct {
+				ID string `json:"id"`
+			} `json:"lists"`
+		}
+
+		assert.NilError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.Equal(t, body.Board.Name, "Foo")
+		assert.Equal(t, len(body.Lists), 1)
+		assert.Equal(t, body.Lists[0].ID, "a")
+	})
+
+	t.Run("Unknown board", func(t *testing.T) {
+		w := request("2")
+		assert.Equal(t, w.Code, http.StatusNotFound)
+	})
+}
@@ -6,73 +6,214 @@ import (
 	"gallo/lib"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
-type BoardsController struct{}
+type BoardsController struct {
+	Analyzer *models.ImageAnalyzer
+	Settings *models.SettingsStore
+	Shuffler Shuffler
+}
 
+// Index shows the selected boards with at least one valid list, followed by the
+// ones which aren't selected, so they can be toggled. Only the lists of selected
+// boards are loaded, so excluded boards are listed whether they have any valid
+// lists or not.
 func (c BoardsController) Index(w http.ResponseWriter, r *http.Request) {
 	defer lib.Track(lib.RunningTime("BoardsController.Index"))
 
-	boards, err := models.GetValidBoards(r.Context())
+	boards, err := models.GetBoards(r.Context())
+	if err != nil {
+		log.Println(err)
+		views.RenderError(w, r, http.StatusInternalServerError)
+		return
+	}
+
+	settings := models.SettingsFromContext(r.Context())
+	included := settings.IncludedBoards(boards)
+
+	// Boards are watched from here too, for users who never change their
+	// settings
+	err = models.WatchBoards(r.Context(), c.Settings, included)
+	if err != nil {
+		log.Println(err)
+	}
+
+	data := struct {
+		Boards         []*models.Board `json:"boards"`
+		ExcludedBoards []*models.Board `json:"excludedBoards"`
+	}{
+		ExcludedBoards: make([]*models.Board, 0),
+	}
+
+	data.Boards, err = models.ValidBoards(r.Context(), included)
+	if err != nil {
+		log.Println(err)
+		views.RenderError(w, r, http.StatusInternalServerError)
+		return
+	}
+
+	for i := range boards {
+		if !settings.IncludesBoard(boards[i]) {
+			data.ExcludedBoards = append(data.ExcludedBoards, boards[i])
+		}
+	}
+
+	views.Render(w, r, "boards/index.html.tmpl", data)
+}
+
+// Select opts a board in or out of the selection in the settings, depending
+// on the posted include value, and goes back to the boards page.
+func (c BoardsController) Select(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
 	if err != nil {
 		log.Println(err)
-		w.WriteHeader(http.StatusInternalServerError)
+		views.RenderError(w, r, http.StatusBadRequest)
 		return
 	}
 
-	views.Execute(w, r, "boards/index.html.tmpl", boards)
+	id := mux.Vars(r)["id"]
+	settings := models.SettingsFromContext(r.Context())
+
+	if r.PostForm.Get("include") == "true" {
+		settings.IncludeBoard(id)
+	} else {
+		settings.ExcludeBoard(id)
+	}
+
+	err = models.SaveSettings(r.Context(), c.Settings, &settings)
+	if err != nil {
+		log.Println(err)
+		views.RenderError(w, r, http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/boards", http.StatusSeeOther)
 }
 
 func (c BoardsController) Shuffle(w http.ResponseWriter, r *http.Request) {
-	card, err := func() (card *models.Card, err error) {
-		id, ok := mux.Vars(r)["id"]
-
-		// If an id is present, narrow selection to cards from that specific board
-		if ok {
-			board, err := models.GetBoard(r.Context(), id)
-			if err != nil {
-				return nil, err
-			}
-
-			return board.GetRandomCard()
-		} else {
-			// Get all boards on the account
-			boards, err := models.GetValidBoards(r.Context())
-			if err != nil {
-				return nil, err
-			}
-
-			return models.GetRandomCard(r.Context(), boards)
-		}
-	}()
+	strategy, err := c.Shuffler.Strategy(w, r, boardShuffleScope(r))
+	if err != nil {
+		log.Println(err)
+		views.RenderError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	card, err := getRandomBoardCard(r, strategy)
+	if err != nil {
+		log.Println(err)
+		views.RenderError(w, r, http.StatusInternalServerError)
+		return
+	}
+
+	images := card.GetImages()
+	c.Analyzer.FillEdgeColors(r.Context(), images)
+	loadPhoto(r, card)
+
+	settings := models.SettingsFromContext(r.Context())
+
+	data := struct {
+		Card            *models.Card    `json:"card"`
+		BackgroundColor string          `json:"backgroundColor"`
+		Images          []ImagePreviews `json:"images"`
+		AutoRefresh     int             `json:"autoRefresh"`
+		ShowDuration    int             `json:"showDuration"`
+		Overlay         *CardOverlay    `json:"overlay,omitempty"`
+		PlaylistURL     string          `json:"playlistUrl"`
+	}{
+		Card:            card,
+		BackgroundColor: backgroundColor(images),
+		Images:          newImagePreviews(images, card.GetVideos()),
+		AutoRefresh:     autoRefresh(settings, len(images)+len(card.GetVideos())),
+		ShowDuration:    settings.ShowDuration,
+		PlaylistURL:     playlistURL(r),
+		Overlay:         newCardOverlay(r, card),
+	}
+
+	views.Render(w, r, "cards/show.html.tmpl", data)
+}
+
+// Daily shows the card of the day from a board, which is the same until the
+// next day for everyone with the same lists shown.
+func (c BoardsController) Daily(w http.ResponseWriter, r *http.Request) {
+	board, err := models.GetBoard(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		log.Println(err)
+		views.RenderError(w, r, http.StatusNotFound)
+		return
+	}
 
+	card, err := board.GetDailyCard(r.Context(), time.Now())
 	if err != nil {
 		log.Println(err)
-		w.WriteHeader(http.StatusInternalServerError)
+		views.RenderError(w, r, http.StatusInternalServerError)
 		return
 	}
 
 	images := card.GetImages()
+	c.Analyzer.FillEdgeColors(r.Context(), images)
+	loadPhoto(r, card)
 
 	data := struct {
-		Card            *models.Card
-		BackgroundColor string
-		Images          []ImagePreviews
-		AutoRefresh     int
-		ShowDuration    int
+		Card            *models.Card    `json:"card"`
+		BackgroundColor string          `json:"backgroundColor"`
+		Images          []ImagePreviews `json:"images"`
+		ShowDuration    int             `json:"showDuration"`
+		Overlay         *CardOverlay    `json:"overlay,omitempty"`
 	}{
 		Card:            card,
-		BackgroundColor: images[0].EdgeColor,
-		Images:          make([]ImagePreviews, len(images)),
-		AutoRefresh:     IMAGE_SHOW_DURATION * len(images),
-		ShowDuration:    IMAGE_SHOW_DURATION,
+		BackgroundColor: backgroundColor(images),
+		Images:          newImagePreviews(images, card.GetVideos()),
+		ShowDuration:    models.SettingsFromContext(r.Context()).ShowDuration,
+		Overlay:         newCardOverlay(r, card),
+	}
+
+	views.Render(w, r, "cards/show.html.tmpl", data)
+}
+
+// Picks a random card from the board given by the id route variable, or from
+// all boards on the account if there's none.
+func getRandomBoardCard(r *http.Request, strategy models.ShuffleStrategy) (*models.Card, error) {
+	id, ok := mux.Vars(r)["id"]
+
+	// If an id is present, narrow selection to cards from that specific board
+	if ok {
+		board, err := models.GetBoard(r.Context(), id)
+		if err != nil {
+			return nil, err
+		}
+
+		return board.GetRandomCard(r.Context(), strategy)
 	}
 
-	for i := range images {
-		data.Images[i].Previews = images[i].GetPreviews()
+	// Get all boards on the account
+	boards, err := models.GetValidBoards(r.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	return models.GetRandomCard(r.Context(), boards, strategy)
+}
+
+// The number of seconds a shuffle page shows a card, before moving on to the
+// next one, or 0 if auto-refresh is off. Cards with videos move on once every
+// video has played instead, since their durations aren't known up front.
+func autoRefresh(settings models.Settings, imageCount int) int {
+	if !settings.AutoRefresh {
+		return 0
+	}
+
+	return settings.ShowDuration * imageCount
+}
+
+// The shuffle scope of the board given by the id route variable, or of all
+// boards if there's none.
+func boardShuffleScope(r *http.Request) string {
+	if id, ok := mux.Vars(r)["id"]; ok {
+		return "board-" + id
 	}
 
-	views.Execute(w, r, "cards/show.html.tmpl", data)
+	return "all"
 }
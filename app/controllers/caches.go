@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"context"
+	"gallo/app/controllers/middlewares"
+	"gallo/app/models"
+	"gallo/lib"
+	"sync"
+	"time"
+
+	"github.com/go-redis/cache/v8"
+	"github.com/go-redis/redis/v8"
+)
+
+// Prefixes of the Redis sets with the keys tagged in each cache
+const (
+	REQUEST_CACHE_PREFIX  = "request"
+	RESPONSE_CACHE_PREFIX = "response"
+)
+
+// The tags of cached pages are kept for longer than the pages themselves
+var RESPONSE_TAGS_TIMEOUT = 24 * time.Hour
+
+// The ring of Redis servers shared by all caches, once connected
+var redisRing *redis.Ring
+var redisRingOnce sync.Once
+
+// Returns the ring of Redis servers at REDIS_ADDR, connecting on first use.
+func getRing() *redis.Ring {
+	redisRingOnce.Do(func() {
+		redisRing = redis.NewRing(&redis.RingOptions{
+			Addrs: map[string]string{
+				"server1": lib.MustGetEnv("REDIS_ADDR"),
+			},
+		})
+	})
+
+	return redisRing
+}
+
+// Returns the caches of responses from Trello, and of rendered pages. Entries
+// are kept in memory for a minute as well, if local is true.
+func newTaggedCaches(ring *redis.Ring, local bool) (requests, responses *lib.TaggedCache) {
+	newCache := func() *cache.Cache {
+		options := &cache.Options{Redis: ring}
+		if local {
+			options.LocalCache = cache.NewTinyLFU(1000, time.Minute)
+		}
+
+		return cache.New(options)
+	}
+
+	requests = lib.NewTaggedCache(
+		newCache(),
+		ring,
+		REQUEST_CACHE_PREFIX,
+		time.Duration(
+			middlewares.CACHING_TRANSPORT_TIMEOUT+middlewares.CACHING_TRANSPORT_STALE_TIMEOUT,
+		)*time.Hour,
+	)
+	responses = lib.NewTaggedCache(newCache(), ring, RESPONSE_CACHE_PREFIX, RESPONSE_TAGS_TIMEOUT)
+
+	return requests, responses
+}
+
+// PurgeCaches purges the entries with any of tags from the caches of responses
+// from Trello and of rendered pages, and returns the number of entries purged.
+// It's meant for purging from outside of the server, whose entries kept in
+// memory expire within a minute.
+func PurgeCaches(ctx context.Context, tags []string) (int, error) {
+	requests, responses := newTaggedCaches(getRing(), false)
+
+	return purgeCaches(ctx, tags, []models.CachePurger{requests, responses})
+}
+
+func purgeCaches(ctx context.Context, tags []string, caches []models.CachePurger) (int, error) {
+	total := 0
+
+	for _, cache := range caches {
+		purged, err := cache.Purge(ctx, tags)
+		total += purged
+
+		if err != nil {
+			return total, err
+		}
+	}
+
+	return total, nil
+}
@@ -3,6 +3,7 @@ package controllers
 import (
 	"gallo/app/models"
 	"gallo/app/views"
+	"html/template"
 	"log"
 	"net/http"
 
@@ -12,42 +13,134 @@ import (
 
 type ImagePreviews struct {
 	Previews []trello.AttachmentPreview `json:"previews"`
+	Caption  string                     `json:"caption,omitempty"`
+
+	// Set if the previews are posters of a video, which is played instead
+	Video *VideoSource `json:"video,omitempty"`
+}
+
+type VideoSource struct {
+	URL      string `json:"url"`
+	MimeType string `json:"mimeType"`
+}
+
+// The previews of images followed by those of videos, in the form shown on the
+// card page.
+func newImagePreviews(images []models.Image, videos []models.Video) []ImagePreviews {
+	previews := make([]ImagePreviews, 0, len(images)+len(videos))
+
+	for i := range images {
+		previews = append(previews, ImagePreviews{
+			Previews: images[i].GetPreviews(),
+			Caption:  images[i].Caption(),
+		})
+	}
+
+	for i := range videos {
+		previews = append(previews, ImagePreviews{
+			Previews: videos[i].GetPreviews(),
+			Caption:  videos[i].Caption(),
+			Video:    &VideoSource{videos[i].URL(), videos[i].MimeType},
+		})
+	}
+
+	return previews
+}
+
+// The background color of the page of a card, which is the edge color of its
+// first image. Cards with only videos have the default color.
+func backgroundColor(images []models.Image) string {
+	if len(images) == 0 {
+		return models.DefaultEdgeColor
+	}
+
+	return images[0].GetEdgeColor()
+}
+
+// Loads what's known about the photos of card from its custom fields, so they
+// can be shown with it. Failing that, the card is shown without.
+func loadPhoto(r *http.Request, card *models.Card) {
+	if card.List == nil {
+		return
+	}
+
+	err := models.LoadCustomFields(r.Context(), card.List, []*models.Card{card})
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// The number of the latest comments shown on the card page
+const OVERLAY_COMMENTS = 3
+
+// CardOverlay is the text shown on top of the images of a card, when captions
+// are turned on in the settings.
+type CardOverlay struct {
+	Description template.HTML    `json:"description"`
+	Comments    []models.Comment `json:"comments"`
 }
 
-type CardsController struct{}
+// Returns the overlay of card, or nil if captions are turned off. Comments
+// are only fetched if they are turned on as well.
+func newCardOverlay(r *http.Request, card *models.Card) *CardOverlay {
+	settings := models.SettingsFromContext(r.Context())
+	if !settings.ShowCaptions {
+		return nil
+	}
+
+	overlay := &CardOverlay{
+		Description: card.Description(),
+		Comments:    []models.Comment{},
+	}
+
+	if settings.ShowComments {
+		comments, err := models.GetComments(r.Context(), card, OVERLAY_COMMENTS)
+		if err != nil {
+			log.Println(err)
+		} else {
+			overlay.Comments = comments
+		}
+	}
+
+	return overlay
+}
+
+type CardsController struct {
+	Analyzer *models.ImageAnalyzer
+}
 
 func (e CardsController) Show(w http.ResponseWriter, r *http.Request) {
 	id, ok := mux.Vars(r)["id"]
 
 	if !ok {
-		w.WriteHeader(http.StatusNotFound)
+		views.RenderError(w, r, http.StatusNotFound)
 		return
 	}
 
 	card, err := models.GetCard(r.Context(), id)
 	if err != nil {
 		log.Println(err)
-		w.WriteHeader(http.StatusNotFound)
+		views.RenderError(w, r, http.StatusNotFound)
 		return
 	}
 
 	images := card.GetImages()
+	e.Analyzer.FillEdgeColors(r.Context(), images)
+	loadPhoto(r, card)
 
 	data := struct {
-		Card            *models.Card
-		BackgroundColor string
-		Images          []ImagePreviews
-		ShowDuration    int
+		Card            *models.Card    `json:"card"`
+		BackgroundColor string          `json:"backgroundColor"`
+		Images          []ImagePreviews `json:"images"`
+		ShowDuration    int             `json:"showDuration"`
+		Overlay         *CardOverlay    `json:"overlay,omitempty"`
 	}{
 		Card:            card,
-		BackgroundColor: images[0].EdgeColor,
-		Images:          make([]ImagePreviews, len(images)),
-		ShowDuration:    IMAGE_SHOW_DURATION,
-	}
-
-	for i := range images {
-		data.Images[i].Previews = images[i].GetPreviews()
+		BackgroundColor: backgroundColor(images),
+		Images:          newImagePreviews(images, card.GetVideos()),
+		ShowDuration:    models.SettingsFromContext(r.Context()).ShowDuration,
+		Overlay:         newCardOverlay(r, card),
 	}
 
-	views.Execute(w, r, "cards/show.html.tmpl", data)
+	views.Render(w, r, "cards/show.html.tmpl", data)
 }
@@ -2,19 +2,30 @@ package controllers
 
 import (
 	"gallo/app/controllers/middlewares"
+	"gallo/app/models"
 	"gallo/app/views"
 	"gallo/lib"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/go-redis/cache/v8"
-	"github.com/go-redis/redis/v8"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/sessions"
 )
 
 var store *sessions.CookieStore
 
-const IMAGE_SHOW_DURATION = 15 // TODO: This should be a setting
+// Resized images never change, so they are kept until evicted by Redis
+var IMAGE_CACHE_TIMEOUT = 30 * 24 * time.Hour
+
+// Shuffle bags of sessions which haven't shuffled for this long are forgotten
+var SHUFFLE_BAG_TIMEOUT = 7 * 24 * time.Hour
+
+// Settings are kept until changed
+var SETTINGS_TIMEOUT time.Duration = 0
 
 func init() {
 	encKey := []byte(lib.MustGetEnv("SESSION_ENC_KEY"))
@@ -28,52 +39,207 @@ func NewRouter() *mux.Router {
 	router := mux.NewRouter()
 	router.Use(middlewares.LoggingMiddleware)
 
-	ring := redis.NewRing(&redis.RingOptions{
-		Addrs: map[string]string{
-			"server1": lib.MustGetEnv("REDIS_ADDR"),
-		},
-	})
-
-	requestCache := cache.New(&cache.Options{
-		Redis:      ring,
-		LocalCache: cache.NewTinyLFU(1000, time.Minute),
-	})
-
-	trelloClientMiddleware := middlewares.NewTrelloClientMiddleware(
-		requestCache,
-		lib.MustGetEnv("TRELLO_KEY"),
-		store,
-	)
-
-	responseCache := cache.New(&cache.Options{
-		Redis:      ring,
-		LocalCache: cache.NewTinyLFU(1000, time.Minute),
-	})
-
-	blacklist := []string{"shuffle$"}
-	cachingMiddleware := middlewares.NewCachingMiddleware(
-		responseCache,
-		store,
-		blacklist,
-	)
-
+	apiRouter := router.PathPrefix("/api/v1").Subrouter()
 	authorizedRouter := router.NewRoute().Subrouter()
-	authorizedRouter.Use(cachingMiddleware.Handler)
-	authorizedRouter.Use(trelloClientMiddleware.Handler)
+
+	// Settings are always stored in Redis, so every configuration needs it
+	ring := getRing()
+
+	settingsStore := models.NewSettingsStore(lib.NewRedisBlobCache(
+		cache.New(&cache.Options{Redis: ring}),
+		SETTINGS_TIMEOUT,
+	))
+	settingsMiddleware := middlewares.NewSettingsMiddleware(settingsStore)
+
+	var webhooksController *WebhooksController
+	var adminController *AdminController
+
+	switch source := lib.GetEnv("SOURCE", "trello"); source {
+	case "trello":
+		requestCache, responseCache := newTaggedCaches(ring, true)
+		caches := []models.CachePurger{requestCache, responseCache}
+
+		// With the secret of the Trello application, boards are watched with
+		// webhooks, and cached responses and pages are purged as they change.
+		// Otherwise they are only refreshed as they expire.
+		if secret := lib.GetEnv("TRELLO_SECRET", ""); secret != "" {
+			models.WebhookCallbackURL = lib.MustGetEnv("HOST") + "/webhooks/trello"
+
+			webhooksController = &WebhooksController{&models.WebhookReceiver{
+				Secret:      secret,
+				CallbackURL: models.WebhookCallbackURL,
+				Caches:      caches,
+			}}
+		}
+
+		trelloClientMiddleware := middlewares.NewTrelloClientMiddleware(
+			requestCache,
+			lib.MustGetEnv("TRELLO_KEY"),
+			store,
+		)
+
+		if token := lib.GetEnv("ADMIN_TOKEN", ""); token != "" {
+			adminController = &AdminController{token, caches, trelloClientMiddleware.Metrics()}
+		}
+
+		blacklist := []string{
+			"shuffle$",
+			"shuffle/playlist$",
+			"daily$",
+			"settings$",
+			"selection$",
+			"collages$",
+			"^/images/",
+			"^/collages/",
+			"^/videos/",
+		}
+		cachingMiddleware := middlewares.NewCachingMiddleware(
+			responseCache,
+			store,
+			blacklist,
+		)
+
+		// The settings are part of the cache key, so they are loaded first
+		authorizedRouter.Use(trelloClientMiddleware.Handler)
+		authorizedRouter.Use(settingsMiddleware.Handler)
+		authorizedRouter.Use(cachingMiddleware.Handler)
+
+		apiRouter.Use(trelloClientMiddleware.APIHandler)
+		apiRouter.Use(settingsMiddleware.Handler)
+		apiRouter.Use(cachingMiddleware.Handler)
+	case "filesystem":
+		// Photos are read from disk, but only shown to users logged in with
+		// Trello, the same as when they're read from Trello
+		requestCache, _ := newTaggedCaches(ring, true)
+		trelloClientMiddleware := middlewares.NewTrelloClientMiddleware(
+			requestCache,
+			lib.MustGetEnv("TRELLO_KEY"),
+			store,
+		)
+
+		filesystemSource := models.NewFilesystemSource(lib.MustGetEnv("SOURCE_PATH"))
+		sourceMiddleware := middlewares.NewSourceMiddleware(filesystemSource)
+
+		// The source replaces the one set up for the Trello client
+		authorizedRouter.Use(trelloClientMiddleware.Handler)
+		authorizedRouter.Use(sourceMiddleware.Handler)
+		authorizedRouter.Use(settingsMiddleware.Handler)
+		apiRouter.Use(trelloClientMiddleware.APIHandler)
+		apiRouter.Use(sourceMiddleware.Handler)
+		apiRouter.Use(settingsMiddleware.Handler)
+
+		filesController := FilesController{filesystemSource}
+		authorizedRouter.HandleFunc("/files/{id}", filesController.Show)
+	default:
+		log.Fatalf("Unknown source: %s", source)
+	}
+
+	models.ResizeImages = lib.GetEnv("RESIZE_IMAGES", "false") == "true"
+
+	dailyLocation, err := time.LoadLocation(lib.GetEnv("DAILY_TIMEZONE", "UTC"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	models.DailyLocation = dailyLocation
+
+	models.CoverPolicy = lib.GetEnv("COVER_POLICY", models.FirstImageCoverPolicy)
+	if err := models.ValidateCoverPolicy(models.CoverPolicy); err != nil {
+		log.Fatal(err)
+	}
+
+	var imageCache lib.BlobCache
+	var fileCache *lib.DiskBlobCache
+
+	if imageCachePath := lib.GetEnv("IMAGE_CACHE_PATH", ""); imageCachePath != "" {
+		fileCache = lib.NewDiskBlobCache(imageCachePath)
+		imageCache = fileCache
+	} else {
+		// No local cache here, since images would take up too much memory
+		imageCache = lib.NewRedisBlobCache(
+			cache.New(&cache.Options{Redis: ring}),
+			IMAGE_CACHE_TIMEOUT,
+		)
+	}
 
 	applicationController := ApplicationController{}
 	authController := AuthController{store}
-	listsController := ListsController{}
-	boardsController := BoardsController{}
-	cardsController := CardsController{}
+	imageAnalyzer := models.NewImageAnalyzer(imageCache)
+	shuffler := Shuffler{
+		Bags: lib.NewRedisBlobCache(
+			cache.New(&cache.Options{Redis: ring}),
+			SHUFFLE_BAG_TIMEOUT,
+		),
+		Store: store,
+	}
+
+	listsController := ListsController{
+		Analyzer:            imageAnalyzer,
+		BlurredPlaceholders: lib.GetEnv("BLURRED_PLACEHOLDERS", "false") == "true",
+		Settings:            settingsStore,
+		Shuffler:            shuffler,
+	}
+	boardsController := BoardsController{
+		Analyzer: imageAnalyzer,
+		Settings: settingsStore,
+		Shuffler: shuffler,
+	}
+	cardsController := CardsController{imageAnalyzer}
+	imagesController := ImagesController{imageCache}
+	// Without an image cache path, videos are still kept on disk, since they
+	// have to be served in ranges
+	videoFiles := fileCache
+	if videoFiles == nil {
+		videoFiles = lib.NewDiskBlobCache(filepath.Join(os.TempDir(), "gallo-videos"))
+	}
+
+	videosController := VideosController{
+		Cache:      imageCache,
+		Files:      videoFiles,
+		FFmpegPath: lib.GetEnv("FFMPEG_PATH", ""),
+	}
+	apiController := APIController{imageAnalyzer, shuffler}
+	playlistsController := PlaylistsController{imageAnalyzer, shuffler}
+	settingsController := SettingsController{settingsStore}
+
+	authorizedRouter.HandleFunc("/shuffle/playlist", playlistsController.Show)
+	authorizedRouter.HandleFunc("/boards/{id}/shuffle/playlist", playlistsController.Show)
+	authorizedRouter.HandleFunc("/lists/{id}/shuffle/playlist", playlistsController.ShowList)
+
+	authorizedRouter.HandleFunc("/settings", settingsController.Show).Methods("GET")
+	authorizedRouter.HandleFunc("/settings", settingsController.Update).Methods("POST")
 
 	authorizedRouter.HandleFunc("/boards", boardsController.Index)
 	authorizedRouter.HandleFunc("/shuffle", boardsController.Shuffle)
 	authorizedRouter.HandleFunc("/boards/{id}/shuffle", boardsController.Shuffle)
+	authorizedRouter.HandleFunc("/boards/{id}/daily", boardsController.Daily)
+	authorizedRouter.HandleFunc("/boards/{id}/selection", boardsController.Select).Methods("POST")
 
 	authorizedRouter.HandleFunc("/lists/{id}/shuffle", listsController.Shuffle)
+	authorizedRouter.HandleFunc("/lists/{id}/collages", listsController.Collages).Methods("POST")
 	authorizedRouter.PathPrefix("/lists/{id}").HandlerFunc(listsController.Show)
 	authorizedRouter.PathPrefix("/cards/{id}").HandlerFunc(cardsController.Show)
+	authorizedRouter.HandleFunc("/images/{id}/{width:[0-9]+}", imagesController.Show)
+	authorizedRouter.HandleFunc("/collages/{id}/{width:[0-9]+}", imagesController.Collage)
+	authorizedRouter.HandleFunc("/videos/{id}", videosController.Show)
+	authorizedRouter.HandleFunc("/videos/{id}/poster", videosController.Poster)
+
+	apiRouter.HandleFunc("/boards", apiController.Boards).Methods("GET")
+	apiRouter.HandleFunc("/boards/{id}", apiController.Board).Methods("GET")
+	apiRouter.HandleFunc("/boards/{id}/shuffle", apiController.Shuffle).Methods("GET")
+	apiRouter.HandleFunc("/boards/{id}/daily", apiController.Daily).Methods("GET")
+	apiRouter.HandleFunc("/boards/{id}/shuffle/playlist", playlistsController.Show).Methods("GET")
+	apiRouter.HandleFunc("/shuffle/playlist", playlistsController.Show).Methods("GET")
+	apiRouter.HandleFunc("/lists/{id}/shuffle/playlist", playlistsController.ShowList).Methods("GET")
+	apiRouter.HandleFunc("/shuffle", apiController.Shuffle).Methods("GET")
+	apiRouter.HandleFunc("/lists/{id}", apiController.List).Methods("GET")
+	apiRouter.HandleFunc("/lists/{id}/cards", apiController.ListCards).Methods("GET")
+	apiRouter.HandleFunc("/lists/{id}/groups", apiController.ListCardGroups).Methods("GET")
+	apiRouter.HandleFunc("/lists/{id}/shuffle", apiController.ListShuffle).Methods("GET")
+	apiRouter.HandleFunc("/cards/{id}", apiController.Card).Methods("GET")
+	apiRouter.HandleFunc("/settings", settingsController.ShowJSON).Methods("GET")
+	apiRouter.HandleFunc("/settings", settingsController.UpdateJSON).Methods("PUT")
+	apiRouter.NotFoundHandler = http.HandlerFunc(apiController.NotFound)
+	apiRouter.MethodNotAllowedHandler = http.HandlerFunc(apiController.MethodNotAllowed)
 
 	anonymousRouter := router.NewRoute().Subrouter()
 	anonymousRouter.HandleFunc("/auth", authController.Authenticate).
@@ -87,6 +253,20 @@ func NewRouter() *mux.Router {
 	anonymousRouter.HandleFunc("/auth", authController.Deauthenticate).
 		Methods("POST")
 
+	if webhooksController != nil {
+		anonymousRouter.HandleFunc("/webhooks/trello", webhooksController.Verify).
+			Methods("HEAD")
+		anonymousRouter.HandleFunc("/webhooks/trello", webhooksController.Receive).
+			Methods("POST")
+	}
+
+	if adminController != nil {
+		anonymousRouter.HandleFunc("/admin/cache/purge", adminController.Purge).
+			Methods("POST")
+		anonymousRouter.HandleFunc("/admin/metrics", adminController.ShowMetrics).
+			Methods("GET")
+	}
+
 	// Static assets etc.
 	router.PathPrefix("/").HandlerFunc(applicationController.RootHandler)
 
@@ -0,0 +1,32 @@
+package controllers
+
+import (
+	"gallo/app/models"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// FilesController serves the original images of a FilesystemSource.
+type FilesController struct {
+	Source *models.FilesystemSource
+}
+
+func (c FilesController) Show(w http.ResponseWriter, r *http.Request) {
+	id, ok := mux.Vars(r)["id"]
+
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	filePath, err := c.Source.FilePath(id)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	http.ServeFile(w, r, filePath)
+}
@@ -0,0 +1,210 @@
+package controllers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"gallo/app/models"
+	"gallo/lib"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// ImagesController serves attachments resized to one of models.PreviewWidths,
+// and collage covers of cards. Resized images and collages are kept in Cache,
+// so each size is only generated once. They are shared by every user who can
+// access the attachment or card, so access is checked before the cache is.
+type ImagesController struct {
+	Cache lib.BlobCache
+}
+
+// Returned for attachments, which can't be resized to the requested width
+var errNotResizable = errors.New("Not resizable")
+
+// The status to answer with, when getting something from the source failed.
+// It's only not found, if it doesn't exist or the user can't access it.
+func sourceErrorStatus(err error) int {
+	if models.IsNotFound(err) {
+		return http.StatusNotFound
+	}
+
+	return http.StatusInternalServerError
+}
+
+func (c ImagesController) Show(w http.ResponseWriter, r *http.Request) {
+	defer lib.Track(lib.RunningTime("ImagesController.Show"))
+
+	vars := mux.Vars(r)
+
+	id, ok := vars["id"]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	width, err := strconv.Atoi(vars["width"])
+	if err != nil || width <= 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	_, err = models.GetAttachment(r.Context(), r.URL.Query().Get("card"), id)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(sourceErrorStatus(err))
+		return
+	}
+
+	key := fmt.Sprintf("image-%s-%d", id, width)
+
+	data, err := c.Cache.Get(r.Context(), key)
+	if err != nil {
+		data, err = c.resize(r, id, width)
+		if err == errNotResizable {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(sourceErrorStatus(err))
+			return
+		}
+
+		err = c.Cache.Set(r.Context(), key, data)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+
+	// Any given size of an attachment never changes, but only those who can
+	// access it may see it
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	w.Header().Set("Content-Type", http.DetectContentType(data))
+	w.Write(data)
+}
+
+// Fetches and decodes the original attachment, and encodes it again in the
+// requested width. If it isn't an image, or the width isn't allowed for it,
+// errNotResizable is returned.
+func (c ImagesController) resize(r *http.Request, id string, width int) ([]byte, error) {
+	original, err := models.OpenAttachment(r.Context(), r.URL.Query().Get("card"), id)
+	if err != nil {
+		return nil, err
+	}
+	defer original.Close()
+
+	data, err := ioutil.ReadAll(original)
+	if err != nil {
+		return nil, err
+	}
+
+	img, format, err := lib.DecodeImage(data)
+	if err != nil {
+		log.Println(fmt.Sprintf("Failed to decode image %s: %s", id, err))
+		return nil, errNotResizable
+	}
+
+	// Only the predefined widths are allowed, apart from the original width, to
+	// avoid generating arbitrary numbers of sizes
+	if !isPreviewWidth(width) && width != img.Bounds().Dx() {
+		log.Println(fmt.Sprintf("Invalid width %d for image %s", width, id))
+		return nil, errNotResizable
+	}
+
+	buf := new(bytes.Buffer)
+
+	err = lib.EncodeImage(buf, lib.Resize(img, width), format)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func isPreviewWidth(width int) bool {
+	for _, w := range models.PreviewWidths {
+		if w == width {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Collage serves the collage cover of a card in one of the widths it's
+// rendered in. Collages are kept in Cache by the version of the images they
+// are composed of, so a new one is rendered once the images of the card change.
+func (c ImagesController) Collage(w http.ResponseWriter, r *http.Request) {
+	defer lib.Track(lib.RunningTime("ImagesController.Collage"))
+
+	vars := mux.Vars(r)
+
+	width, err := strconv.Atoi(vars["width"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	card, err := models.GetCard(r.Context(), vars["id"])
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(sourceErrorStatus(err))
+		return
+	}
+
+	images := card.GetImages()
+	if len(images) < 2 || !models.IsCollageWidth(images, width) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	version := models.CollageVersion(images)
+	key := fmt.Sprintf("collage-%s-%s-%d", card.ID(), version, width)
+
+	data, err := c.Cache.Get(r.Context(), key)
+	if err != nil {
+		data, err = c.collage(r, images, width)
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(sourceErrorStatus(err))
+			return
+		}
+
+		err = c.Cache.Set(r.Context(), key, data)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+
+	// A given version of a collage never changes, but the url without the
+	// current version might be reused for a new one
+	if r.URL.Query().Get("v") == version {
+		w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Write(data)
+}
+
+// Renders and encodes a collage of images in the given width.
+func (c ImagesController) collage(r *http.Request, images []models.Image, width int) ([]byte, error) {
+	img, err := models.RenderCollage(r.Context(), images, width)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+
+	err = lib.EncodeImage(buf, img, "jpeg")
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
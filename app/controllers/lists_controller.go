@@ -1,49 +1,187 @@
 package controllers
 
 import (
+	"errors"
+	"fmt"
+	"gallo/app/controllers/middlewares"
+	"gallo/app/helpers"
 	"gallo/app/models"
 	"gallo/app/views"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
 
 	"github.com/gorilla/mux"
 )
 
-type ListsController struct{}
+type ListsController struct {
+	Analyzer *models.ImageAnalyzer
+
+	// Whether cover images should have blurred thumbnails as placeholders,
+	// instead of rectangles in their edge color
+	BlurredPlaceholders bool
+
+	Settings *models.SettingsStore
+	Shuffler Shuffler
+}
 
 func (c ListsController) Show(w http.ResponseWriter, r *http.Request) {
 	id, ok := mux.Vars(r)["id"]
 
 	if !ok {
-		w.WriteHeader(http.StatusNotFound)
+		views.RenderError(w, r, http.StatusNotFound)
 		return
 	}
 
 	list, err := models.GetList(r.Context(), id)
 	if err != nil {
 		log.Println(err)
-		w.WriteHeader(http.StatusNotFound)
+		views.RenderError(w, r, http.StatusNotFound)
+		return
+	}
+
+	before, limit, err := listPageParams(r, models.DefaultListPageSize)
+	if err != nil {
+		log.Println(err)
+		views.RenderError(w, r, http.StatusBadRequest)
 		return
 	}
 
-	cards, err := list.GetCards()
+	page, err := list.GetCardsPage(before, limit)
 	if err != nil {
 		log.Println(err)
-		w.WriteHeader(http.StatusInternalServerError)
+		views.RenderError(w, r, http.StatusInternalServerError)
 		return
 	}
 
-	cardGroups := models.NewCardGroups(cards)
+	cards := page.Cards
+
+	models.UseCollageCovers(r.Context(), list, cards)
+
+	var analyzed bool
+
+	if c.BlurredPlaceholders {
+		coverImages := make([]*models.Image, len(cards))
+		for i := range cards {
+			coverImages[i] = &cards[i].CoverImage
+		}
+		analyzed = c.Analyzer.FillThumbnails(r.Context(), coverImages)
+	} else {
+		coverImages := make([]models.Image, len(cards))
+		for i := range cards {
+			coverImages[i] = cards[i].CoverImage
+		}
+		analyzed = c.Analyzer.FillAnalyzedEdgeColors(r.Context(), coverImages)
+	}
+
+	// The page is only kept once every cover has been analyzed, so it doesn't
+	// go without placeholders for as long as it's cached
+	if !analyzed {
+		middlewares.NoStore(w)
+	}
+
+	cardGroups := groupCards(r, list, cards)
 
 	data := struct {
-		List       *models.List
-		CardGroups []models.CardGroup
+		List       *models.List       `json:"list"`
+		CardGroups []models.CardGroup `json:"cardGroups"`
+		Grouping   models.Grouping    `json:"grouping"`
+		Collages   bool               `json:"collages"`
+		NextURL    string             `json:"nextUrl,omitempty"`
 	}{
 		List:       list,
 		CardGroups: cardGroups,
+		Grouping:   models.SettingsFromContext(r.Context()).Grouping,
+		Collages:   models.SettingsFromContext(r.Context()).Collages(list.ID()),
+		NextURL:    listPageURL(helpers.PathTo(list), page.Next, limit),
+	}
+
+	views.Render(w, r, "lists/show.html.tmpl", data)
+}
+
+// Groups cards on list with the grouping in the settings. Custom fields are
+// loaded first if the grouping uses them, since they can hold the dates of the
+// cards, and may be what they're grouped by.
+func groupCards(r *http.Request, list *models.List, cards []*models.Card) []models.CardGroup {
+	grouping := models.SettingsFromContext(r.Context()).Grouping
+
+	if grouping.UsesCustomFields() {
+		err := models.LoadCustomFields(r.Context(), list, cards)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+
+	return models.NewCardGroups(cards, grouping)
+}
+
+// Reads the before cursor and page size of a page of cards on a list from the
+// query of r. The page size is defaultLimit, unless another one is given.
+func listPageParams(r *http.Request, defaultLimit int) (before string, limit int, err error) {
+	query := r.URL.Query()
+
+	limit = defaultLimit
+
+	if value := query.Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil {
+			return "", 0, err
+		}
+
+		if limit < 1 || limit > models.MaxListPageSize {
+			return "", 0, errors.New(fmt.Sprintf("Page size out of bounds: %d", limit))
+		}
+	}
+
+	return query.Get("before"), limit, nil
+}
+
+// Returns the url of the page of cards on a list following the before cursor,
+// or an empty string if there's no cursor, since the current page is the last.
+// The page size is left out if it's the default, so pages are cached the same
+// no matter how they were reached.
+func listPageURL(path, before string, limit int) string {
+	if before == "" {
+		return ""
+	}
+
+	query := url.Values{"before": []string{before}}
+	if limit != models.DefaultListPageSize {
+		query.Set("limit", strconv.Itoa(limit))
 	}
 
-	views.Execute(w, r, "lists/show.html.tmpl", data)
+	return path + "?" + query.Encode()
+}
+
+// Collages turns collage covers on or off for a list in the settings,
+// depending on the posted enabled value, and goes back to the list.
+func (c ListsController) Collages(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		log.Println(err)
+		views.RenderError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	list, err := models.GetList(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		log.Println(err)
+		views.RenderError(w, r, http.StatusNotFound)
+		return
+	}
+
+	settings := models.SettingsFromContext(r.Context())
+	settings.SetCollages(list.ID(), r.PostForm.Get("enabled") == "true")
+
+	err = models.SaveSettings(r.Context(), c.Settings, &settings)
+	if err != nil {
+		log.Println(err)
+		views.RenderError(w, r, http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, helpers.PathTo(list), http.StatusSeeOther)
 }
 
 // Shuffle picks a random card from a list and renders it in the same
@@ -52,43 +190,54 @@ func (c ListsController) Shuffle(w http.ResponseWriter, r *http.Request) {
 	id, ok := mux.Vars(r)["id"]
 
 	if !ok {
-		w.WriteHeader(http.StatusNotFound)
+		views.RenderError(w, r, http.StatusNotFound)
 		return
 	}
 
 	list, err := models.GetList(r.Context(), id)
 	if err != nil {
 		log.Println(err)
-		w.WriteHeader(http.StatusNotFound)
+		views.RenderError(w, r, http.StatusNotFound)
+		return
+	}
+
+	strategy, err := c.Shuffler.Strategy(w, r, "list-"+id)
+	if err != nil {
+		log.Println(err)
+		views.RenderError(w, r, http.StatusBadRequest)
 		return
 	}
 
-	card, err := list.GetRandomCard()
+	card, err := list.GetRandomCard(r.Context(), strategy)
 	if err != nil {
 		log.Println(err)
-		w.WriteHeader(http.StatusInternalServerError)
+		views.RenderError(w, r, http.StatusInternalServerError)
 		return
 	}
 
 	images := card.GetImages()
+	c.Analyzer.FillEdgeColors(r.Context(), images)
+	loadPhoto(r, card)
+
+	settings := models.SettingsFromContext(r.Context())
 
 	data := struct {
-		Card            *models.Card
-		BackgroundColor string
-		Images          []ImagePreviews
-		AutoRefresh     int
-		ShowDuration    int
+		Card            *models.Card    `json:"card"`
+		BackgroundColor string          `json:"backgroundColor"`
+		Images          []ImagePreviews `json:"images"`
+		AutoRefresh     int             `json:"autoRefresh"`
+		ShowDuration    int             `json:"showDuration"`
+		Overlay         *CardOverlay    `json:"overlay,omitempty"`
+		PlaylistURL     string          `json:"playlistUrl"`
 	}{
 		Card:            card,
-		BackgroundColor: images[0].EdgeColor,
-		Images:          make([]ImagePreviews, len(images)),
-		AutoRefresh:     IMAGE_SHOW_DURATION * len(images),
-		ShowDuration:    IMAGE_SHOW_DURATION,
-	}
-
-	for i := range images {
-		data.Images[i].Previews = images[i].GetPreviews()
+		BackgroundColor: backgroundColor(images),
+		Images:          newImagePreviews(images, card.GetVideos()),
+		AutoRefresh:     autoRefresh(settings, len(images)+len(card.GetVideos())),
+		ShowDuration:    settings.ShowDuration,
+		PlaylistURL:     playlistURL(r),
+		Overlay:         newCardOverlay(r, card),
 	}
 
-	views.Execute(w, r, "cards/show.html.tmpl", data)
+	views.Render(w, r, "cards/show.html.tmpl", data)
 }
@@ -5,31 +5,43 @@ import (
 	"errors"
 	"fmt"
 	"gallo/app/constants"
+	"gallo/app/models"
+	"gallo/app/views"
 	"gallo/lib"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"regexp"
 	"strings"
 
 	"github.com/go-redis/cache/v8"
+	"github.com/gorilla/mux"
 	"github.com/gorilla/sessions"
 )
 
 // CachingMiddleware is a simple response cache. Responses are recorded by a
 // httptest.ResponseRecorder, marshalled with msgpack and stored in Redis. The
-// cache key for each response, is simply a concatenation of the url and a
-// unique session token.
+// cache key for each response, is simply a concatenation of the url, the
+// negotiated content type, the version of the user's settings and a unique
+// session token. The settings are read from the request context, so this must
+// come after SettingsMiddleware.
+//
+// If the cache is a lib.CacheTagger, each response is tagged with its route and
+// the tags collected in the lib.CacheTags of the request context while it was
+// rendered, so it must also come after TrelloClientMiddleware. Responses built
+// from fallbacks, because Trello failed, aren't cached, so they are built again
+// once it's back. Neither are responses marked with NoStore.
 type CachingMiddleware struct {
 	cache      lib.RedisCacheProvider
 	store      *sessions.CookieStore
 	sessionKey string
-	blacklist  []string // urls matching these patterns will not be cached
+	blacklist  []string // paths matching these patterns will not be cached
 }
 
 // NewCachingMiddleware creates a new middleware with a cookie session store.
-// The blacklist should contain a set of regular expressions that matches URLs
-// which should not be cached.
+// The blacklist should contain a set of regular expressions that matches the
+// paths of URLs which should not be cached, whatever their query.
 func NewCachingMiddleware(
 	cache lib.RedisCacheProvider,
 	store *sessions.CookieStore,
@@ -50,16 +62,9 @@ func (c CachingMiddleware) Handler(next http.Handler) http.Handler {
 			return
 		}
 
-		for i := range c.blacklist {
-			pattern := c.blacklist[i]
-			matched, err := regexp.Match(pattern, []byte(r.URL.String()))
-			if err != nil {
-				log.Println(matched, err)
-			}
-			if matched {
-				next.ServeHTTP(w, r)
-				return
-			}
+		if c.isBlacklisted(r.URL) {
+			next.ServeHTTP(w, r)
+			return
 		}
 
 		session, _ := c.store.Get(r, constants.SessionName)
@@ -68,8 +73,20 @@ func (c CachingMiddleware) Handler(next http.Handler) http.Handler {
 			recorder := new(lib.SlicedResponseRecorder)
 			hit := "True"
 
+			// A degraded or incomplete response isn't cached, but there's no
+			// need to render it again
+			var uncached *httptest.ResponseRecorder
+
+			key := fmt.Sprintf(
+				"%s-%d-%s-%s",
+				token.(string),
+				models.SettingsFromContext(r.Context()).Version,
+				views.Representation(r),
+				cacheURL(r.URL),
+			)
+
 			err := c.cache.Once(&cache.Item{
-				Key:   fmt.Sprintf("%s-%s", token.(string), r.URL.String()),
+				Key:   key,
 				Value: recorder,
 				Do: func(*cache.Item) (interface{}, error) {
 					rec := httptest.NewRecorder()
@@ -80,7 +97,15 @@ func (c CachingMiddleware) Handler(next http.Handler) http.Handler {
 					result := rec.Result()
 					isSuccess := result.StatusCode >= 200 && result.StatusCode <= 299
 
+					if lib.IsDegraded(r.Context()) || rec.Header().Get("Cache-Control") == noStore {
+						uncached = rec
+
+						return nil, errUncachedResponse
+					}
+
 					if isSuccess {
+						c.tagResponse(r, key)
+
 						return lib.NewSlicedResponseRecorder(rec), nil
 					} else {
 						var sb strings.Builder
@@ -100,6 +125,18 @@ func (c CachingMiddleware) Handler(next http.Handler) http.Handler {
 				},
 			})
 
+			if err == errUncachedResponse && uncached != nil {
+				for k, v := range uncached.Header() {
+					w.Header()[k] = v
+				}
+
+				w.Header().Set("Cache-Hit", hit)
+
+				w.WriteHeader(uncached.Code)
+				w.Write(uncached.Body.Bytes())
+				return
+			}
+
 			if err != nil {
 				log.Println(err.Error())
 
@@ -123,3 +160,71 @@ func (c CachingMiddleware) Handler(next http.Handler) http.Handler {
 		}
 	})
 }
+
+// Tells whether the path of u matches any of the blacklist. The query is left
+// out, since e.g. shuffles take parameters like the strategy, and must never
+// be cached with any of them.
+func (c CachingMiddleware) isBlacklisted(u *url.URL) bool {
+	for i := range c.blacklist {
+		matched, err := regexp.MatchString(c.blacklist[i], u.Path)
+		if err != nil {
+			log.Println(err)
+		}
+
+		if matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returned instead of responses, which are degraded or incomplete and mustn't
+// be cached
+var errUncachedResponse = errors.New("Response isn't cached")
+
+// The Cache-Control of responses, which mustn't be cached
+const noStore = "no-store"
+
+// NoStore marks the response written to w as one which mustn't be cached, e.g.
+// because it's incomplete until work going on in the background is done.
+func NoStore(w http.ResponseWriter) {
+	w.Header().Set("Cache-Control", noStore)
+}
+
+// Tags the response cached with key with its route, and the tags of what was
+// requested while it was rendered.
+func (c CachingMiddleware) tagResponse(r *http.Request, key string) {
+	tagger, ok := c.cache.(lib.CacheTagger)
+	if !ok {
+		return
+	}
+
+	tags := make([]string, 0)
+
+	if collected := lib.CacheTagsFromContext(r.Context()); collected != nil {
+		tags = append(tags, collected.Tags()...)
+	}
+
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			tags = append(tags, lib.RouteTag(template))
+		}
+	}
+
+	err := tagger.Tag(r.Context(), key, tags)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// Returns the url a response is cached by. Pages of e.g. a list are cached
+// individually by their query, which is put in order first, so the same page
+// is only cached once.
+func cacheURL(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.Path
+	}
+
+	return u.Path + "?" + u.Query().Encode()
+}
@@ -0,0 +1,128 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"gallo/app/constants"
+	"gallo/lib"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-redis/cache/v8"
+	"github.com/gorilla/sessions"
+	"gotest.tools/assert"
+)
+
+// countingCache keeps responses in memory, and counts how many were cached.
+type countingCache struct {
+	items  map[string]*lib.SlicedResponseRecorder
+	cached int
+}
+
+func newCountingCache() *countingCache {
+	return &countingCache{items: make(map[string]*lib.SlicedResponseRecorder)}
+}
+
+func (c *countingCache) Once(item *cache.Item) error {
+	recorder, ok := c.items[item.Key]
+	if !ok {
+		value, err := item.Do(item)
+		if err != nil {
+			return err
+		}
+
+		recorder = value.(*lib.SlicedResponseRecorder)
+		c.items[item.Key] = recorder
+		c.cached++
+	}
+
+	*item.Value.(*lib.SlicedResponseRecorder) = *recorder
+
+	return nil
+}
+
+func (c *countingCache) Get(ctx context.Context, key string, value interface{}) error {
+	return errors.New("not implemented")
+}
+
+func (c *countingCache) Set(item *cache.Item) error {
+	return errors.New("not implemented")
+}
+
+func (c *countingCache) Delete(ctx context.Context, key string) error {
+	delete(c.items, key)
+	return nil
+}
+
+func TestCachingMiddlewareBlacklist(t *testing.T) {
+	store := sessions.NewCookieStore([]byte("0123456789abcdef0123456789abcdef"))
+	cache := newCountingCache()
+
+	middleware := NewCachingMiddleware(cache, store, []string{"shuffle$", "shuffle/playlist$", "daily$"})
+	handler := middleware.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("foo"))
+	}))
+
+	// Requests are only cached in a session with a token
+	session, err := store.New(httptest.NewRequest("GET", "/", nil), constants.SessionName)
+	assert.NilError(t, err)
+	session.Values[constants.TrelloTokenSessionKey] = "token"
+
+	w := httptest.NewRecorder()
+	assert.NilError(t, session.Save(httptest.NewRequest("GET", "/", nil), w))
+	cookie := w.Header().Get("Set-Cookie")
+
+	request := func(target string) {
+		r := httptest.NewRequest("GET", target, nil)
+		r.Header.Set("Cookie", cookie)
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		assert.Equal(t, w.Body.String(), "foo")
+	}
+
+	t.Run("Other pages are cached", func(t *testing.T) {
+		request("/lists/123?before=456")
+		assert.Equal(t, cache.cached, 1)
+	})
+
+	t.Run("Responses marked with NoStore aren't cached", func(t *testing.T) {
+		handler := middleware.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			NoStore(w)
+			w.Write([]byte("foo"))
+		}))
+
+		r := httptest.NewRequest("GET", "/lists/123", nil)
+		r.Header.Set("Cookie", cookie)
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		assert.Equal(t, w.Body.String(), "foo")
+		assert.Equal(t, cache.cached, 1)
+	})
+
+	t.Run("Blacklisted paths aren't cached with a query", func(t *testing.T) {
+		request("/boards/123/shuffle?strategy=no-repeat")
+		request("/shuffle?strategy=uniform-by-list")
+		assert.Equal(t, cache.cached, 1)
+	})
+
+	t.Run("Filtered shuffles aren't cached", func(t *testing.T) {
+		request("/shuffle?location=Skagen")
+		request("/lists/123/shuffle?person=Ida&strategy=uniform-by-card")
+		assert.Equal(t, cache.cached, 1)
+	})
+
+	t.Run("Playlists aren't cached with the query of their shuffle", func(t *testing.T) {
+		request("/boards/123/shuffle/playlist?count=5&strategy=no-repeat")
+		request("/shuffle/playlist?count=5")
+		assert.Equal(t, cache.cached, 1)
+	})
+
+	t.Run("Daily cards aren't cached past the day with a query", func(t *testing.T) {
+		request("/boards/123/daily?seed=foo")
+		request("/boards/123/daily?timezone=Europe%2FCopenhagen")
+		assert.Equal(t, cache.cached, 1)
+	})
+}
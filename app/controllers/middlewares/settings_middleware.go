@@ -0,0 +1,32 @@
+package middlewares
+
+import (
+	"gallo/app/models"
+	"log"
+	"net/http"
+)
+
+// SettingsMiddleware loads the settings of the current user into the request
+// context, where they can be found with models.SettingsFromContext. It must
+// come after the middleware providing the source, since that's where the
+// member ID comes from. If the settings can't be loaded, the defaults are used.
+type SettingsMiddleware struct {
+	store *models.SettingsStore
+}
+
+func NewSettingsMiddleware(store *models.SettingsStore) *SettingsMiddleware {
+	return &SettingsMiddleware{store}
+}
+
+func (s SettingsMiddleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		settings, err := models.GetSettings(r.Context(), s.store)
+		if err != nil {
+			log.Println(err)
+		}
+
+		ctx := models.NewSettingsContext(r.Context(), settings)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
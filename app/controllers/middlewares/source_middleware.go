@@ -0,0 +1,25 @@
+package middlewares
+
+import (
+	"gallo/app/models"
+	"net/http"
+)
+
+// SourceMiddleware makes a single models.Source available to all requests, the
+// same in every session. It's used after TrelloClientMiddleware when photos
+// aren't served from Trello, replacing the source it sets up.
+type SourceMiddleware struct {
+	source models.Source
+}
+
+func NewSourceMiddleware(source models.Source) *SourceMiddleware {
+	return &SourceMiddleware{source}
+}
+
+func (s SourceMiddleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := models.NewSourceContext(r.Context(), s.source)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -3,6 +3,8 @@ package middlewares
 import (
 	"context"
 	"gallo/app/constants"
+	"gallo/app/models"
+	"gallo/app/views"
 	"gallo/lib"
 	"net/http"
 	"time"
@@ -14,6 +16,21 @@ import (
 
 var CACHING_TRANSPORT_TIMEOUT = 3
 
+// Responses from Trello are still served for this many hours after they
+// expire, while they are refreshed in the background
+var CACHING_TRANSPORT_STALE_TIMEOUT = 21
+
+// A copy of each response from Trello is kept for this many hours, to fall back
+// on when Trello is down or rate limiting. Copies are kept per token, like the
+// responses themselves, so this is long enough to ride out an outage, without
+// keeping a copy around for every user who has been gone for weeks.
+var CACHING_TRANSPORT_FALLBACK_TIMEOUT = 3 * 24
+
+// Trello allows this many requests in ten seconds for each API key, and for
+// each token
+var TRELLO_KEY_RATE_LIMIT = 300
+var TRELLO_TOKEN_RATE_LIMIT = 100
+
 type TrelloClientMiddleware struct {
 	store            *sessions.CookieStore
 	sessionKey       string
@@ -26,38 +43,97 @@ func NewTrelloClientMiddleware(
 	key string,
 	store *sessions.CookieStore,
 ) *TrelloClientMiddleware {
+	cachingTransport := lib.NewCachingTransport(
+		cache,
+		time.Duration(CACHING_TRANSPORT_TIMEOUT)*time.Hour,
+	)
+	cachingTransport.StaleFor = time.Duration(CACHING_TRANSPORT_STALE_TIMEOUT) * time.Hour
+	cachingTransport.FallbackFor = time.Duration(CACHING_TRANSPORT_FALLBACK_TIMEOUT) * time.Hour
+
+	// Requests made by every client are limited together, since they are all
+	// made with the same key
+	cachingTransport.Transport = lib.NewRateLimitedTransport(
+		http.DefaultTransport,
+		lib.RateLimit{Requests: TRELLO_KEY_RATE_LIMIT, Period: 10 * time.Second},
+		lib.RateLimit{Requests: TRELLO_TOKEN_RATE_LIMIT, Period: 10 * time.Second},
+	)
+
 	return &TrelloClientMiddleware{
 		store, key,
-		lib.NewCachingTransport(cache, time.Duration(CACHING_TRANSPORT_TIMEOUT)*time.Hour),
+		cachingTransport,
 		time.Second * 10,
 	}
 }
 
+// Metrics returns the counts of how requests to Trello were answered.
+func (c TrelloClientMiddleware) Metrics() *lib.CacheMetrics {
+	return &c.cachingTransport.Metrics
+}
+
 func (c TrelloClientMiddleware) Handler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		session, _ := c.store.Get(r, constants.SessionName)
-
-		if token, ok := session.Values[constants.TrelloTokenSessionKey]; ok {
-			client := trello.NewClient(c.sessionKey, token.(string))
-
-			logger := logrus.New()
-			logger.SetLevel(logrus.DebugLevel)
-			client.Logger = logger
-
-			// Replace the default http client used by trello.Client, with a version
-			// that caches, as well as times out after ten seconds
-			client.Client = &http.Client{
-				Transport: c.cachingTransport,
-				Timeout:   c.clientTimeout,
+		ctx, ok := c.newContext(r)
+		if !ok {
+			if views.WantsJSON(r) {
+				views.ExecuteJSONError(w, r, http.StatusUnauthorized, "")
+			} else {
+				http.Redirect(w, r, "/auth", http.StatusFound)
 			}
 
-			ctx := context.WithValue(r.Context(), constants.TrelloClientContextKey, client)
+			return
+		}
 
-			w.Header().Set("Logged-In", "True")
+		w.Header().Set("Logged-In", "True")
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
 
-			next.ServeHTTP(w, r.WithContext(ctx))
-		} else {
-			http.Redirect(w, r, "/auth", http.StatusFound)
+// APIHandler is the same as Handler, except that requests without a session
+// are answered with a JSON error, instead of a redirect to the login page.
+func (c TrelloClientMiddleware) APIHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, ok := c.newContext(r)
+		if !ok {
+			views.ExecuteJSONError(w, r, http.StatusUnauthorized, "")
+			return
 		}
+
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// Creates a context with a Trello client for the token in the session of r. If
+// there's no token, ok is false. The tags of what's requested by the client are
+// collected in the lib.CacheTags of the context, and whether any of it is a
+// fallback, in its lib.Degradation.
+func (c TrelloClientMiddleware) newContext(r *http.Request) (ctx context.Context, ok bool) {
+	session, _ := c.store.Get(r, constants.SessionName)
+
+	token, ok := session.Values[constants.TrelloTokenSessionKey]
+	if !ok {
+		return nil, false
+	}
+
+	client := trello.NewClient(c.sessionKey, token.(string))
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.DebugLevel)
+	client.Logger = logger
+
+	// Replace the default http client used by trello.Client, with a version
+	// that caches, as well as times out after ten seconds
+	client.Client = &http.Client{
+		Transport: c.cachingTransport,
+		Timeout:   c.clientTimeout,
+	}
+
+	ctx = lib.NewCacheTagsContext(r.Context(), lib.NewCacheTags())
+	ctx = lib.NewDegradationContext(ctx, &lib.Degradation{})
+	client = client.WithContext(ctx)
+
+	ctx = context.WithValue(ctx, constants.TrelloClientContextKey, client)
+	ctx = models.NewSourceContext(ctx, models.NewTrelloSource(client))
+
+	return ctx, true
+}
@@ -0,0 +1,200 @@
+package controllers
+
+import (
+	"gallo/app/helpers"
+	"gallo/app/models"
+	"gallo/app/views"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// The number of cards in a playlist, unless given by the count query parameter
+const PLAYLIST_LENGTH = 5
+
+// The maximum number of cards in a playlist
+const PLAYLIST_MAX_LENGTH = 20
+
+// PlaylistsController picks the next cards of a shuffle, so the card page can
+// move on to them without reloading.
+type PlaylistsController struct {
+	Analyzer *models.ImageAnalyzer
+	Shuffler Shuffler
+}
+
+// PlaylistEntry holds everything the card page needs for showing a card.
+type PlaylistEntry struct {
+	Card            *models.Card    `json:"card"`
+	Date            string          `json:"date,omitempty"`
+	Location        string          `json:"location,omitempty"`
+	People          []string        `json:"people,omitempty"`
+	ListPath        string          `json:"listPath,omitempty"`
+	BackgroundColor string          `json:"backgroundColor"`
+	BackgroundClass string          `json:"backgroundClass"`
+	Images          []ImagePreviews `json:"images"`
+	Overlay         *CardOverlay    `json:"overlay,omitempty"`
+}
+
+// Show picks cards from the board given by the id route variable, or from all
+// boards if there's none, in the same manner as BoardsController.Shuffle.
+func (c PlaylistsController) Show(w http.ResponseWriter, r *http.Request) {
+	count, ok := c.getCount(w, r)
+	if !ok {
+		return
+	}
+
+	strategy, err := c.Shuffler.Strategy(w, r, boardShuffleScope(r))
+	if err != nil {
+		views.ExecuteJSONError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var cards []*models.Card
+
+	if id, ok := mux.Vars(r)["id"]; ok {
+		var board *models.Board
+
+		board, err = models.GetBoard(r.Context(), id)
+		if err != nil {
+			log.Println(err)
+			views.ExecuteJSONError(w, r, http.StatusNotFound, "Board not found")
+			return
+		}
+
+		cards, err = board.GetRandomCards(r.Context(), strategy, count)
+	} else {
+		var boards []*models.Board
+
+		boards, err = models.GetValidBoards(r.Context())
+		if err == nil {
+			cards, err = models.GetRandomCards(r.Context(), boards, strategy, count)
+		}
+	}
+
+	if err != nil {
+		log.Println(err)
+		views.ExecuteJSONError(w, r, http.StatusInternalServerError, "")
+		return
+	}
+
+	c.render(w, r, cards)
+}
+
+// ShowList picks cards from a list, in the same manner as
+// ListsController.Shuffle.
+func (c PlaylistsController) ShowList(w http.ResponseWriter, r *http.Request) {
+	count, ok := c.getCount(w, r)
+	if !ok {
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+
+	list, err := models.GetList(r.Context(), id)
+	if err != nil {
+		log.Println(err)
+		views.ExecuteJSONError(w, r, http.StatusNotFound, "List not found")
+		return
+	}
+
+	strategy, err := c.Shuffler.Strategy(w, r, "list-"+id)
+	if err != nil {
+		views.ExecuteJSONError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	cards, err := list.GetRandomCards(r.Context(), strategy, count)
+	if err != nil {
+		log.Println(err)
+		views.ExecuteJSONError(w, r, http.StatusInternalServerError, "")
+		return
+	}
+
+	c.render(w, r, cards)
+}
+
+// The url of the playlist continuing the shuffle requested by r, with the same
+// strategy and seed.
+func playlistURL(r *http.Request) string {
+	u := url.URL{Path: r.URL.Path + "/playlist", RawQuery: r.URL.RawQuery}
+
+	return u.String()
+}
+
+// Reads the count query parameter. If it's invalid, an error is rendered and ok
+// is false.
+func (c PlaylistsController) getCount(w http.ResponseWriter, r *http.Request) (count int, ok bool) {
+	value := r.URL.Query().Get("count")
+	if value == "" {
+		return PLAYLIST_LENGTH, true
+	}
+
+	count, err := strconv.Atoi(value)
+	if err != nil || count < 1 || count > PLAYLIST_MAX_LENGTH {
+		views.ExecuteJSONError(w, r, http.StatusBadRequest, "Invalid count")
+		return 0, false
+	}
+
+	return count, true
+}
+
+func (c PlaylistsController) render(w http.ResponseWriter, r *http.Request, cards []*models.Card) {
+	cardImages := make([][]models.Image, len(cards))
+	allImages := make([]models.Image, 0)
+
+	for i := range cards {
+		cardImages[i] = cards[i].GetImages()
+		allImages = append(allImages, cardImages[i]...)
+	}
+
+	// Edge colors are set on the shared attachments, so all cards are analyzed
+	// at once
+	c.Analyzer.FillEdgeColors(r.Context(), allImages)
+
+	entries := make([]PlaylistEntry, 0, len(cards))
+	settings := models.SettingsFromContext(r.Context())
+
+	for i, card := range cards {
+		images := cardImages[i]
+
+		// There's nothing to show for cards without images or videos
+		if len(images) == 0 && len(card.GetVideos()) == 0 {
+			continue
+		}
+
+		loadPhoto(r, card)
+
+		entry := PlaylistEntry{
+			Card:            card,
+			BackgroundColor: backgroundColor(images),
+			Images:          newImagePreviews(images, card.GetVideos()),
+			Overlay:         newCardOverlay(r, card),
+		}
+
+		if card.ShownDate() != nil {
+			entry.Date = helpers.FormatTimeAs(card.ShownDate(), settings)
+		}
+
+		entry.Location = card.Photo().Location
+		entry.People = card.Photo().People
+
+		if card.List != nil {
+			entry.ListPath = helpers.PathTo(card.List)
+		}
+
+		backgroundClass, err := helpers.ColorType(entry.BackgroundColor)
+		if err != nil {
+			log.Println(err)
+		}
+		entry.BackgroundClass = backgroundClass
+
+		entries = append(entries, entry)
+	}
+
+	views.ExecuteJSON(w, r, http.StatusOK, struct {
+		Cards []PlaylistEntry `json:"cards"`
+	}{entries})
+}
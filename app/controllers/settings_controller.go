@@ -0,0 +1,208 @@
+package controllers
+
+import (
+	"encoding/json"
+	"gallo/app/models"
+	"gallo/app/views"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SettingsController shows and saves the settings of the current user. The
+// settings page posts a form, while API clients put JSON.
+type SettingsController struct {
+	Store *models.SettingsStore
+}
+
+type boardListSelection struct {
+	Board       *models.Board
+	Selection   models.ListSelection
+	PhotoFields models.PhotoFields
+}
+
+type dateFormatOption struct {
+	Name   string `json:"name"`
+	Layout string `json:"layout"`
+}
+
+func (c SettingsController) Show(w http.ResponseWriter, r *http.Request) {
+	c.render(w, r, http.StatusOK, models.SettingsFromContext(r.Context()), "")
+}
+
+func (c SettingsController) ShowJSON(w http.ResponseWriter, r *http.Request) {
+	views.ExecuteJSON(w, r, http.StatusOK, struct {
+		Settings models.Settings `json:"settings"`
+	}{models.SettingsFromContext(r.Context())})
+}
+
+// Update saves the settings posted from the settings page, and redirects back
+// to it.
+func (c SettingsController) Update(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		log.Println(err)
+		views.RenderError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	settings := models.SettingsFromContext(r.Context())
+	settings.ShuffleStrategy = r.PostForm.Get("shuffleStrategy")
+	settings.AutoRefresh = r.PostForm.Get("autoRefresh") != ""
+	settings.ImageFit = r.PostForm.Get("imageFit")
+	settings.DateFormat = r.PostForm.Get("dateFormat")
+	settings.ShowCaptions = r.PostForm.Get("showCaptions") != ""
+	settings.ShowComments = r.PostForm.Get("showComments") != ""
+
+	settings.Grouping = models.Grouping{
+		By:                   r.PostForm.Get("groupBy"),
+		Field:                strings.TrimSpace(r.PostForm.Get("groupField")),
+		Sort:                 r.PostForm.Get("sort"),
+		LastActivityFallback: r.PostForm.Get("lastActivityFallback") != "",
+	}
+
+	settings.ShowDuration, err = strconv.Atoi(r.PostForm.Get("showDuration"))
+	if err != nil {
+		c.render(w, r, http.StatusBadRequest, settings, "Show duration must be a number")
+		return
+	}
+
+	// Boards opted in or out individually are kept, since they are toggled on
+	// the boards page
+	settings.BoardMarker = r.PostForm.Get("descriptionMarker") != ""
+	settings.BoardLabel = strings.TrimSpace(r.PostForm.Get("label"))
+
+	// Only the boards on the page are changed, so list selections of boards not
+	// currently shown are kept
+	lists := make(map[string]models.ListSelection, len(settings.Lists))
+	for id, selection := range settings.Lists {
+		lists[id] = selection
+	}
+
+	for _, id := range r.PostForm["listBoards"] {
+		prefix := "lists." + id + "."
+
+		lists[id] = models.ListSelection{
+			All:             r.PostForm.Get(prefix+"all") != "",
+			Watched:         r.PostForm.Get(prefix+"watched") != "",
+			NamePattern:     strings.TrimSpace(r.PostForm.Get(prefix + "namePattern")),
+			ExcludeArchived: r.PostForm.Get(prefix+"excludeArchived") != "",
+		}
+	}
+
+	settings.Lists = lists
+
+	photoFields := make(map[string]models.PhotoFields, len(settings.PhotoFields))
+	for id, fields := range settings.PhotoFields {
+		photoFields[id] = fields
+	}
+
+	for _, id := range r.PostForm["listBoards"] {
+		prefix := "fields." + id + "."
+
+		photoFields[id] = models.PhotoFields{
+			Taken:    strings.TrimSpace(r.PostForm.Get(prefix + "taken")),
+			Location: strings.TrimSpace(r.PostForm.Get(prefix + "location")),
+			People:   strings.TrimSpace(r.PostForm.Get(prefix + "people")),
+		}
+	}
+
+	settings.PhotoFields = photoFields
+
+	err = models.SaveSettings(r.Context(), c.Store, &settings)
+	if err != nil {
+		log.Println(err)
+		c.render(w, r, http.StatusBadRequest, settings, err.Error())
+		return
+	}
+
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+}
+
+// UpdateJSON replaces the settings with the ones in the JSON body of the
+// request. Settings left out of the body are reset to their defaults.
+func (c SettingsController) UpdateJSON(w http.ResponseWriter, r *http.Request) {
+	settings := models.DefaultSettings()
+
+	err := json.NewDecoder(r.Body).Decode(&settings)
+	if err != nil {
+		views.ExecuteJSONError(w, r, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	err = models.SaveSettings(r.Context(), c.Store, &settings)
+	if err != nil {
+		log.Println(err)
+		views.ExecuteJSONError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	c.ShowJSON(w, r.WithContext(models.NewSettingsContext(r.Context(), settings)))
+}
+
+func (c SettingsController) render(
+	w http.ResponseWriter,
+	r *http.Request,
+	status int,
+	settings models.Settings,
+	message string,
+) {
+	if views.WantsJSON(r) {
+		if status != http.StatusOK {
+			views.ExecuteJSONError(w, r, status, message)
+			return
+		}
+
+		c.ShowJSON(w, r)
+		return
+	}
+
+	boards, err := models.GetBoards(r.Context())
+	if err != nil {
+		log.Println(err)
+		views.RenderError(w, r, http.StatusInternalServerError)
+		return
+	}
+
+	boardLists := make([]boardListSelection, 0)
+	for _, board := range settings.IncludedBoards(boards) {
+		boardLists = append(boardLists, boardListSelection{
+			board,
+			settings.ListSelection(board.ID()),
+			settings.PhotoFieldsOf(board.ID()),
+		})
+	}
+
+	dateFormats := make([]dateFormatOption, 0, len(models.DateFormats))
+	for name, layout := range models.DateFormats {
+		dateFormats = append(dateFormats, dateFormatOption{name, layout})
+	}
+	sort.Slice(dateFormats, func(i, j int) bool {
+		return dateFormats[i].Name < dateFormats[j].Name
+	})
+
+	data := struct {
+		Settings          models.Settings
+		BoardLists        []boardListSelection
+		ShuffleStrategies []string
+		DateFormats       []dateFormatOption
+		GroupModes        []string
+		SortOrders        []string
+		Error             string
+	}{
+		Settings:          settings,
+		BoardLists:        boardLists,
+		ShuffleStrategies: models.ShuffleStrategyNames,
+		DateFormats:       dateFormats,
+		GroupModes:        models.GroupModes,
+		SortOrders:        models.SortOrders,
+		Error:             message,
+	}
+
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(status)
+
+	views.Execute(w, r, "settings/show.html.tmpl", data)
+}
@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"gallo/app/constants"
+	"gallo/app/models"
+	"gallo/lib"
+	mrand "math/rand"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/sessions"
+)
+
+// Shuffler creates the shuffle strategy selected by the strategy query
+// parameter of a request. Shuffle bags are kept in Bags per session and per
+// route, so e.g. shuffling a list doesn't use up the cards of its board.
+type Shuffler struct {
+	Bags  lib.BlobCache
+	Store *sessions.CookieStore
+}
+
+// Strategy returns the strategy for r, defaulting to the one in the settings of
+// the user. The scope identifies what's being shuffled, for keeping a bag per
+// route. If the seed query parameter is set, random numbers are generated from
+// it, so the same cards are picked every time. The location and person query
+// parameters limit the cards picked to the ones with photos from there, or of
+// them.
+func (s Shuffler) Strategy(
+	w http.ResponseWriter,
+	r *http.Request,
+	scope string,
+) (models.ShuffleStrategy, error) {
+	query := r.URL.Query()
+
+	name := query.Get("strategy")
+	if name == "" {
+		name = models.SettingsFromContext(r.Context()).ShuffleStrategy
+	}
+
+	var rnd *mrand.Rand
+	if seed := query.Get("seed"); seed != "" {
+		rnd = models.NewSeededRand(seed)
+	}
+
+	filter := models.ShuffleFilter{
+		Location: strings.TrimSpace(query.Get("location")),
+		Person:   strings.TrimSpace(query.Get("person")),
+	}
+
+	var strategy models.ShuffleStrategy
+	var err error
+
+	if name != models.NoRepeatStrategy {
+		strategy, err = models.NewShuffleStrategy(name, rnd, nil, "")
+	} else {
+		var bagID string
+
+		bagID, err = s.bagID(w, r)
+		if err != nil {
+			return nil, err
+		}
+
+		// Filtered shuffles go through a bag of their own
+		bagKey := fmt.Sprintf("shuffle-bag-%s-%s", bagID, scope)
+		if !filter.IsEmpty() {
+			bagKey += "-" + filter.Key()
+		}
+
+		strategy, err = models.NewShuffleStrategy(name, rnd, s.Bags, bagKey)
+	}
+
+	if err != nil || filter.IsEmpty() {
+		return strategy, err
+	}
+
+	return models.NewFilteredStrategy(strategy, filter), nil
+}
+
+// Returns a random ID identifying the session of r, which is created and saved
+// in the session if it's not there already.
+func (s Shuffler) bagID(w http.ResponseWriter, r *http.Request) (string, error) {
+	session, _ := s.Store.Get(r, constants.SessionName)
+
+	if bagID, ok := session.Values[constants.ShuffleBagSessionKey]; ok {
+		return bagID.(string), nil
+	}
+
+	b := make([]byte, 16)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	bagID := hex.EncodeToString(b)
+	session.Values[constants.ShuffleBagSessionKey] = bagID
+
+	err = session.Save(r, w)
+	if err != nil {
+		return "", err
+	}
+
+	return bagID, nil
+}
@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"gallo/app/models"
+	"gallo/lib"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// The largest video served, in bytes. Videos are written to disk, so they can
+// be served in ranges, which is required for playback on iOS.
+const MAX_VIDEO_SIZE = 64 << 20
+
+var errVideoTooLarge = errors.New(fmt.Sprintf("Video is larger than %d bytes", MAX_VIDEO_SIZE))
+
+// VideosController serves video attachments, and poster frames extracted from
+// them. Access to the attachment is checked first, since what's cached is
+// shared by every user who can access it.
+type VideosController struct {
+	// Poster frames are kept in Cache
+	Cache lib.BlobCache
+
+	// Videos are kept in Files, since an attachment never changes, so each is
+	// only downloaded once, rather than for every range requested
+	Files *lib.DiskBlobCache
+
+	// Path of the ffmpeg executable used for extracting poster frames. If it's
+	// empty, there are no posters.
+	FFmpegPath string
+}
+
+func (c VideosController) Show(w http.ResponseWriter, r *http.Request) {
+	defer lib.Track(lib.RunningTime("VideosController.Show"))
+
+	id := mux.Vars(r)["id"]
+
+	file, err := c.open(r, id)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(videoErrorStatus(err))
+		return
+	}
+	defer file.Close()
+
+	// Only video types are passed on, anything else is left to be sniffed
+	if mimeType := r.URL.Query().Get("type"); strings.HasPrefix(mimeType, "video/") {
+		w.Header().Set("Content-Type", mimeType)
+	}
+
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	http.ServeContent(w, r, id, time.Time{}, file)
+}
+
+func (c VideosController) Poster(w http.ResponseWriter, r *http.Request) {
+	defer lib.Track(lib.RunningTime("VideosController.Poster"))
+
+	id := mux.Vars(r)["id"]
+
+	if c.FFmpegPath == "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	_, err := models.GetAttachment(r.Context(), r.URL.Query().Get("card"), id)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(sourceErrorStatus(err))
+		return
+	}
+
+	key := fmt.Sprintf("poster-%s", id)
+
+	data, err := c.Cache.Get(r.Context(), key)
+	if err != nil {
+		data, err = c.poster(r, id)
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(videoErrorStatus(err))
+			return
+		}
+
+		err = c.Cache.Set(r.Context(), key, data)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Write(data)
+}
+
+// Videos too large to serve aren't found, like any other which can't be
+// accessed.
+func videoErrorStatus(err error) int {
+	if err == errVideoTooLarge {
+		return http.StatusNotFound
+	}
+
+	return sourceErrorStatus(err)
+}
+
+// Extracts the poster frame of the video attachment with the given id.
+func (c VideosController) poster(r *http.Request, id string) ([]byte, error) {
+	file, err := c.open(r, id)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return lib.PosterFrame(r.Context(), c.FFmpegPath, file.Name())
+}
+
+// Opens the video attachment with the given id, if the current user can access
+// it. It's read from Files, or written there from the source first.
+func (c VideosController) open(r *http.Request, id string) (*os.File, error) {
+	card := r.URL.Query().Get("card")
+
+	attachment, err := models.GetAttachment(r.Context(), card, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if attachment.Bytes > MAX_VIDEO_SIZE {
+		return nil, errVideoTooLarge
+	}
+
+	key := fmt.Sprintf("video-%s", id)
+
+	if file, err := c.Files.Open(key); err == nil {
+		return file, nil
+	}
+
+	original, err := models.OpenAttachment(r.Context(), card, id)
+	if err != nil {
+		return nil, err
+	}
+	defer original.Close()
+
+	limited := &sizeLimitedReader{original, MAX_VIDEO_SIZE}
+
+	err = c.Files.SetFrom(key, limited)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Files.Open(key)
+}
+
+// sizeLimitedReader reads from r, but fails once more than n bytes are read.
+type sizeLimitedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *sizeLimitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n, errVideoTooLarge
+	}
+
+	return n, err
+}
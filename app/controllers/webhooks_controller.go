@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"gallo/app/models"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+)
+
+// The largest action accepted from Trello, in bytes
+const MAX_WEBHOOK_SIZE = 1 << 20
+
+// WebhooksController receives the actions Trello posts for boards being
+// watched, and evicts whatever is cached about the boards, lists and cards
+// they change.
+type WebhooksController struct {
+	Receiver *models.WebhookReceiver
+}
+
+// Verify answers the HEAD request Trello makes, when a webhook is registered.
+func (c WebhooksController) Verify(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func (c WebhooksController) Receive(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, MAX_WEBHOOK_SIZE))
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	_, err = c.Receiver.Receive(
+		r.Context(),
+		body,
+		r.Header.Get(models.WebhookSignatureHeader),
+	)
+
+	switch {
+	case err == models.ErrInvalidWebhookSignature:
+		log.Println(err)
+		w.WriteHeader(http.StatusUnauthorized)
+	case err != nil:
+		// Trello retries actions which aren't answered with success, which
+		// is what's wanted if e.g. Redis is briefly unavailable
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusOK)
+	}
+}
@@ -77,6 +77,83 @@ func shrink(image models.Image) (width, height int) {
 	return
 }
 
+// PlaceholderURI is a data URI of a rectangle in the edge color of image, with
+// the same aspect ratio.
+func PlaceholderURI(image models.Image) string {
+	width, height := shrink(image)
+
+	placeHolder := Placeholder{width, height, image.GetEdgeColor()}
+
+	uri, err := placeHolder.DataURI()
+	if err != nil {
+		log.Println(err)
+		return ""
+	}
+
+	return uri
+}
+
+// BlurredPlaceholderURI is a data URI of the blurred thumbnail of image, if it
+// has one. Otherwise it's the same as PlaceholderURI.
+func BlurredPlaceholderURI(image models.Image) string {
+	if image.Thumbnail == nil {
+		return PlaceholderURI(image)
+	}
+
+	width, height := shrink(image)
+
+	placeHolder := BlurredPlaceholder{width, height, *image.Thumbnail}
+
+	uri, err := placeHolder.DataURI()
+	if err != nil {
+		log.Println(err)
+		return ""
+	}
+
+	return uri
+}
+
+func PathTo(model models.Model) string {
+	if model == nil {
+		log.Fatal("pathTo: model is Nil")
+	}
+
+	return path.Join("/", model.PluralName(), model.ID())
+}
+
+func FormatTime(t *time.Time) (formatted string) {
+	return FormatTimeAs(t, models.DefaultSettings())
+}
+
+// FormatTimeAs formats t with the date format of settings
+func FormatTimeAs(t *time.Time, settings models.Settings) (formatted string) {
+	if t == nil {
+		return "&nbsp;"
+	}
+
+	return settings.FormatDate(*t)
+}
+
+// ColorType calculates whether a color is "light" or "dark" and returns the
+// result
+func ColorType(stringColor string) (string, error) {
+	var c color.RGBA
+
+	_, err := fmt.Sscanf(stringColor, "#%02x%02x%02x", &c.R, &c.G, &c.B)
+	if err != nil {
+		return "", err
+	}
+
+	// Counting the perceptive luminance - human eye favors green color...
+	luminance := (0.299*float32(c.R) + 0.587*float32(c.G) + 0.114*float32(c.B)) / 255
+
+	if luminance > 0.5 {
+		return "light", nil
+	} else {
+		return "dark", nil
+	}
+}
+
 func NewAssetsHashLookup(digestPaths ...string) AssetsHashLookup {
 	lookup := make(AssetsHashLookup)
 
@@ -128,13 +205,7 @@ func init() {
 		"safeURL": func(s string) template.URL {
 			return template.URL(s)
 		},
-		"pathTo": func(model models.Model) string {
-			if model == nil {
-				log.Fatal("pathTo: model is Nil")
-			}
-
-			return path.Join("/", model.PluralName(), model.ID())
-		},
+		"pathTo": PathTo,
 		"pathToCss": func(fileName string) string {
 			value := path.Join("/assets/css", fileName)
 
@@ -173,20 +244,9 @@ func init() {
 
 			return value
 		},
-		"srcSetSizes": SrcSetSizes,
-		"placeholderURI": func(image models.Image) string {
-			width, height := shrink(image)
-
-			placeHolder := Placeholder{width, height, image.EdgeColor}
-
-			uri, err := placeHolder.DataURI()
-			if err != nil {
-				log.Println(err)
-				return ""
-			}
-
-			return uri
-		},
+		"srcSetSizes":           SrcSetSizes,
+		"placeholderURI":        PlaceholderURI,
+		"blurredPlaceholderURI": BlurredPlaceholderURI,
 		"toJSON": func(data interface{}) string {
 			jsonData, err := json.Marshal(data)
 			if err != nil {
@@ -206,13 +266,7 @@ func init() {
 			}
 			return rv.FieldByName(name).IsValid()
 		},
-		"formatTime": func(t *time.Time) (formatted string) {
-			if t == nil {
-				return "&nbsp;"
-			}
-
-			return t.Format("02 January 2006")
-		},
+		"formatTime": FormatTime,
 		"repeat": func(n int) []struct{} {
 			return make([]struct{}, n)
 		},
@@ -220,9 +274,9 @@ func init() {
 			return make([]struct{}, 3+rand.Intn(n))
 		},
 		"boardBackground": func(board models.Board) (attr string) {
-			if board.TrelloBoard.Prefs.BackgroundColor != "" {
-				attr = fmt.Sprintf("style=\"background: %s;\"", board.TrelloBoard.Prefs.BackgroundColor)
-			} else {
+			if board.BackgroundColor != "" {
+				attr = fmt.Sprintf("style=\"background: %s;\"", board.BackgroundColor)
+			} else if len(board.BackgroundImages) > 0 {
 				abs := func(n int) int {
 					if n < 0 {
 						return -n
@@ -232,8 +286,8 @@ func init() {
 				}
 
 				tmp, desiredWidth, j := 344, 344, 0
-				for i := range board.TrelloBoard.Prefs.BackgroundImageScaled {
-					diff := abs(desiredWidth - board.TrelloBoard.Prefs.BackgroundImageScaled[i].Width)
+				for i := range board.BackgroundImages {
+					diff := abs(desiredWidth - board.BackgroundImages[i].Width)
 
 					if diff < tmp {
 						tmp = diff
@@ -241,7 +295,7 @@ func init() {
 					}
 				}
 
-				backgroundImageURL := board.TrelloBoard.Prefs.BackgroundImageScaled[j].URL
+				backgroundImageURL := board.BackgroundImages[j].URL
 				attr = fmt.Sprintf("style=\"background-image: url(%s);\"", backgroundImageURL)
 			}
 
@@ -252,24 +306,8 @@ func init() {
 
 			return template.HTML(tag)
 		},
-		// Calculates whether a color is "light" or "dark" and returns the result
-		"colorType": func(stringColor string) (string, error) {
-			var c color.RGBA
-
-			_, err := fmt.Sscanf(stringColor, "#%02x%02x%02x", &c.R, &c.G, &c.B)
-			if err != nil {
-				return "", err
-			}
-
-			// Counting the perceptive luminance - human eye favors green color...
-			luminance := (0.299*float32(c.R) + 0.587*float32(c.G) + 0.114*float32(c.B)) / 255
-
-			if luminance > 0.5 {
-				return "light", nil
-			} else {
-				return "dark", nil
-			}
-		},
+		"colorType": ColorType,
+		"join":      strings.Join,
 		"appVersion": func() string {
 			return appVersion
 		},
@@ -2,6 +2,7 @@ package helpers
 
 import (
 	"testing"
+	"time"
 	"gallo/app/models"
 
 	"github.com/adlio/trello"
@@ -48,3 +49,14 @@ func TestShrink(t *testing.T) {
 	assert.Equal(t, width, 2)
 	assert.Equal(t, height, 3)
 }
+
+func TestFormatTimeAs(t *testing.T) {
+	date := time.Date(2020, time.March, 4, 0, 0, 0, 0, time.UTC)
+	settings := models.DefaultSettings()
+
+	assert.Equal(t, FormatTimeAs(nil, settings), "&nbsp;")
+	assert.Equal(t, FormatTimeAs(&date, settings), "04 March 2020")
+
+	settings.DateFormat = "short"
+	assert.Equal(t, FormatTimeAs(&date, settings), "04 Mar 2020")
+}
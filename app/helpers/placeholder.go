@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/base64"
 	"fmt"
+	"gallo/app/models"
 	"html/template"
 )
 
@@ -19,6 +20,44 @@ func (p Placeholder) DataURI() (uri string, err error) {
     <rect x="0" y="0" width="100%" height="100%" fill="{{ .Color }}"></rect>
   </svg>
   `
+
+	return svgDataURI(tmplString, p)
+}
+
+// BlurredPlaceholder is a placeholder showing a blurred thumbnail of an image,
+// stretched to the aspect ratio of the original. The edges of the blur are kept
+// opaque, so it doesn't fade into the background.
+type BlurredPlaceholder struct {
+	Width     int
+	Height    int
+	Thumbnail models.Thumbnail
+}
+
+func (p BlurredPlaceholder) DataURI() (uri string, err error) {
+	tmplString := `
+  <svg width="{{ .Width }}" height="{{ .Height }}" viewBox="0 0 {{ .Thumbnail.Width }} {{ .Thumbnail.Height }}" preserveAspectRatio="none" xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" version="1.1">
+    <filter id="blur" color-interpolation-filters="sRGB">
+      <feGaussianBlur stdDeviation="1"></feGaussianBlur>
+      <feComponentTransfer>
+        <feFuncA type="discrete" tableValues="1 1"></feFuncA>
+      </feComponentTransfer>
+    </filter>
+    <image filter="url(#blur)" x="0" y="0" width="{{ .Thumbnail.Width }}" height="{{ .Thumbnail.Height }}" preserveAspectRatio="none" xlink:href="{{ .ThumbnailURI }}"></image>
+  </svg>
+  `
+
+	data := struct {
+		BlurredPlaceholder
+		// The thumbnail is a data URI itself, which html/template would
+		// otherwise consider unsafe
+		ThumbnailURI template.URL
+	}{p, template.URL(p.Thumbnail.URI)}
+
+	return svgDataURI(tmplString, data)
+}
+
+// Renders an svg template with data and encodes the result as a data URI.
+func svgDataURI(tmplString string, data interface{}) (uri string, err error) {
 	tmpl, err := template.New("placeholder").Parse(tmplString)
 	if err != nil {
 		return
@@ -26,7 +65,7 @@ func (p Placeholder) DataURI() (uri string, err error) {
 
 	buf := new(bytes.Buffer)
 
-	err = tmpl.Execute(buf, p)
+	err = tmpl.Execute(buf, data)
 	if err != nil {
 		return
 	}
@@ -1,6 +1,9 @@
 package helpers
 
 import (
+	"encoding/base64"
+	"gallo/app/models"
+	"strings"
 	"testing"
 
 	"gotest.tools/assert"
@@ -15,3 +18,19 @@ func TestDataURI(t *testing.T) {
 	assert.NilError(t, err)
 	assert.Equal(t, actualURI, expectedURI)
 }
+
+func TestBlurredDataURI(t *testing.T) {
+	thumbnail := models.Thumbnail{Width: 24, Height: 16, URI: "data:image/jpeg;base64,Zm9v"}
+	placeholder := BlurredPlaceholder{3, 2, thumbnail}
+
+	uri, err := placeholder.DataURI()
+	assert.NilError(t, err)
+
+	prefix := "data:image/svg+xml;base64,"
+	assert.Assert(t, strings.HasPrefix(uri, prefix))
+
+	svg, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(uri, prefix))
+	assert.NilError(t, err)
+	assert.Assert(t, strings.Contains(string(svg), `viewBox="0 0 24 16"`))
+	assert.Assert(t, strings.Contains(string(svg), `xlink:href="data:image/jpeg;base64,Zm9v"`))
+}
@@ -2,25 +2,33 @@ package models
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"gallo/lib"
-	"math/rand"
-	"regexp"
+	"strings"
+	"time"
 
 	"github.com/adlio/trello"
 )
 
+// The word marking a board for use with gallo, when found in its description
+const descriptionMarker = "gallo"
+
 // Board is a decorator for *trello.Board, which only exposes needed members
 // data members, as well as hoists some methods to be funtion members in order
 // to make it easier to stub out expected behaviour from adlio/trello.
 type Board struct {
 	BackgroundBrightness string
+	BackgroundColor      string
+	BackgroundImages     []trello.BackgroundImage
 	Name                 string
 
 	Lists []*List
 
 	TrelloBoard *trello.Board
+
+	source Source
 }
 
 func NewBoard(trelloBoard *trello.Board) (*Board, error) {
@@ -30,6 +38,8 @@ func NewBoard(trelloBoard *trello.Board) (*Board, error) {
 
 	board := &Board{}
 	board.BackgroundBrightness = trelloBoard.Prefs.BackgroundBrightness
+	board.BackgroundColor = trelloBoard.Prefs.BackgroundColor
+	board.BackgroundImages = trelloBoard.Prefs.BackgroundImageScaled
 	board.Name = trelloBoard.Name
 
 	board.TrelloBoard = trelloBoard
@@ -50,34 +60,33 @@ func NewBoard(trelloBoard *trello.Board) (*Board, error) {
 	return board, nil
 }
 
+// Sets the source of the board and its lists.
+func (b *Board) setSource(source Source) {
+	b.source = source
+
+	for i := range b.Lists {
+		b.Lists[i].setSource(source)
+	}
+}
+
 // Memoized slice of lists on a board.
 func (b *Board) GetLists() ([]*List, error) {
 	if b.Lists == nil {
-		if b.TrelloBoard.Lists == nil {
-			trelloLists, err := b.TrelloBoard.GetLists(trello.Defaults())
-			if err != nil {
-				return nil, err
-			}
-
-			b.TrelloBoard.Lists = trelloLists
+		lists, err := defaultSource(b.source).GetBoardLists(b)
+		if err != nil {
+			return nil, err
 		}
 
-		for i := range b.TrelloBoard.Lists {
-			list, err := NewList(b.TrelloBoard.Lists[i])
-			if err != nil {
-				return nil, err
-			}
-
-			b.Lists = append(b.Lists, list)
-		}
+		b.Lists = lists
 	}
 
 	return b.Lists, nil
 }
 
 // The subset of lists on a board which follows the criteria of both being
-// subscribed to, and having at least a single card in them.
-func (b Board) GetValidLists() ([]*List, error) {
+// selected by the list selection of the board in the settings of ctx, and
+// having at least a single card in them.
+func (b *Board) GetValidLists(ctx context.Context) ([]*List, error) {
 	lists := make([]*List, 0)
 
 	boardLists, err := b.GetLists()
@@ -85,8 +94,10 @@ func (b Board) GetValidLists() ([]*List, error) {
 		return nil, err
 	}
 
+	selection := listSelection(ctx, b.ID())
+
 	for i := range boardLists {
-		if !boardLists[i].TrelloList.Subscribed {
+		if !selection.Includes(boardLists[i]) {
 			continue
 		}
 
@@ -103,14 +114,14 @@ func (b Board) GetValidLists() ([]*List, error) {
 	return lists, nil
 }
 
-func (b Board) GetList(id string) (*List, error) {
+func (b *Board) GetList(id string) (*List, error) {
 	boardLists, err := b.GetLists()
 	if err != nil {
 		return nil, err
 	}
 
 	for i := range boardLists {
-		if boardLists[i].TrelloList.ID == id {
+		if boardLists[i].ID() == id {
 			return boardLists[i], nil
 		}
 	}
@@ -118,24 +129,23 @@ func (b Board) GetList(id string) (*List, error) {
 	return nil, errors.New(fmt.Sprintf("Failed to find List with id: %s", id))
 }
 
-// Returns cards on a board, which belongs to a subscribed list. Board lists
-// should be sideloaded beforehand.
-func (b Board) GetCards() ([]*Card, error) {
+// Returns cards on a board, which belongs to a list selected by the settings in
+// ctx. Board lists should be sideloaded beforehand.
+func (b *Board) GetCards(ctx context.Context) ([]*Card, error) {
 	if b.Lists == nil {
 		return nil, errors.New("Board lists not loaded")
 	}
 
-	args := trello.Defaults()
-	args["card_attachments"] = "true"
-
-	trelloCards, err := b.TrelloBoard.GetCards(args)
+	boardCards, err := defaultSource(b.source).GetBoardCards(b)
 	if err != nil {
 		return nil, err
 	}
 
-	isOnSubscribedList := func(card *trello.Card, lists []*List) bool {
+	selection := listSelection(ctx, b.ID())
+
+	isOnSelectedList := func(card *Card, lists []*List) bool {
 		for i := range lists {
-			if card.IDList == lists[i].TrelloList.ID && lists[i].TrelloList.Subscribed {
+			if card.TrelloCard.IDList == lists[i].ID() && selection.Includes(lists[i]) {
 				return true
 			}
 		}
@@ -144,125 +154,168 @@ func (b Board) GetCards() ([]*Card, error) {
 
 	cards := []*Card{}
 
-	for _, trelloCard := range trelloCards {
-		if !isOnSubscribedList(trelloCard, b.Lists) {
+	for _, card := range boardCards {
+		if !isOnSelectedList(card, b.Lists) {
 			continue
 		}
 
-		card, err := NewCard(trelloCard)
-		if err != nil {
-			return nil, err
-		}
-
 		cards = append(cards, card)
 	}
 
 	return cards, nil
 }
 
-func (b Board) GetRandomCard() (*Card, error) {
-	lists, err := b.GetValidLists()
+// GetRandomCard picks one of the cards on the valid lists of the board with
+// strategy.
+func (b *Board) GetRandomCard(ctx context.Context, strategy ShuffleStrategy) (*Card, error) {
+	cards, err := b.GetRandomCards(ctx, strategy, 1)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(lists) == 0 {
-		return nil, errors.New(fmt.Sprintf("No lists in board %s", b.TrelloBoard.Name))
-	}
-
-	randomList := lists[rand.Intn(len(lists))]
-
-	return randomList.GetRandomCard()
-}
-
-func (b Board) ID() string {
-	return b.TrelloBoard.ID
-}
-
-func (b Board) PluralName() string {
-	return "boards"
+	return cards[0], nil
 }
 
-func GetBoard(ctx context.Context, id string) (*Board, error) {
-	client, err := clientFromContext(ctx)
+// GetRandomCards picks up to n different cards on the valid lists of the board
+// with strategy.
+func (b *Board) GetRandomCards(ctx context.Context, strategy ShuffleStrategy, n int) ([]*Card, error) {
+	lists, err := b.GetValidLists(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	args := trello.Defaults()
-	args["lists"] = "all"
+	if len(lists) == 0 {
+		return nil, errors.New(fmt.Sprintf("No lists in board %s", b.Name))
+	}
 
-	board, err := client.GetBoard(id, args)
-	if err != nil {
-		return nil, err
+	cards := make([]*Card, 0)
+
+	for i := range lists {
+		// Already memoized by GetValidLists
+		listCards, err := lists[i].GetCards()
+		if err != nil {
+			return nil, err
+		}
+
+		cards = append(cards, listCards...)
 	}
 
-	match, err := regexp.MatchString("gallo", board.Desc)
+	indices, err := pickCards(ctx, strategy, trelloCards(cards), n)
 	if err != nil {
 		return nil, err
 	}
 
-	if !match {
-		return nil, errors.New("Board doesn't have \"gallo\" in description")
+	picked := make([]*Card, len(indices))
+	for i := range indices {
+		picked[i] = cards[indices[i]]
 	}
 
-	return NewBoard(board)
+	return picked, nil
 }
 
-// All boards of a member, with lists sideloaded
-func GetBoards(ctx context.Context) ([]*Board, error) {
-	defer lib.Track(lib.RunningTime("GetBoards"))
+// DailyLocation is the time zone in which the card of the day changes.
+var DailyLocation = time.UTC
 
-	client, err := clientFromContext(ctx)
-	if err != nil {
-		return nil, err
+// GetDailyCard picks the card of the day from the board, on the day of
+// DailyLocation. It's the same card every time on a given day, as long as the
+// cards of the board don't change. Since the lists shown depend on the settings
+// of ctx, users with different settings can have different cards of the day.
+func (b *Board) GetDailyCard(ctx context.Context, day time.Time) (*Card, error) {
+	seed := fmt.Sprintf("%s-%s", b.ID(), day.In(DailyLocation).Format("2006-01-02"))
+
+	return b.GetRandomCard(ctx, UniformByCard{Rand: NewSeededRand(seed)})
+}
+
+// Whether the board has been marked for use with gallo, by having the word
+// "gallo" somewhere in the description.
+func (b Board) hasMarker() bool {
+	return strings.Contains(b.TrelloBoard.Desc, descriptionMarker)
+}
+
+// Whether the board defines a label with the given name, ignoring case.
+func (b Board) hasLabel(name string) bool {
+	labelNames := b.TrelloBoard.LabelNames
+
+	for _, labelName := range []string{
+		labelNames.Black,
+		labelNames.Blue,
+		labelNames.Green,
+		labelNames.Lime,
+		labelNames.Orange,
+		labelNames.Pink,
+		labelNames.Purple,
+		labelNames.Red,
+		labelNames.Sky,
+		labelNames.Yellow,
+	} {
+		if labelName != "" && strings.EqualFold(labelName, name) {
+			return true
+		}
 	}
 
-	// Sideload lists as a nested resource by default
-	args := trello.Defaults()
-	args["lists"] = "all"
+	return false
+}
 
-	trelloBoards, err := client.GetMyBoards(args)
+func (b Board) ID() string {
+	return b.TrelloBoard.ID
+}
+
+// MarshalJSON exposes the members of a board needed by clients of the API.
+// Lists are left out, since not all of them are shown.
+func (b Board) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		ID                   string                   `json:"id"`
+		Name                 string                   `json:"name"`
+		BackgroundBrightness string                   `json:"backgroundBrightness"`
+		BackgroundColor      string                   `json:"backgroundColor"`
+		BackgroundImages     []trello.BackgroundImage `json:"backgroundImages"`
+	}{b.ID(), b.Name, b.BackgroundBrightness, b.BackgroundColor, b.BackgroundImages})
+}
+
+func (b Board) PluralName() string {
+	return "boards"
+}
+
+func GetBoard(ctx context.Context, id string) (*Board, error) {
+	source, err := sourceFromContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	var boards []*Board
+	return source.GetBoard(id)
+}
 
-	for i := range trelloBoards {
-		board, err := NewBoard(trelloBoards[i])
-		if err != nil {
-			return nil, err
-		}
+// All boards of a member, with lists sideloaded
+func GetBoards(ctx context.Context) ([]*Board, error) {
+	defer lib.Track(lib.RunningTime("GetBoards"))
 
-		boards = append(boards, board)
+	source, err := sourceFromContext(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	return boards, nil
+	return source.GetBoards()
 }
 
-// Get boards which has at least one valid list and contains the word "gallo"
-// somewhere in the description
+// Get boards which has at least one valid list and are included by the settings
+// of ctx
 func GetValidBoards(ctx context.Context) ([]*Board, error) {
 	boards, err := GetBoards(ctx)
 	if err != nil {
 		return nil, err
 	}
 
+	return ValidBoards(ctx, SettingsFromContext(ctx).IncludedBoards(boards))
+}
+
+// ValidBoards returns the boards which has at least one valid list, with Lists
+// set to those. The cards of every list on the boards are loaded to tell, so
+// boards should be filtered by the settings first.
+func ValidBoards(ctx context.Context, boards []*Board) ([]*Board, error) {
 	filteredBoards := make([]*Board, 0)
 
 	for i := range boards {
-		// Skip boards without "gallo" in the description
-		match, err := regexp.MatchString("gallo", boards[i].TrelloBoard.Desc)
-		if err != nil {
-			return nil, err
-		}
-
-		if !match {
-			continue
-		}
-
-		lists, err := boards[i].GetValidLists()
+		lists, err := boards[i].GetValidLists(ctx)
 		if err != nil {
 			return nil, err
 		}
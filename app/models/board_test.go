@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/adlio/trello"
 	"github.com/jarcoal/httpmock"
@@ -105,7 +106,7 @@ func TestBoardGetValidLists(t *testing.T) {
 	assert.NilError(t, err)
 
 	t.Run("All lists should be subscribed", func(t *testing.T) {
-		lists, err := board.GetValidLists()
+		lists, err := board.GetValidLists(defaultContext)
 		assert.NilError(t, err)
 
 		assert.Assert(t, len(lists) > 0)
@@ -116,7 +117,7 @@ func TestBoardGetValidLists(t *testing.T) {
 	})
 
 	t.Run("All lists should have cards", func(t *testing.T) {
-		lists, err := board.GetValidLists()
+		lists, err := board.GetValidLists(defaultContext)
 		assert.NilError(t, err)
 
 		assert.Assert(t, len(lists) > 0)
@@ -184,7 +185,7 @@ func TestBoardGetCards(t *testing.T) {
 	assert.NilError(t, err)
 
 	t.Run("Only cards from a subscribed list", func(t *testing.T) {
-		cards, err := board.GetCards()
+		cards, err := board.GetCards(defaultContext)
 		assert.NilError(t, err)
 
 		assert.Equal(t, len(cards), 1)
@@ -226,7 +227,7 @@ func TestBoardGetRandomCard(t *testing.T) {
 		board, err := NewBoard(trelloBoard)
 		assert.NilError(t, err)
 
-		_, err = board.GetRandomCard()
+		_, err = board.GetRandomCard(defaultContext, UniformByCard{})
 		assert.ErrorContains(t, err, "No lists")
 	})
 
@@ -255,12 +256,68 @@ func TestBoardGetRandomCard(t *testing.T) {
 		board, err := NewBoard(trelloBoard)
 		assert.NilError(t, err)
 
-		card, err := board.GetRandomCard()
+		card, err := board.GetRandomCard(defaultContext, UniformByCard{})
 		assert.NilError(t, err)
 		assert.Assert(t, card.TrelloCard.ID == "37" || card.TrelloCard.ID == "38")
 	})
 }
 
+func TestBoardGetDailyCard(t *testing.T) {
+	httpmock.RegisterResponder(
+		"GET",
+		"https://api.trello.com/1/boards/1235?",
+		httpmock.NewBytesResponder(http.StatusOK, testData["testdata/boards-002.json"]),
+	)
+	httpmock.RegisterResponder(
+		"GET",
+		"https://api.trello.com/1/lists/236/cards?attachments=true",
+		httpmock.NewBytesResponder(http.StatusOK, testData["testdata/cards-006.json"]),
+	)
+	httpmock.RegisterResponder(
+		"GET",
+		"https://api.trello.com/1/lists/238/cards?attachments=true",
+		httpmock.NewBytesResponder(http.StatusOK, testData["testdata/cards-003.json"]),
+	)
+	defer httpmock.Reset()
+
+	getDailyCardID := func(day time.Time) string {
+		// trelloClient set by TestMain
+		trelloBoard, err := trelloClient.GetBoard("1235", trello.Defaults())
+		assert.NilError(t, err)
+
+		board, err := NewBoard(trelloBoard)
+		assert.NilError(t, err)
+
+		card, err := board.GetDailyCard(defaultContext, day)
+		assert.NilError(t, err)
+
+		return card.TrelloCard.ID
+	}
+
+	day := time.Date(2020, 6, 1, 8, 0, 0, 0, time.UTC)
+
+	t.Run("Same card during the day", func(t *testing.T) {
+		assert.Equal(t, getDailyCardID(day), getDailyCardID(day.Add(12*time.Hour)))
+	})
+
+	t.Run("Exact card for a given day", func(t *testing.T) {
+		assert.Equal(t, getDailyCardID(day), "38")
+	})
+
+	t.Run("Day of the daily location", func(t *testing.T) {
+		location := time.FixedZone("UTC+12", 12*60*60)
+
+		// The time zone of the given time doesn't matter
+		assert.Equal(t, getDailyCardID(day.In(location)), getDailyCardID(day))
+
+		DailyLocation = location
+		defer func() { DailyLocation = time.UTC }()
+
+		// Past noon in UTC, it's the following day twelve hours ahead
+		assert.Equal(t, getDailyCardID(day.Add(12*time.Hour)), getDailyCardID(day.AddDate(0, 0, 1)))
+	})
+}
+
 func TestGetBoard(t *testing.T) {
 	httpmock.RegisterResponder(
 		"GET",
@@ -279,9 +336,10 @@ func TestGetBoard(t *testing.T) {
 	)
 	defer httpmock.Reset()
 
-	t.Run("Description mismatch", func(t *testing.T) {
-		_, err := GetBoard(defaultContext, "1234")
-		assert.ErrorContains(t, err, "doesn't have \"gallo\"")
+	t.Run("Without description marker", func(t *testing.T) {
+		board, err := GetBoard(defaultContext, "1234")
+		assert.NilError(t, err)
+		assert.Equal(t, board.ID(), "1234")
 	})
 
 	t.Run("Valid id", func(t *testing.T) {
@@ -335,6 +393,11 @@ func TestGetValidBoards(t *testing.T) {
 		"https://api.trello.com/1/lists/237/cards?attachments=true",
 		httpmock.NewBytesResponder(http.StatusOK, testData["testdata/cards-006.json"]),
 	)
+	httpmock.RegisterResponder(
+		"GET",
+		"https://api.trello.com/1/lists/238/cards?attachments=true",
+		httpmock.NewBytesResponder(http.StatusOK, testData["testdata/cards-006.json"]),
+	)
 	defer httpmock.Reset()
 
 	t.Run("Get boards with 'gallo' in description' and at least one list", func(t *testing.T) {
@@ -347,4 +410,36 @@ func TestGetValidBoards(t *testing.T) {
 			assert.Assert(t, len(board.Lists) > 0)
 		}
 	})
+
+	t.Run("Get boards selected in settings", func(t *testing.T) {
+		settings := DefaultSettings()
+		settings.ExcludeBoard("1236")
+		settings.IncludeBoard("1238")
+
+		boards, err := GetValidBoards(NewSettingsContext(defaultContext, settings))
+		assert.NilError(t, err)
+		assert.Equal(t, len(boards), 2)
+		assert.Equal(t, boards[0].ID(), "1237")
+		assert.Equal(t, boards[1].ID(), "1238")
+	})
+
+	t.Run("Only lists of boards selected in settings are loaded", func(t *testing.T) {
+		httpmock.ZeroCallCounters()
+
+		_, err := GetValidBoards(defaultContext)
+		assert.NilError(t, err)
+
+		calls := httpmock.GetCallCountInfo()
+		assert.Equal(t, calls["GET https://api.trello.com/1/lists/237/cards?attachments=true"], 1)
+		assert.Equal(t, calls["GET https://api.trello.com/1/lists/238/cards?attachments=true"], 0)
+	})
+
+	t.Run("Valid boards among any boards", func(t *testing.T) {
+		boards, err := GetBoards(defaultContext)
+		assert.NilError(t, err)
+
+		boards, err = ValidBoards(defaultContext, boards)
+		assert.NilError(t, err)
+		assert.Equal(t, len(boards), 3)
+	})
 }
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"gallo/lib"
+	"html/template"
+	"path"
+	"strings"
+	"time"
+)
+
+// The file extensions of attachment names, which are left as uploaded and
+// therefore aren't captions
+var fileExtensions = []string{
+	".jpg", ".jpeg", ".png", ".gif", ".heic", ".webp", ".tif", ".tiff",
+	".mov", ".mp4", ".m4v", ".webm",
+}
+
+// Comment is a comment written on a card.
+type Comment struct {
+	Author string
+	Date   time.Time
+	// The comment as written, in markdown
+	Text string
+}
+
+// HTML is the text of the comment rendered as sanitized markdown.
+func (c Comment) HTML() template.HTML {
+	return template.HTML(lib.RenderMarkdown(c.Text))
+}
+
+func (c Comment) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Author string    `json:"author"`
+		Date   time.Time `json:"date"`
+		Text   string    `json:"text"`
+		HTML   string    `json:"html"`
+	}{c.Author, c.Date, c.Text, string(c.HTML())})
+}
+
+// GetComments returns up to limit of the latest comments on card, newest
+// first, from the source in ctx.
+func GetComments(ctx context.Context, card *Card, limit int) ([]Comment, error) {
+	source, err := sourceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	actions, err := source.GetCardComments(card.ID(), limit)
+	if err != nil {
+		return nil, err
+	}
+
+	comments := make([]Comment, 0, len(actions))
+
+	for _, action := range actions {
+		if action.Data == nil || action.Data.Text == "" {
+			continue
+		}
+
+		comment := Comment{Date: action.Date, Text: action.Data.Text}
+		if action.MemberCreator != nil {
+			comment.Author = action.MemberCreator.FullName
+		}
+
+		comments = append(comments, comment)
+	}
+
+	return comments, nil
+}
+
+// Description is the description of the card rendered as sanitized markdown.
+func (c Card) Description() template.HTML {
+	return template.HTML(lib.RenderMarkdown(c.TrelloCard.Desc))
+}
+
+// Caption is the name of the image, unless it's just the name of the file it
+// was uploaded from.
+func (i Image) Caption() string {
+	if i.Attachment == nil || i.IsCollage() {
+		return ""
+	}
+
+	return caption(i.Name)
+}
+
+// Caption is the name of the video, unless it's just the name of the file it
+// was uploaded from.
+func (v Video) Caption() string {
+	if v.Attachment == nil {
+		return ""
+	}
+
+	return caption(v.Name)
+}
+
+func caption(name string) string {
+	name = strings.TrimSpace(name)
+
+	if containsString(fileExtensions, strings.ToLower(path.Ext(name))) {
+		return ""
+	}
+
+	return name
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/adlio/trello"
+	"github.com/jarcoal/httpmock"
+	"gotest.tools/assert"
+)
+
+func Test_caption(t *testing.T) {
+	assert.Equal(t, caption("Sunset over the bay"), "Sunset over the bay")
+	assert.Equal(t, caption("  Trimmed "), "Trimmed")
+	assert.Equal(t, caption("IMG_1234.JPG"), "")
+	assert.Equal(t, caption("clip.mov"), "")
+	assert.Equal(t, caption("Dr. Smith"), "Dr. Smith")
+	assert.Equal(t, caption(""), "")
+}
+
+func TestImageCaption(t *testing.T) {
+	image := NewImage(&trello.Attachment{ID: "a", Name: "The old harbour"})
+	assert.Equal(t, image.Caption(), "The old harbour")
+
+	t.Run("Collages have no caption", func(t *testing.T) {
+		collage := newCollage("1", []Image{image, image})
+		assert.Equal(t, collage.Caption(), "")
+	})
+}
+
+func TestCardDescription(t *testing.T) {
+	card := &Card{TrelloCard: &trello.Card{Desc: "We **finally** made it <script>"}}
+
+	assert.Equal(t, string(card.Description()),
+		"<p>We <strong>finally</strong> made it &lt;script&gt;</p>\n")
+}
+
+func TestGetComments(t *testing.T) {
+	httpmock.RegisterResponder(
+		"GET",
+		"https://api.trello.com/1/cards/1/actions?filter=commentCard&limit=3",
+		httpmock.NewStringResponder(http.StatusOK, `[
+			{
+				"id": "c2",
+				"type": "commentCard",
+				"date": "2020-07-02T10:00:00.000Z",
+				"data": {"text": "Second *day*"},
+				"memberCreator": {"fullName": "Jane Doe"}
+			},
+			{
+				"id": "c1",
+				"type": "commentCard",
+				"date": "2020-07-01T10:00:00.000Z",
+				"data": {"text": ""},
+				"memberCreator": {"fullName": "John Doe"}
+			}
+		]`),
+	)
+	defer httpmock.Reset()
+
+	card := &Card{TrelloCard: &trello.Card{ID: "1"}}
+
+	comments, err := GetComments(defaultContext, card, 3)
+	assert.NilError(t, err)
+
+	// Comments without text are left out
+	assert.Equal(t, len(comments), 1)
+	assert.Equal(t, comments[0].Author, "Jane Doe")
+	assert.Equal(t, comments[0].Text, "Second *day*")
+	assert.Equal(t, string(comments[0].HTML()), "<p>Second <em>day</em></p>\n")
+}
@@ -2,8 +2,7 @@ package models
 
 import (
 	"context"
-	"errors"
-	"fmt"
+	"encoding/json"
 	"time"
 
 	"github.com/adlio/trello"
@@ -15,87 +14,95 @@ type Card struct {
 	List       *List
 
 	TrelloCard *trello.Card
-}
 
-// Create a new card and attach parent list, coverImage and attachments if
-// present
-func NewCard(trelloCard *trello.Card) (*Card, error) {
-	var coverAttachment *trello.Attachment
+	source Source
 
-	for _, attachment := range trelloCard.Attachments {
-		if attachment.ID == trelloCard.IDAttachmentCover {
-			coverAttachment = attachment
-			break
-		}
-	}
+	// Values of the custom fields of the card by name, once loaded
+	customFields map[string]interface{}
+	// The photos as told by the custom fields, once loaded
+	photo Photo
+}
 
-	if coverAttachment == nil {
-		return nil, errors.New(fmt.Sprintf(
-			"No cover attachment for card (%s, %s)",
-			trelloCard.ID,
-			trelloCard.Name,
-		))
+// Create a new card and attach parent list and attachments if present. The
+// cover image is chosen with CoverPolicy.
+func NewCard(trelloCard *trello.Card) (*Card, error) {
+	coverImage, err := chooseCover(trelloCard, CoverPolicy)
+	if err != nil {
+		return nil, err
 	}
 
-	coverImage := NewImage(coverAttachment)
-
 	if trelloCard.List != nil {
 		list, err := NewList(trelloCard.List)
 		if err != nil {
 			return nil, err
 		}
 
-		return &Card{trelloCard.Name, coverImage, list, trelloCard}, nil
+		return &Card{trelloCard.Name, coverImage, list, trelloCard, nil, nil, Photo{}}, nil
 	}
 
-	return &Card{trelloCard.Name, coverImage, nil, trelloCard}, nil
+	return &Card{trelloCard.Name, coverImage, nil, trelloCard, nil, nil, Photo{}}, nil
 }
 
 func GetCard(ctx context.Context, id string) (*Card, error) {
-	client, err := clientFromContext(ctx)
+	source, err := sourceFromContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	args := trello.Defaults()
-	args["attachments"] = "true"
-	args["list"] = "true"
+	return source.GetCard(id)
+}
 
-	var trelloCard *trello.Card
+// Sets the source of the card and its parent list.
+func (c *Card) setSource(source Source) {
+	c.source = source
 
-	trelloCard, err = client.GetCard(id, args)
-	if err != nil {
-		return nil, err
+	if c.List != nil {
+		c.List.setSource(source)
 	}
+}
 
-	card, err := NewCard(trelloCard)
-	if err != nil {
-		return nil, err
-	}
+func (c Card) GetImages() []Image {
+	return cardImages(c.TrelloCard)
+}
 
-	return card, nil
+// GetVideos returns the attachments of the card which are videos.
+func (c Card) GetVideos() []Video {
+	return cardVideos(c.TrelloCard)
 }
 
-func (c Card) GetImages() []Image {
-	images := make([]Image, 0)
+// Date is when the photos of the card were taken, if that's known from its
+// custom fields. Otherwise it's the date of the Trello card.
+func (c Card) Date() *time.Time {
+	if c.photo.Taken != nil {
+		return c.photo.Taken
+	}
 
-	for i := range c.TrelloCard.Attachments {
-		attachment := c.TrelloCard.Attachments[i]
+	return cardDate(c.TrelloCard)
+}
 
-		// MimeType can sometimes be null, if not guard by image MimeType
-		if len(attachment.Previews) > 0 {
-			images = append(images, NewImage(attachment))
-		}
+// ShownDate is the date shown along with the card, which is when the photos
+// were taken, or the due date. It's nil if the card has neither.
+func (c Card) ShownDate() *time.Time {
+	if c.photo.Taken != nil {
+		return c.photo.Taken
 	}
 
-	return images
+	return c.TrelloCard.Due
 }
 
-func (c Card) Date() *time.Time {
-	if c.TrelloCard.Due != nil {
-		return c.TrelloCard.Due
+// Photo returns what's known about the photos on the card from its custom
+// fields, which are loaded by LoadCustomFields.
+func (c Card) Photo() Photo {
+	return c.photo
+}
+
+// The date of a card is its due date if it has one, otherwise the time of the
+// last activity.
+func cardDate(trelloCard *trello.Card) *time.Time {
+	if trelloCard.Due != nil {
+		return trelloCard.Due
 	} else {
-		return c.TrelloCard.DateLastActivity
+		return trelloCard.DateLastActivity
 	}
 }
 
@@ -110,3 +117,22 @@ func (c Card) ID() string {
 func (c Card) PluralName() string {
 	return "cards"
 }
+
+// MarshalJSON exposes the members of a card needed by clients of the API,
+// rather than the full *trello.Card.
+func (c Card) MarshalJSON() ([]byte, error) {
+	var listID string
+	if c.List != nil && c.List.TrelloList != nil {
+		listID = c.List.ID()
+	}
+
+	return json.Marshal(struct {
+		ID         string     `json:"id"`
+		Name       string     `json:"name"`
+		Date       *time.Time `json:"date"`
+		DueDate    *time.Time `json:"dueDate"`
+		ListID     string     `json:"listId,omitempty"`
+		CoverImage Image      `json:"coverImage"`
+		Photo      Photo      `json:"photo"`
+	}{c.ID(), c.Name, c.Date(), c.DueDate(), listID, c.CoverImage, c.photo})
+}
@@ -1,34 +1,308 @@
 package models
 
-import "sort"
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
 
-// CardGroup represents a logical grouping of cards that belongs to the same
+// Ways of grouping the cards on a list
+const (
+	// Cards are grouped by the year of their date
+	GroupByYear = "year"
+	// Cards are grouped by the month of their date
+	GroupByMonth = "month"
+	// Cards are grouped by their labels in Trello. Cards with several labels
+	// are in the group of each.
+	GroupByLabel = "label"
+	// Cards are grouped by the value of a custom field in Trello
+	GroupByCustomField = "custom-field"
+	// All cards are in a single group
+	GroupByNone = "none"
+)
+
+// GroupModes are the names of all ways of grouping cards
+var GroupModes = []string{
+	GroupByYear,
+	GroupByMonth,
+	GroupByLabel,
+	GroupByCustomField,
+	GroupByNone,
+}
+
+// Orders of the cards within a group
+const (
+	// Newest cards first, and undated cards last
+	SortByDateDesc = "date-desc"
+	// Oldest cards first, and undated cards last
+	SortByDateAsc = "date-asc"
+	// Alphabetically by name
+	SortByName = "name"
+	// As the cards are ordered on the list in Trello
+	SortByPosition = "position"
+)
+
+// SortOrders are the names of all orders of cards
+var SortOrders = []string{
+	SortByDateDesc,
+	SortByDateAsc,
+	SortByName,
+	SortByPosition,
+}
+
+// Key of the group of cards without a date, label or custom field value, which
+// comes after all other groups
+const otherGroupKey = "other"
+
+// Grouping decides how the cards on a list are grouped and ordered.
+type Grouping struct {
+	// One of GroupModes
+	By string `json:"by"`
+	// Name of the custom field cards are grouped by with GroupByCustomField
+	Field string `json:"field"`
+	// One of SortOrders. Groups of years and months are ordered oldest first
+	// with SortByDateAsc, and newest first otherwise.
+	Sort string `json:"sort"`
+	// Whether the time of the last activity on cards without a taken or due
+	// date is used as their date. Otherwise they are grouped as undated.
+	LastActivityFallback bool `json:"lastActivityFallback"`
+}
+
+// DefaultGrouping groups cards by year, newest first, which is how lists were
+// shown before there were any other groupings.
+func DefaultGrouping() Grouping {
+	return Grouping{
+		By:                   GroupByYear,
+		Sort:                 SortByDateDesc,
+		LastActivityFallback: true,
+	}
+}
+
+// Validate returns an error if the grouping or order is unknown, or if there's
+// no custom field to group by.
+func (g Grouping) Validate() error {
+	if !containsString(GroupModes, g.By) {
+		return errors.New(fmt.Sprintf("Unknown grouping: %s", g.By))
+	}
+
+	if g.By == GroupByCustomField && strings.TrimSpace(g.Field) == "" {
+		return errors.New("Custom field to group by is missing")
+	}
+
+	if !containsString(SortOrders, g.Sort) {
+		return errors.New(fmt.Sprintf("Unknown sort order: %s", g.Sort))
+	}
+
+	return nil
+}
+
+// UsesCustomFields tells whether cards are grouped or ordered by their custom
+// fields, either by one named in the grouping, or by the date the photos were
+// taken.
+func (g Grouping) UsesCustomFields() bool {
+	switch g.By {
+	case GroupByYear, GroupByMonth, GroupByCustomField:
+		return true
+	}
+
+	return g.Sort == SortByDateDesc || g.Sort == SortByDateAsc
+}
+
+// Returns the date of a card used by the grouping, which is nil for undated
+// cards.
+func (g Grouping) date(card *Card) *time.Time {
+	if card.ShownDate() != nil || g.LastActivityFallback {
+		return card.Date()
+	}
+
+	return nil
+}
+
+// Returns the groups a card belongs to, with the key and name of each.
+func (g Grouping) groupsOf(card *Card) []CardGroup {
+	switch g.By {
+	case GroupByYear, GroupByMonth:
+		date := g.date(card)
+		if date == nil {
+			return []CardGroup{CardGroup{Key: otherGroupKey, Name: "Undated"}}
+		}
+
+		if g.By == GroupByMonth {
+			return []CardGroup{CardGroup{
+				Key:  date.Format("2006-01"),
+				Name: date.Format("January 2006"),
+				Year: date.Year(),
+			}}
+		}
+
+		return []CardGroup{CardGroup{
+			Key:  date.Format("2006"),
+			Name: date.Format("2006"),
+			Year: date.Year(),
+		}}
+	case GroupByLabel:
+		groups := make([]CardGroup, 0, len(card.TrelloCard.Labels))
+
+		for _, label := range card.TrelloCard.Labels {
+			if label.Name != "" {
+				groups = append(groups, CardGroup{Key: "label-" + label.Name, Name: label.Name})
+			}
+		}
+
+		if len(groups) == 0 {
+			return []CardGroup{CardGroup{Key: otherGroupKey, Name: "Unlabeled"}}
+		}
+
+		return groups
+	case GroupByCustomField:
+		value := card.CustomField(g.Field)
+		if value == "" {
+			return []CardGroup{CardGroup{Key: otherGroupKey, Name: "No " + g.Field}}
+		}
+
+		return []CardGroup{CardGroup{Key: "field-" + value, Name: value}}
+	}
+
+	return []CardGroup{CardGroup{Key: "all"}}
+}
+
+// GroupsDescending tells whether groups are ordered by descending sort key,
+// which is the case for years and months, unless they're ordered oldest first.
+func (g Grouping) GroupsDescending() bool {
+	switch g.By {
+	case GroupByYear, GroupByMonth:
+		return g.Sort != SortByDateAsc
+	}
+
+	return false
+}
+
+// Returns the key group is ordered by among the groups of a list, in the
+// direction given by GroupsDescending. The group of other cards comes last
+// either way, so it has no key.
+func (g Grouping) groupSortKey(group CardGroup) string {
+	if group.Key == otherGroupKey {
+		return ""
+	}
+
+	switch g.By {
+	case GroupByYear, GroupByMonth:
+		return group.Key
+	}
+
+	return strings.ToLower(group.Name)
+}
+
+// Tells whether group a comes before group b.
+func (g Grouping) groupLess(a, b CardGroup) bool {
+	if a.Key == otherGroupKey || b.Key == otherGroupKey {
+		return b.Key == otherGroupKey && a.Key != otherGroupKey
+	}
+
+	if g.GroupsDescending() {
+		return a.SortKey > b.SortKey
+	}
+
+	return a.SortKey < b.SortKey
+}
+
+// Tells whether card a comes before card b within a group.
+func (g Grouping) cardLess(a, b *Card) bool {
+	switch g.Sort {
+	case SortByName:
+		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+	case SortByPosition:
+		return a.TrelloCard.Pos < b.TrelloCard.Pos
+	}
+
+	dateA, dateB := g.date(a), g.date(b)
+	if dateA == nil || dateB == nil {
+		return dateA != nil && dateB == nil
+	}
+
+	if g.Sort == SortByDateAsc {
+		return dateA.Before(*dateB)
+	}
+
+	return dateA.After(*dateB)
+}
+
+// CardsDescending tells whether cards are ordered by descending sort key within
+// a group, which is the case when they're ordered newest first.
+func (g Grouping) CardsDescending() bool {
+	return g.Sort == SortByDateDesc
+}
+
+// CardSortKey returns the key card is ordered by within its group, in the
+// direction given by CardsDescending. Undated cards come last either way, so
+// they have no key when cards are ordered by date. Cards of a following page
+// are put in place among those already shown by it.
+func (g Grouping) CardSortKey(card *Card) string {
+	switch g.Sort {
+	case SortByName:
+		return strings.ToLower(card.Name)
+	case SortByPosition:
+		return fmt.Sprintf("%020.6f", card.TrelloCard.Pos)
+	}
+
+	date := g.date(card)
+	if date == nil {
+		return ""
+	}
+
+	return date.UTC().Format("2006-01-02T15:04:05.000000000")
+}
+
+// CardGroup represents a logical grouping of cards, like the ones from the same
 // calendar year.
 type CardGroup struct {
-	Year  int
-	Cards []*Card
+	// Identifies the group among the groups of a list
+	Key string `json:"key"`
+	// Name of the group as shown, which is empty with GroupByNone
+	Name string `json:"name"`
+	// Year of the group, when grouping by year or month
+	Year int `json:"year,omitempty"`
+	// Orders the group among the groups of a list, as described by
+	// Grouping.GroupsDescending. Groups of a following page of cards are put
+	// in place among those already shown by it.
+	SortKey string  `json:"sortKey"`
+	Cards   []*Card `json:"cards"`
 }
 
-func NewCardGroups(cards []*Card) (cardGroups []CardGroup) {
-	cardsByYear := make(map[int][]*Card)
+// NewCardGroups groups and orders cards with grouping.
+func NewCardGroups(cards []*Card, grouping Grouping) []CardGroup {
+	cardGroups := make([]CardGroup, 0)
+	indices := make(map[string]int)
 
 	for _, card := range cards {
-		cardsByYear[card.Date().Year()] = append(cardsByYear[card.Date().Year()], card)
-	}
+		for _, group := range grouping.groupsOf(card) {
+			i, ok := indices[group.Key]
+			if !ok {
+				i = len(cardGroups)
+				indices[group.Key] = i
+
+				group.SortKey = grouping.groupSortKey(group)
+				group.Cards = []*Card{}
+				cardGroups = append(cardGroups, group)
+			}
 
-	for year, cards := range cardsByYear {
-		group := CardGroup{
-			Year:  year,
-			Cards: cards,
+			cardGroups[i].Cards = append(cardGroups[i].Cards, card)
 		}
+	}
+
+	for i := range cardGroups {
+		cards := cardGroups[i].Cards
 
-		cardGroups = append(cardGroups, group)
+		sort.SliceStable(cards, func(a, b int) bool {
+			return grouping.cardLess(cards[a], cards[b])
+		})
 	}
 
-	// Sort by year descending
-	sort.Slice(cardGroups, func(i, j int) bool {
-		return cardGroups[i].Year > cardGroups[j].Year
+	sort.SliceStable(cardGroups, func(i, j int) bool {
+		return grouping.groupLess(cardGroups[i], cardGroups[j])
 	})
 
-	return
+	return cardGroups
 }
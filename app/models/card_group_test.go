@@ -13,6 +13,29 @@ func timeFromYear(year string) *time.Time {
 	return &t
 }
 
+func timeFromMonth(month string) *time.Time {
+	t, _ := time.Parse("2006-01", month)
+	return &t
+}
+
+func groupNames(groups []CardGroup) []string {
+	names := make([]string, len(groups))
+	for i := range groups {
+		names[i] = groups[i].Name
+	}
+
+	return names
+}
+
+func cardNames(cards []*Card) []string {
+	names := make([]string, len(cards))
+	for i := range cards {
+		names[i] = cards[i].Name
+	}
+
+	return names
+}
+
 // -----------------------------------------------------------------------------
 
 func TestNewCardGroupings(t *testing.T) {
@@ -37,7 +60,7 @@ func TestNewCardGroupings(t *testing.T) {
 		},
 	}
 
-	groupings := NewCardGroups(cards)
+	groupings := NewCardGroups(cards, DefaultGrouping())
 
 	assert.Equal(t, len(groupings), 2)
 	assert.Equal(t, groupings[0].Year, 2019)
@@ -45,3 +68,292 @@ func TestNewCardGroupings(t *testing.T) {
 	assert.Equal(t, groupings[1].Year, 2018)
 	assert.Equal(t, len(groupings[1].Cards), 2)
 }
+
+func TestCardGroupModes(t *testing.T) {
+	label := func(name string) *trello.Label { return &trello.Label{Name: name} }
+
+	cards := []*Card{
+		&Card{Name: "a", TrelloCard: &trello.Card{
+			Due:    timeFromMonth("2020-07"),
+			Pos:    3,
+			Labels: []*trello.Label{label("Beach"), label("Family")},
+		}},
+		&Card{Name: "B", TrelloCard: &trello.Card{
+			Due:    timeFromMonth("2020-03"),
+			Pos:    1,
+			Labels: []*trello.Label{label("Family")},
+		}},
+		&Card{Name: "c", TrelloCard: &trello.Card{
+			DateLastActivity: timeFromMonth("2021-01"),
+			Pos:              2,
+		}},
+	}
+	cards[0].customFields = map[string]interface{}{"Location": "Skagen"}
+
+	t.Run("By month", func(t *testing.T) {
+		grouping := DefaultGrouping()
+		grouping.By = GroupByMonth
+
+		groups := NewCardGroups(cards, grouping)
+		assert.DeepEqual(t, groupNames(groups), []string{"January 2021", "July 2020", "March 2020"})
+		assert.Equal(t, groups[1].Key, "2020-07")
+		assert.Equal(t, groups[1].Year, 2020)
+		assert.Equal(t, groups[1].SortKey, "2020-07")
+		assert.Assert(t, grouping.GroupsDescending())
+	})
+
+	t.Run("Undated cards without last activity fallback", func(t *testing.T) {
+		grouping := DefaultGrouping()
+		grouping.LastActivityFallback = false
+
+		groups := NewCardGroups(cards, grouping)
+		assert.DeepEqual(t, groupNames(groups), []string{"2020", "Undated"})
+		assert.DeepEqual(t, cardNames(groups[0].Cards), []string{"a", "B"})
+		assert.DeepEqual(t, cardNames(groups[1].Cards), []string{"c"})
+	})
+
+	t.Run("Oldest first", func(t *testing.T) {
+		grouping := DefaultGrouping()
+		grouping.Sort = SortByDateAsc
+
+		groups := NewCardGroups(cards, grouping)
+		assert.DeepEqual(t, groupNames(groups), []string{"2020", "2021"})
+		assert.DeepEqual(t, cardNames(groups[0].Cards), []string{"B", "a"})
+		assert.Assert(t, !grouping.GroupsDescending())
+	})
+
+	t.Run("By label", func(t *testing.T) {
+		grouping := DefaultGrouping()
+		grouping.By = GroupByLabel
+		grouping.Sort = SortByName
+
+		groups := NewCardGroups(cards, grouping)
+		assert.DeepEqual(t, groupNames(groups), []string{"Beach", "Family", "Unlabeled"})
+		assert.Equal(t, groups[0].SortKey, "beach")
+		assert.Equal(t, groups[2].SortKey, "")
+		assert.DeepEqual(t, cardNames(groups[1].Cards), []string{"a", "B"})
+	})
+
+	t.Run("By custom field", func(t *testing.T) {
+		grouping := DefaultGrouping()
+		grouping.By = GroupByCustomField
+		grouping.Field = "Location"
+
+		groups := NewCardGroups(cards, grouping)
+		assert.DeepEqual(t, groupNames(groups), []string{"Skagen", "No Location"})
+		assert.DeepEqual(t, cardNames(groups[1].Cards), []string{"c", "B"})
+	})
+
+	t.Run("No grouping by position", func(t *testing.T) {
+		grouping := DefaultGrouping()
+		grouping.By = GroupByNone
+		grouping.Sort = SortByPosition
+
+		groups := NewCardGroups(cards, grouping)
+		assert.Equal(t, len(groups), 1)
+		assert.Equal(t, groups[0].Name, "")
+		assert.DeepEqual(t, cardNames(groups[0].Cards), []string{"B", "c", "a"})
+	})
+}
+
+func TestGroupingValidate(t *testing.T) {
+	assert.NilError(t, DefaultGrouping().Validate())
+
+	grouping := DefaultGrouping()
+	grouping.By = "week"
+	assert.Error(t, grouping.Validate(), "Unknown grouping: week")
+
+	grouping = DefaultGrouping()
+	grouping.By = GroupByCustomField
+	assert.Error(t, grouping.Validate(), "Custom field to group by is missing")
+
+	grouping = DefaultGrouping()
+	grouping.Sort = "random"
+	assert.Error(t, grouping.Validate(), "Unknown sort order: random")
+}
+
+func TestGroupingUsesCustomFields(t *testing.T) {
+	assert.Assert(t, DefaultGrouping().UsesCustomFields())
+	assert.Assert(t, Grouping{By: GroupByCustomField, Field: "Season", Sort: SortByName}.UsesCustomFields())
+	assert.Assert(t, Grouping{By: GroupByNone, Sort: SortByDateAsc}.UsesCustomFields())
+	assert.Assert(t, !Grouping{By: GroupByLabel, Sort: SortByName}.UsesCustomFields())
+	assert.Assert(t, !Grouping{By: GroupByNone, Sort: SortByPosition}.UsesCustomFields())
+}
+
+func TestGroupingCardSortKey(t *testing.T) {
+	cards := []*Card{
+		&Card{Name: "b", TrelloCard: &trello.Card{Due: timeFromMonth("2020-07"), Pos: 12}},
+		&Card{Name: "C", TrelloCard: &trello.Card{Due: timeFromMonth("2020-03"), Pos: 3.5}},
+		&Card{Name: "a", TrelloCard: &trello.Card{DateLastActivity: timeFromMonth("2021-01"), Pos: 100}},
+	}
+
+	// Ordering by the keys, in the direction of the grouping, orders the cards
+	// the same as in their groups
+	for _, sort := range SortOrders {
+		grouping := Grouping{By: GroupByNone, Sort: sort}
+
+		t.Run(sort, func(t *testing.T) {
+			groups := NewCardGroups(cards, grouping)
+
+			for i := 1; i < len(groups[0].Cards); i++ {
+				previous := grouping.CardSortKey(groups[0].Cards[i-1])
+				key := grouping.CardSortKey(groups[0].Cards[i])
+
+				if key == "" {
+					continue
+				}
+
+				assert.Assert(t, previous != "", "Undated cards come last")
+
+				if grouping.CardsDescending() {
+					assert.Assert(t, previous >= key)
+				} else {
+					assert.Assert(t, previous <= key)
+				}
+			}
+		})
+	}
+
+	t.Run("Undated cards have no key", func(t *testing.T) {
+		grouping := DefaultGrouping()
+		grouping.LastActivityFallback = false
+
+		assert.Equal(t, grouping.CardSortKey(cards[0]), "2020-07-01T00:00:00.000000000")
+		assert.Equal(t, grouping.CardSortKey(cards[2]), "")
+	})
+}
+
+// Merges the groups of a following page into groups, the way lists.js does,
+// by nothing but the keys the groups and cards are rendered with.
+func mergePage(grouping Grouping, groups, page []CardGroup) []CardGroup {
+	before := func(a, b CardGroup) bool {
+		if a.Key == otherGroupKey || b.Key == otherGroupKey {
+			return b.Key == otherGroupKey && a.Key != otherGroupKey
+		}
+
+		if grouping.GroupsDescending() {
+			return a.SortKey > b.SortKey
+		}
+
+		return a.SortKey < b.SortKey
+	}
+
+	cardBefore := func(a, b *Card) bool {
+		keyA, keyB := grouping.CardSortKey(a), grouping.CardSortKey(b)
+		if keyA == "" || keyB == "" {
+			return keyA != "" && keyB == ""
+		}
+
+		if grouping.CardsDescending() {
+			return keyA > keyB
+		}
+
+		return keyA < keyB
+	}
+
+	for _, group := range page {
+		existing, next := -1, len(groups)
+
+		for i := range groups {
+			if groups[i].Key == group.Key {
+				existing = i
+			}
+			if next == len(groups) && before(group, groups[i]) {
+				next = i
+			}
+		}
+
+		if existing < 0 {
+			groups = append(groups[:next], append([]CardGroup{group}, groups[next:]...)...)
+			continue
+		}
+
+		for _, card := range group.Cards {
+			cards := groups[existing].Cards
+			nextCard := len(cards)
+
+			for i := range cards {
+				if cardBefore(card, cards[i]) {
+					nextCard = i
+					break
+				}
+			}
+
+			groups[existing].Cards = append(cards[:nextCard], append([]*Card{card}, cards[nextCard:]...)...)
+		}
+	}
+
+	return groups
+}
+
+func TestCardGroupsOfPages(t *testing.T) {
+	label := func(name string) *trello.Label { return &trello.Label{Name: name} }
+
+	// In the order of the list, which pages follow
+	cards := []*Card{
+		&Card{Name: "d", TrelloCard: &trello.Card{
+			Due:    timeFromMonth("2019-05"),
+			Pos:    1,
+			Labels: []*trello.Label{label("Family")},
+		}},
+		&Card{Name: "a", TrelloCard: &trello.Card{
+			Due:    timeFromMonth("2020-07"),
+			Pos:    2,
+			Labels: []*trello.Label{label("Beach"), label("Family")},
+		}},
+		&Card{Name: "e", TrelloCard: &trello.Card{Pos: 3}},
+		&Card{Name: "B", TrelloCard: &trello.Card{
+			Due:    timeFromMonth("2020-03"),
+			Pos:    4,
+			Labels: []*trello.Label{label("Family")},
+		}},
+		&Card{Name: "c", TrelloCard: &trello.Card{
+			DateLastActivity: timeFromMonth("2021-01"),
+			Pos:              5,
+		}},
+		&Card{Name: "f", TrelloCard: &trello.Card{
+			Due:    timeFromMonth("2020-07"),
+			Pos:    6,
+			Labels: []*trello.Label{label("Beach")},
+		}},
+	}
+	cards[0].customFields = map[string]interface{}{"Location": "Skagen"}
+	cards[1].customFields = map[string]interface{}{"Location": "Aarhus"}
+	cards[3].customFields = map[string]interface{}{"Location": "Skagen"}
+
+	names := func(groups []CardGroup) []string {
+		names := []string{}
+		for _, group := range groups {
+			for _, card := range group.Cards {
+				names = append(names, group.Key+"/"+card.Name)
+			}
+		}
+
+		return names
+	}
+
+	// Groups are only made for a page at a time, so merging the groups of
+	// each page on the page must order them as if all cards were grouped
+	for _, by := range GroupModes {
+		for _, sort := range SortOrders {
+			grouping := Grouping{By: by, Field: "Location", Sort: sort, LastActivityFallback: true}
+
+			t.Run(by+" "+sort, func(t *testing.T) {
+				for size := 1; size < len(cards); size++ {
+					groups := NewCardGroups(cards[:size], grouping)
+
+					for start := size; start < len(cards); start += size {
+						end := start + size
+						if end > len(cards) {
+							end = len(cards)
+						}
+
+						groups = mergePage(grouping, groups, NewCardGroups(cards[start:end], grouping))
+					}
+
+					assert.DeepEqual(t, names(groups), names(NewCardGroups(cards, grouping)))
+				}
+			})
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"net/http"
 	"testing"
 
@@ -10,9 +11,23 @@ import (
 )
 
 func TestNewCard(t *testing.T) {
-	t.Run("Without attachment cover", func(t *testing.T) {
+	t.Run("Without images", func(t *testing.T) {
 		_, err := NewCard(&trello.Card{})
-		assert.ErrorContains(t, err, "No cover attachment")
+		assert.ErrorContains(t, err, "No image attachments")
+	})
+
+	t.Run("Without attachment cover", func(t *testing.T) {
+		card, err := NewCard(&trello.Card{
+			Attachments: []*trello.Attachment{
+				&trello.Attachment{ID: "41"},
+				&trello.Attachment{
+					ID:       "42",
+					Previews: []trello.AttachmentPreview{trello.AttachmentPreview{}},
+				},
+			},
+		})
+		assert.NilError(t, err)
+		assert.Equal(t, card.CoverImage.ID, "42")
 	})
 
 	t.Run("With attachment cover", func(t *testing.T) {
@@ -87,3 +102,40 @@ func TestGetImages(t *testing.T) {
 		assert.Equal(t, images[0].Name, "image.jpg")
 	})
 }
+
+func TestCardMarshalJSON(t *testing.T) {
+	card, err := NewCard(&trello.Card{
+		ID:   "1",
+		Name: "Foo",
+		Attachments: []*trello.Attachment{
+			&trello.Attachment{
+				ID: "42",
+				Previews: []trello.AttachmentPreview{
+					trello.AttachmentPreview{URL: "small", Width: 10, Height: 5},
+					trello.AttachmentPreview{URL: "large", Width: 20, Height: 10},
+					trello.AttachmentPreview{URL: "original", Width: 40, Height: 20},
+				},
+			},
+		},
+		IDAttachmentCover: "42",
+		List:              &trello.List{ID: "2"},
+	})
+	assert.NilError(t, err)
+
+	data, err := json.Marshal(card)
+	assert.NilError(t, err)
+
+	var actual map[string]interface{}
+	assert.NilError(t, json.Unmarshal(data, &actual))
+
+	assert.Equal(t, actual["id"], "1")
+	assert.Equal(t, actual["name"], "Foo")
+	assert.Equal(t, actual["listId"], "2")
+
+	coverImage := actual["coverImage"].(map[string]interface{})
+	assert.Equal(t, coverImage["id"], "42")
+	assert.Equal(t, coverImage["cardId"], "1")
+	assert.Equal(t, coverImage["url"], "large")
+	assert.Equal(t, coverImage["width"], float64(20))
+	assert.Equal(t, len(coverImage["previews"].([]interface{})), 2)
+}
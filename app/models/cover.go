@@ -0,0 +1,317 @@
+package models
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"gallo/lib"
+	"image"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/adlio/trello"
+)
+
+// Policies for choosing the cover image of a card, which doesn't have a cover
+// attachment set in Trello. A cover set in Trello is always used.
+const (
+	// Cards without a cover set in Trello are left out
+	ExplicitCoverPolicy = "explicit"
+	// The first image attached to the card is used
+	FirstImageCoverPolicy = "first-image"
+	// The image attached to the card with the most pixels is used
+	LargestImageCoverPolicy = "largest-image"
+	// A collage of the first four images attached to the card is used
+	CollageCoverPolicy = "collage"
+)
+
+// CoverPolicies are the names of all cover policies
+var CoverPolicies = []string{
+	ExplicitCoverPolicy,
+	FirstImageCoverPolicy,
+	LargestImageCoverPolicy,
+	CollageCoverPolicy,
+}
+
+// CoverPolicy is the policy used for choosing the covers of new cards.
+var CoverPolicy = FirstImageCoverPolicy
+
+// ValidateCoverPolicy returns an error if name isn't one of CoverPolicies.
+func ValidateCoverPolicy(name string) error {
+	if !containsString(CoverPolicies, name) {
+		return errors.New(fmt.Sprintf("Unknown cover policy: %s", name))
+	}
+
+	return nil
+}
+
+// noCoverError is returned when no cover can be chosen for a card.
+type noCoverError struct {
+	message string
+}
+
+func (e noCoverError) Error() string {
+	return e.message
+}
+
+// Tells whether err is returned because no cover can be chosen for a card.
+func isNoCoverError(err error) bool {
+	_, ok := err.(noCoverError)
+	return ok
+}
+
+// Chooses the cover image of a card with policy. A noCoverError is returned if
+// the policy doesn't give a cover, which happens when the card has no images at
+// all, or no cover set in Trello for ExplicitCoverPolicy.
+func chooseCover(trelloCard *trello.Card, policy string) (Image, error) {
+	for _, attachment := range trelloCard.Attachments {
+		if attachment.ID == trelloCard.IDAttachmentCover {
+			return newCardImage(trelloCard.ID, attachment), nil
+		}
+	}
+
+	if policy == ExplicitCoverPolicy {
+		return Image{}, noCoverError{fmt.Sprintf(
+			"No cover attachment for card (%s, %s)",
+			trelloCard.ID,
+			trelloCard.Name,
+		)}
+	}
+
+	images := cardImages(trelloCard)
+
+	if len(images) == 0 {
+		return Image{}, noCoverError{fmt.Sprintf(
+			"No image attachments for card (%s, %s)",
+			trelloCard.ID,
+			trelloCard.Name,
+		)}
+	}
+
+	switch policy {
+	case LargestImageCoverPolicy:
+		largest := images[0]
+
+		for _, candidate := range images[1:] {
+			width, height := candidate.originalSize()
+			largestWidth, largestHeight := largest.originalSize()
+
+			if width*height > largestWidth*largestHeight {
+				largest = candidate
+			}
+		}
+
+		return largest, nil
+	case CollageCoverPolicy:
+		if len(images) > 1 {
+			return newCollage(trelloCard.ID, images), nil
+		}
+	}
+
+	return images[0], nil
+}
+
+// Whether a cover can be chosen for the card with CoverPolicy. Bare cards,
+// without attachments sideloaded, are judged by their number of attachments,
+// which might include other files than images, so NewCard can still fail with
+// a noCoverError for them.
+func hasCover(trelloCard *trello.Card) bool {
+	if trelloCard.IDAttachmentCover != "" {
+		return true
+	}
+
+	if CoverPolicy == ExplicitCoverPolicy {
+		return false
+	}
+
+	if trelloCard.Attachments == nil {
+		return trelloCard.Badges.Attachments > 0
+	}
+
+	return len(cardImages(trelloCard)) > 0
+}
+
+// Returns the attachments of a card which are images, in the order they were
+// attached.
+func cardImages(trelloCard *trello.Card) []Image {
+	images := make([]Image, 0)
+
+	for _, attachment := range trelloCard.Attachments {
+		// MimeType can sometimes be null, if not guard by image MimeType. Videos
+		// can have previews as well, but are shown as such.
+		if len(attachment.Previews) > 0 && !isVideoAttachment(attachment) {
+			images = append(images, newCardImage(trelloCard.ID, attachment))
+		}
+	}
+
+	return images
+}
+
+func newCardImage(cardID string, attachment *trello.Attachment) Image {
+	image := NewImage(attachment)
+	image.CardID = cardID
+
+	return image
+}
+
+// UseCollageCovers gives cards with more than one image a collage cover, if
+// collages are turned on for list in the settings in ctx. This takes precedence
+// over covers set in Trello.
+func UseCollageCovers(ctx context.Context, list *List, cards []*Card) {
+	if !SettingsFromContext(ctx).Collages(list.ID()) {
+		return
+	}
+
+	for i := range cards {
+		images := cards[i].GetImages()
+
+		if len(images) > 1 {
+			cards[i].CoverImage = newCollage(cards[i].ID(), images)
+		}
+	}
+}
+
+// Creates a square collage cover of up to lib.MaxCollageImages of images. The
+// collage is rendered by gallo in each of CollageWidths, and takes the edge
+// color of the first image.
+func newCollage(cardID string, images []Image) Image {
+	if len(images) > lib.MaxCollageImages {
+		images = images[:lib.MaxCollageImages]
+	}
+
+	version := CollageVersion(images)
+	widths := CollageWidths(images)
+	previews := make([]trello.AttachmentPreview, len(widths))
+
+	for i, width := range widths {
+		previews[i] = trello.AttachmentPreview{
+			ID:     fmt.Sprintf("collage-%s-%s-%d", cardID, version, width),
+			URL:    CollageURL(cardID, version, width),
+			Width:  width,
+			Height: width,
+			Scaled: true,
+		}
+	}
+
+	return Image{
+		Attachment: &trello.Attachment{
+			ID:        fmt.Sprintf("collage-%s-%s", cardID, version),
+			Name:      "Collage",
+			EdgeColor: images[0].EdgeColor,
+			Previews:  previews,
+		},
+		CardID: cardID,
+		Parts:  images,
+	}
+}
+
+// CollageVersion identifies the images composed into a collage. It changes
+// whenever an image is attached to or removed from the first ones of a card, so
+// anything rendered from a previous set of images is left behind.
+func CollageVersion(images []Image) string {
+	if len(images) > lib.MaxCollageImages {
+		images = images[:lib.MaxCollageImages]
+	}
+
+	ids := make([]string, len(images))
+	for i := range images {
+		ids[i] = images[i].ID
+	}
+
+	sum := sha1.Sum([]byte(strings.Join(ids, ",")))
+
+	return hex.EncodeToString(sum[:4])
+}
+
+// CollageWidths are the widths of PreviewWidths a collage of images is rendered
+// in. Widths more than twice the shortest side of any of the images are left
+// out, apart from the first one, since the images would mostly be scaled up.
+func CollageWidths(images []Image) []int {
+	smallest := 0
+
+	for i := range images {
+		width, height := images[i].originalSize()
+		if height < width {
+			width = height
+		}
+
+		if i == 0 || width < smallest {
+			smallest = width
+		}
+	}
+
+	widths := make([]int, 0, len(PreviewWidths))
+
+	for i, width := range PreviewWidths {
+		if i == 0 || width/2 <= smallest {
+			widths = append(widths, width)
+		}
+	}
+
+	return widths
+}
+
+// IsCollageWidth tells whether width is one of CollageWidths for images.
+func IsCollageWidth(images []Image, width int) bool {
+	for _, w := range CollageWidths(images) {
+		if w == width {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CollageURL is the url of a version of the collage cover of a card in the
+// given width. The version is only there to tell browsers apart from previous
+// collages of the card.
+func CollageURL(cardID, version string, width int) string {
+	u := url.URL{
+		Path:     path.Join("/collages", cardID, strconv.Itoa(width)),
+		RawQuery: url.Values{"v": []string{version}}.Encode(),
+	}
+
+	return u.String()
+}
+
+// RenderCollage composes up to lib.MaxCollageImages of images into a square
+// collage of the given width. Each image is drawn from a preview, fetched from
+// the source in ctx, which is just large enough for its part of the collage.
+func RenderCollage(ctx context.Context, images []Image, width int) (image.Image, error) {
+	if len(images) > lib.MaxCollageImages {
+		images = images[:lib.MaxCollageImages]
+	}
+
+	cells := lib.CollageCells(len(images), width)
+	parts := make([]image.Image, len(cells))
+
+	for i, cell := range cells {
+		previewWidth := cell.Dx()
+		if cell.Dy() > previewWidth {
+			previewWidth = cell.Dy()
+		}
+
+		preview, err := OpenPreview(ctx, images[i].CardID, images[i].ID, previewWidth)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := ioutil.ReadAll(preview)
+		preview.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		parts[i], _, err = lib.DecodeImage(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return lib.Collage(parts, width), nil
+}
@@ -0,0 +1,192 @@
+package models
+
+import (
+	"context"
+	"testing"
+
+	"github.com/adlio/trello"
+	"gotest.tools/assert"
+)
+
+// A card with three image attachments of increasing size, none of which is set
+// as cover, and a text file.
+func createCoverTestCard() *trello.Card {
+	newAttachment := func(id string, width, height int) *trello.Attachment {
+		return &trello.Attachment{
+			ID:        id,
+			EdgeColor: "#" + id,
+			Previews: []trello.AttachmentPreview{
+				trello.AttachmentPreview{Width: width, Height: height},
+			},
+		}
+	}
+
+	return &trello.Card{
+		ID:   "34",
+		Name: "Foo",
+		Attachments: []*trello.Attachment{
+			&trello.Attachment{ID: "notes"},
+			newAttachment("a", 100, 100),
+			newAttachment("b", 200, 100),
+			newAttachment("c", 150, 150),
+		},
+	}
+}
+
+// -----------------------------------------------------------------------------
+
+func TestValidateCoverPolicy(t *testing.T) {
+	for _, name := range CoverPolicies {
+		assert.NilError(t, ValidateCoverPolicy(name))
+	}
+
+	assert.Error(t, ValidateCoverPolicy("foo"), "Unknown cover policy: foo")
+}
+
+func Test_chooseCover(t *testing.T) {
+	t.Run("Explicit cover is always used", func(t *testing.T) {
+		trelloCard := createCoverTestCard()
+		trelloCard.IDAttachmentCover = "c"
+
+		for _, policy := range CoverPolicies {
+			cover, err := chooseCover(trelloCard, policy)
+			assert.NilError(t, err)
+			assert.Equal(t, cover.ID, "c")
+			assert.Equal(t, cover.CardID, "34")
+		}
+	})
+
+	t.Run("Explicit", func(t *testing.T) {
+		_, err := chooseCover(createCoverTestCard(), ExplicitCoverPolicy)
+		assert.Error(t, err, "No cover attachment for card (34, Foo)")
+	})
+
+	t.Run("First image", func(t *testing.T) {
+		cover, err := chooseCover(createCoverTestCard(), FirstImageCoverPolicy)
+		assert.NilError(t, err)
+		assert.Equal(t, cover.ID, "a")
+	})
+
+	t.Run("Largest image", func(t *testing.T) {
+		cover, err := chooseCover(createCoverTestCard(), LargestImageCoverPolicy)
+		assert.NilError(t, err)
+		assert.Equal(t, cover.ID, "c")
+	})
+
+	t.Run("Collage", func(t *testing.T) {
+		cover, err := chooseCover(createCoverTestCard(), CollageCoverPolicy)
+		assert.NilError(t, err)
+		assert.Assert(t, cover.IsCollage())
+		assert.Equal(t, len(cover.Parts), 3)
+		assert.Equal(t, cover.EdgeColor, "#a")
+
+		previews := cover.GetPreviews()
+		assert.Equal(t, len(previews), 1)
+		assert.Equal(t, previews[0].URL, "/collages/34/150?v="+CollageVersion(cover.Parts))
+		assert.Equal(t, previews[0].Height, previews[0].Width)
+	})
+
+	t.Run("Collage of a single image", func(t *testing.T) {
+		trelloCard := createCoverTestCard()
+		trelloCard.Attachments = trelloCard.Attachments[:2]
+
+		cover, err := chooseCover(trelloCard, CollageCoverPolicy)
+		assert.NilError(t, err)
+		assert.Assert(t, !cover.IsCollage())
+		assert.Equal(t, cover.ID, "a")
+	})
+
+	t.Run("Without images", func(t *testing.T) {
+		trelloCard := createCoverTestCard()
+		trelloCard.Attachments = trelloCard.Attachments[:1]
+
+		_, err := chooseCover(trelloCard, FirstImageCoverPolicy)
+		assert.Error(t, err, "No image attachments for card (34, Foo)")
+	})
+}
+
+func Test_hasCover(t *testing.T) {
+	defer func(policy string) { CoverPolicy = policy }(CoverPolicy)
+
+	bare := &trello.Card{}
+	bare.Badges.Attachments = 2
+
+	CoverPolicy = FirstImageCoverPolicy
+	assert.Assert(t, hasCover(createCoverTestCard()))
+	assert.Assert(t, hasCover(bare))
+	assert.Assert(t, !hasCover(&trello.Card{}))
+	assert.Assert(t, !hasCover(&trello.Card{
+		Attachments: []*trello.Attachment{&trello.Attachment{ID: "notes"}},
+	}))
+
+	CoverPolicy = ExplicitCoverPolicy
+	assert.Assert(t, !hasCover(createCoverTestCard()))
+	assert.Assert(t, !hasCover(bare))
+	assert.Assert(t, hasCover(&trello.Card{IDAttachmentCover: "a"}))
+}
+
+func TestCollageVersion(t *testing.T) {
+	images := cardImages(createCoverTestCard())
+
+	version := CollageVersion(images)
+	assert.Equal(t, len(version), 8)
+	assert.Equal(t, CollageVersion(images), version)
+
+	// Only the first images are part of a collage
+	more := append(images, images[0], images[1])
+	assert.Equal(t, CollageVersion(more), CollageVersion(more[:4]))
+
+	assert.Assert(t, CollageVersion(images[:2]) != version)
+	assert.Assert(t, CollageVersion([]Image{images[1], images[0], images[2]}) != version)
+}
+
+func TestCollageWidths(t *testing.T) {
+	newImage := func(width, height int) Image {
+		return NewImage(&trello.Attachment{
+			Previews: []trello.AttachmentPreview{
+				trello.AttachmentPreview{Width: width, Height: height},
+			},
+		})
+	}
+
+	assert.DeepEqual(t, CollageWidths([]Image{newImage(100, 100)}), []int{150})
+	assert.DeepEqual(
+		t,
+		CollageWidths([]Image{newImage(4000, 3000), newImage(400, 300)}),
+		[]int{150, 300, 600},
+	)
+	assert.DeepEqual(t, CollageWidths([]Image{newImage(4000, 3000)}), PreviewWidths)
+
+	assert.Assert(t, IsCollageWidth([]Image{newImage(400, 300)}, 600))
+	assert.Assert(t, !IsCollageWidth([]Image{newImage(400, 300)}, 1200))
+	assert.Assert(t, !IsCollageWidth([]Image{newImage(400, 300)}, 500))
+}
+
+func TestUseCollageCovers(t *testing.T) {
+	trelloCard := createCoverTestCard()
+	trelloCard.IDAttachmentCover = "c"
+
+	card, err := NewCard(trelloCard)
+	assert.NilError(t, err)
+
+	single, err := NewCard(&trello.Card{
+		ID:          "35",
+		Attachments: trelloCard.Attachments[:2],
+	})
+	assert.NilError(t, err)
+
+	list := &List{TrelloList: &trello.List{ID: "123"}}
+	cards := []*Card{card, single}
+
+	UseCollageCovers(context.Background(), list, cards)
+	assert.Equal(t, cards[0].CoverImage.ID, "c")
+
+	settings := DefaultSettings()
+	settings.SetCollages("123", true)
+	ctx := NewSettingsContext(context.Background(), settings)
+
+	UseCollageCovers(ctx, list, cards)
+	assert.Assert(t, cards[0].CoverImage.IsCollage())
+	assert.Equal(t, len(cards[0].CoverImage.Parts), 3)
+	assert.Equal(t, cards[1].CoverImage.ID, "a")
+}
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gallo/lib"
+	"strconv"
+	"time"
+)
+
+// LoadCustomFields loads the values of the custom fields of cards on list, from
+// the source in ctx, along with their photos as told by the photo fields of the
+// board in the settings in ctx. They aren't loaded along with the cards, since
+// they take separate requests, so only the cards shown should be given.
+func LoadCustomFields(ctx context.Context, list *List, cards []*Card) error {
+	defer lib.Track(lib.RunningTime("LoadCustomFields"))
+
+	if len(cards) == 0 {
+		return nil
+	}
+
+	if list.TrelloList == nil {
+		return errors.New("TrelloList is nil")
+	}
+
+	source, err := sourceFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	ids := make([]string, len(cards))
+	for i := range cards {
+		ids[i] = cards[i].ID()
+	}
+
+	values, err := source.GetCustomFields(list.TrelloList.IDBoard, ids)
+	if err != nil {
+		return err
+	}
+
+	fields := SettingsFromContext(ctx).PhotoFieldsOf(list.TrelloList.IDBoard)
+
+	for i := range cards {
+		cards[i].customFields = values[cards[i].ID()]
+		cards[i].photo = fields.photo(cards[i].customFields)
+	}
+
+	return nil
+}
+
+// CustomField returns the value of the custom field of the card with the given
+// name as text, or an empty string if it has no value or custom fields haven't
+// been loaded.
+func (c Card) CustomField(name string) string {
+	value, ok := c.customFields[name]
+	if !ok {
+		return ""
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v
+	case time.Time:
+		return v.Format("2006-01-02")
+	case bool:
+		if v {
+			return "Yes"
+		}
+
+		return "No"
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/adlio/trello"
+	"github.com/jarcoal/httpmock"
+	"gotest.tools/assert"
+)
+
+func TestCardCustomField(t *testing.T) {
+	card := Card{TrelloCard: &trello.Card{}}
+	assert.Equal(t, card.CustomField("Location"), "")
+
+	card.customFields = map[string]interface{}{
+		"Location": "Skagen",
+		"Taken":    time.Date(2020, time.July, 2, 10, 0, 0, 0, time.UTC),
+		"Framed":   true,
+		"Rating":   4,
+		"Price":    2.5,
+	}
+
+	assert.Equal(t, card.CustomField("Location"), "Skagen")
+	assert.Equal(t, card.CustomField("Taken"), "2020-07-02")
+	assert.Equal(t, card.CustomField("Framed"), "Yes")
+	assert.Equal(t, card.CustomField("Rating"), "4")
+	assert.Equal(t, card.CustomField("Price"), "2.5")
+}
+
+func TestLoadCustomFields(t *testing.T) {
+	httpmock.RegisterResponder(
+		"GET",
+		"https://api.trello.com/1/boards/123/customFields?",
+		httpmock.NewStringResponder(http.StatusOK, `[
+			{"id": "f1", "name": "Location", "type": "text"},
+			{
+				"id": "f2",
+				"name": "Season",
+				"type": "list",
+				"options": [{"id": "o1", "idCustomField": "f2", "value": {"text": "Summer"}}]
+			}
+		]`),
+	)
+	httpmock.RegisterResponder(
+		"GET",
+		"https://api.trello.com/1/batch?urls=%2Fcards%2F34%2FcustomFieldItems%2C%2Fcards%2F35%2FcustomFieldItems",
+		httpmock.NewStringResponder(http.StatusOK, `[
+			{
+				"200": [
+					{"idCustomField": "f1", "value": {"text": "Skagen"}},
+					{"idCustomField": "f2", "idValue": "o1"}
+				]
+			},
+			{"200": []}
+		]`),
+	)
+	defer httpmock.Reset()
+
+	list := &List{TrelloList: &trello.List{ID: "234", IDBoard: "123"}}
+	cards := []*Card{
+		&Card{TrelloCard: &trello.Card{ID: "34"}},
+		&Card{TrelloCard: &trello.Card{ID: "35"}},
+	}
+
+	err := LoadCustomFields(defaultContext, list, cards)
+	assert.NilError(t, err)
+
+	assert.Equal(t, cards[0].CustomField("Location"), "Skagen")
+	assert.Equal(t, cards[0].CustomField("Season"), "Summer")
+	assert.Equal(t, cards[1].CustomField("Location"), "")
+
+	t.Run("Photos are told by the photo fields", func(t *testing.T) {
+		assert.Equal(t, cards[0].Photo().Location, "Skagen")
+		assert.Equal(t, cards[1].Photo().Location, "")
+	})
+}
@@ -0,0 +1,643 @@
+package models
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"gallo/lib"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/adlio/trello"
+)
+
+// FilesystemSource is a Source backed by a directory tree on the local
+// filesystem. Top level directories are boards and their sub-directories are
+// lists. Inside a list, each directory containing images is a card, as is each
+// single image placed directly in the list directory.
+//
+// IDs are the slash separated paths relative to the root, encoded as base64,
+// so they can be used as is in urls.
+type FilesystemSource struct {
+	root string
+}
+
+// There's only the one user of a directory tree, who has this ID
+const filesystemMemberID = "filesystem"
+
+// The default Trello board background, used since directories have none.
+const filesystemBoardColor = "#0079bf"
+
+// Depth of the relative paths for each type of model
+const (
+	boardDepth = 1
+	listDepth  = 2
+	cardDepth  = 3
+)
+
+func NewFilesystemSource(root string) *FilesystemSource {
+	return &FilesystemSource{root}
+}
+
+func (s *FilesystemSource) GetMemberID() (string, error) {
+	return filesystemMemberID, nil
+}
+
+func (s *FilesystemSource) GetBoards() ([]*Board, error) {
+	infos, err := s.readDir("")
+	if err != nil {
+		return nil, err
+	}
+
+	boards := make([]*Board, 0)
+
+	for _, info := range infos {
+		if !info.IsDir() {
+			continue
+		}
+
+		board, err := s.newBoard(info.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		boards = append(boards, board)
+	}
+
+	return boards, nil
+}
+
+func (s *FilesystemSource) GetBoard(id string) (*Board, error) {
+	rel, err := s.decodeID(id, boardDepth)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.newBoard(rel)
+}
+
+func (s *FilesystemSource) GetList(id string) (*List, error) {
+	rel, err := s.decodeID(id, listDepth)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(s.abs(rel))
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return nil, errors.New(fmt.Sprintf("Not a list: %s", rel))
+	}
+
+	list, err := NewList(newFilesystemList(rel))
+	if err != nil {
+		return nil, err
+	}
+
+	list.setSource(s)
+
+	return list, nil
+}
+
+func (s *FilesystemSource) GetCard(id string) (*Card, error) {
+	rel, err := s.decodeID(id, cardDepth)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(s.abs(rel))
+	if err != nil {
+		return nil, err
+	}
+
+	trelloCard, err := s.newTrelloCard(rel, info, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if trelloCard == nil {
+		return nil, errors.New(fmt.Sprintf("No images for card: %s", rel))
+	}
+
+	trelloCard.List = newFilesystemList(path.Dir(rel))
+
+	card, err := NewCard(trelloCard)
+	if err != nil {
+		return nil, err
+	}
+
+	card.setSource(s)
+
+	return card, nil
+}
+
+func (s *FilesystemSource) GetBoardLists(board *Board) ([]*List, error) {
+	rel, err := s.decodeID(board.ID(), boardDepth)
+	if err != nil {
+		return nil, err
+	}
+
+	trelloLists, err := s.trelloLists(rel)
+	if err != nil {
+		return nil, err
+	}
+
+	lists := make([]*List, 0)
+
+	for i := range trelloLists {
+		list, err := NewList(trelloLists[i])
+		if err != nil {
+			return nil, err
+		}
+
+		list.setSource(s)
+
+		lists = append(lists, list)
+	}
+
+	return lists, nil
+}
+
+func (s *FilesystemSource) GetBoardCards(board *Board) ([]*Card, error) {
+	lists, err := s.GetBoardLists(board)
+	if err != nil {
+		return nil, err
+	}
+
+	cards := make([]*Card, 0)
+
+	for i := range lists {
+		listCards, err := s.GetListCards(lists[i])
+		if err != nil {
+			return nil, err
+		}
+
+		cards = append(cards, listCards...)
+	}
+
+	return cards, nil
+}
+
+func (s *FilesystemSource) GetListCards(list *List) ([]*Card, error) {
+	if list.TrelloList == nil {
+		return nil, errors.New("TrelloList is nil")
+	}
+
+	rel, err := s.decodeID(list.ID(), listDepth)
+	if err != nil {
+		return nil, err
+	}
+
+	trelloCards, err := s.trelloCards(rel, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return newListCards(s, list, trelloCards)
+}
+
+// GetListCardsPage pages through the cards on a list in the order they are
+// listed in its directory.
+func (s *FilesystemSource) GetListCardsPage(list *List, before string, limit int) ([]*Card, string, error) {
+	if list.TrelloList == nil {
+		return nil, "", errors.New("TrelloList is nil")
+	}
+
+	rel, err := s.decodeID(list.ID(), listDepth)
+	if err != nil {
+		return nil, "", err
+	}
+
+	trelloCards, err := s.trelloCards(rel, true)
+	if err != nil {
+		return nil, "", err
+	}
+
+	start := 0
+
+	if before != "" {
+		start = -1
+
+		for i := range trelloCards {
+			if trelloCards[i].ID == before {
+				start = i + 1
+				break
+			}
+		}
+
+		if start == -1 {
+			return nil, "", errors.New(fmt.Sprintf("Unknown card in %s: %s", rel, before))
+		}
+	}
+
+	end := start + limit
+	next := ""
+
+	if end < len(trelloCards) {
+		next = trelloCards[end-1].ID
+	} else {
+		end = len(trelloCards)
+	}
+
+	cards, err := newListCards(s, list, trelloCards[start:end])
+	if err != nil {
+		return nil, "", err
+	}
+
+	return cards, next, nil
+}
+
+func (s *FilesystemSource) GetBoardsCards(boards []*Board) ([]*trello.Card, error) {
+	trelloCards := make([]*trello.Card, 0)
+
+	for i := range boards {
+		boardRel, err := s.decodeID(boards[i].ID(), boardDepth)
+		if err != nil {
+			return nil, err
+		}
+
+		trelloLists, err := s.trelloLists(boardRel)
+		if err != nil {
+			return nil, err
+		}
+
+		for j := range trelloLists {
+			listRel, err := s.decodeID(trelloLists[j].ID, listDepth)
+			if err != nil {
+				return nil, err
+			}
+
+			cards, err := s.trelloCards(listRel, false)
+			if err != nil {
+				return nil, err
+			}
+
+			trelloCards = append(trelloCards, cards...)
+		}
+	}
+
+	return trelloCards, nil
+}
+
+// GetCustomFields returns no values, since there are no custom fields.
+func (s *FilesystemSource) GetCustomFields(boardID string, cardIDs []string) (map[string]map[string]interface{}, error) {
+	return map[string]map[string]interface{}{}, nil
+}
+
+// GetCardComments returns no comments, since there's nowhere to write them.
+func (s *FilesystemSource) GetCardComments(cardID string, limit int) ([]*trello.Action, error) {
+	return []*trello.Action{}, nil
+}
+
+// GetAttachment returns the image identified by the attachment id, if it's in
+// the directory of the card, or is the card itself, when it's a single image
+// placed directly in a list directory.
+func (s *FilesystemSource) GetAttachment(cardID, id string) (*trello.Attachment, error) {
+	rel, err := s.decodeID(id, 0)
+	if err != nil || !isImageFile(rel) {
+		return nil, ErrNotFound
+	}
+
+	onCard := encodeFilesystemID(path.Dir(rel)) == cardID || encodeFilesystemID(rel) == cardID
+	if cardID != "" && !onCard {
+		return nil, ErrNotFound
+	}
+
+	return s.newAttachment(rel)
+}
+
+func (s *FilesystemSource) OpenAttachment(cardID, id string) (io.ReadCloser, error) {
+	filePath, err := s.FilePath(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.Open(filePath)
+}
+
+// OpenPreview opens the smallest preview of the image, which is at least the
+// given width. Previews smaller than the original are resized from it, since
+// there are no smaller versions on disk.
+func (s *FilesystemSource) OpenPreview(cardID, id string, width int) (io.ReadCloser, error) {
+	attachment, err := s.GetAttachment(cardID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	previews := NewImage(attachment).trelloPreviews()
+
+	for i := range previews {
+		if previews[i].Width >= width && previews[i].Scaled {
+			return s.openResized(cardID, id, previews[i].Width)
+		}
+	}
+
+	return s.OpenAttachment(cardID, id)
+}
+
+// Opens the image resized to the given width.
+func (s *FilesystemSource) openResized(cardID, id string, width int) (io.ReadCloser, error) {
+	original, err := s.OpenAttachment(cardID, id)
+	if err != nil {
+		return nil, err
+	}
+	defer original.Close()
+
+	data, err := ioutil.ReadAll(original)
+	if err != nil {
+		return nil, err
+	}
+
+	img, format, err := lib.DecodeImage(data)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+
+	err = lib.EncodeImage(buf, lib.Resize(img, width), format)
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.NopCloser(buf), nil
+}
+
+// FilePath returns the absolute path of the image identified by the
+// attachment id.
+func (s *FilesystemSource) FilePath(id string) (string, error) {
+	rel, err := s.decodeID(id, 0)
+	if err != nil {
+		return "", err
+	}
+
+	if !isImageFile(rel) {
+		return "", errors.New(fmt.Sprintf("Not an image: %s", rel))
+	}
+
+	return s.abs(rel), nil
+}
+
+func (s *FilesystemSource) abs(rel string) string {
+	return filepath.Join(s.root, filepath.FromSlash(rel))
+}
+
+// Entries of a directory, relative to the root, sorted by name. Hidden files
+// are left out.
+func (s *FilesystemSource) readDir(rel string) ([]os.FileInfo, error) {
+	infos, err := ioutil.ReadDir(s.abs(rel))
+	if err != nil {
+		return nil, err
+	}
+
+	visible := make([]os.FileInfo, 0, len(infos))
+
+	for _, info := range infos {
+		if !strings.HasPrefix(info.Name(), ".") {
+			visible = append(visible, info)
+		}
+	}
+
+	return visible, nil
+}
+
+// Decodes an id into a path relative to the root. The path is cleaned, so
+// it can't point outside of the root, and it has to have the given number of
+// elements, unless depth is zero.
+func (s *FilesystemSource) decodeID(id string, depth int) (string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(id)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("Invalid id: %s", id))
+	}
+
+	rel := strings.TrimPrefix(path.Clean("/"+string(b)), "/")
+
+	if rel == "" {
+		return "", errors.New(fmt.Sprintf("Invalid id: %s", id))
+	}
+
+	if depth > 0 && len(strings.Split(rel, "/")) != depth {
+		return "", errors.New(fmt.Sprintf("Invalid id: %s", id))
+	}
+
+	return rel, nil
+}
+
+func encodeFilesystemID(rel string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(rel))
+}
+
+func (s *FilesystemSource) newBoard(rel string) (*Board, error) {
+	info, err := os.Stat(s.abs(rel))
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return nil, errors.New(fmt.Sprintf("Not a board: %s", rel))
+	}
+
+	trelloLists, err := s.trelloLists(rel)
+	if err != nil {
+		return nil, err
+	}
+
+	trelloBoard := &trello.Board{
+		ID:   encodeFilesystemID(rel),
+		Name: info.Name(),
+		// Every directory is meant to be shown, so all of them are marked
+		Desc:  "gallo",
+		Lists: trelloLists,
+	}
+	trelloBoard.Prefs.BackgroundBrightness = "dark"
+	trelloBoard.Prefs.BackgroundColor = filesystemBoardColor
+
+	board, err := NewBoard(trelloBoard)
+	if err != nil {
+		return nil, err
+	}
+
+	board.setSource(s)
+
+	return board, nil
+}
+
+func newFilesystemList(rel string) *trello.List {
+	return &trello.List{
+		ID:      encodeFilesystemID(rel),
+		Name:    path.Base(rel),
+		IDBoard: encodeFilesystemID(path.Dir(rel)),
+		// There's no notion of watching a directory, so all lists are shown
+		Subscribed: true,
+	}
+}
+
+// Lists of the board at rel
+func (s *FilesystemSource) trelloLists(rel string) ([]*trello.List, error) {
+	infos, err := s.readDir(rel)
+	if err != nil {
+		return nil, err
+	}
+
+	trelloLists := make([]*trello.List, 0)
+
+	for _, info := range infos {
+		if info.IsDir() {
+			trelloLists = append(trelloLists, newFilesystemList(path.Join(rel, info.Name())))
+		}
+	}
+
+	return trelloLists, nil
+}
+
+// Cards of the list at rel. Decoding image dimensions requires reading the
+// files, so attachments are only added if asked for.
+func (s *FilesystemSource) trelloCards(rel string, attachments bool) ([]*trello.Card, error) {
+	infos, err := s.readDir(rel)
+	if err != nil {
+		return nil, err
+	}
+
+	trelloCards := make([]*trello.Card, 0)
+
+	for _, info := range infos {
+		trelloCard, err := s.newTrelloCard(path.Join(rel, info.Name()), info, attachments)
+		if err != nil {
+			return nil, err
+		}
+
+		if trelloCard != nil {
+			trelloCards = append(trelloCards, trelloCard)
+		}
+	}
+
+	return trelloCards, nil
+}
+
+// Creates a card from either a directory or a single image. If there's no
+// images to show for the card, nil is returned.
+func (s *FilesystemSource) newTrelloCard(
+	rel string,
+	info os.FileInfo,
+	attachments bool,
+) (*trello.Card, error) {
+	var (
+		name       string
+		imagePaths []string
+	)
+
+	if info.IsDir() {
+		infos, err := s.readDir(rel)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, imageInfo := range infos {
+			if !imageInfo.IsDir() && isImageFile(imageInfo.Name()) {
+				imagePaths = append(imagePaths, path.Join(rel, imageInfo.Name()))
+			}
+		}
+
+		name = info.Name()
+	} else if isImageFile(info.Name()) {
+		imagePaths = []string{rel}
+		name = strings.TrimSuffix(info.Name(), path.Ext(info.Name()))
+	}
+
+	if len(imagePaths) == 0 {
+		return nil, nil
+	}
+
+	modTime := info.ModTime()
+
+	trelloCard := &trello.Card{
+		ID:               encodeFilesystemID(rel),
+		Name:             name,
+		DateLastActivity: &modTime,
+		IDList:           encodeFilesystemID(path.Dir(rel)),
+	}
+
+	// There's no cover set for directories, so it's chosen with CoverPolicy
+	trelloCard.Badges.Attachments = len(imagePaths)
+
+	if attachments {
+		for _, imagePath := range imagePaths {
+			attachment, err := s.newAttachment(imagePath)
+			if err != nil {
+				return nil, err
+			}
+
+			trelloCard.Attachments = append(trelloCard.Attachments, attachment)
+		}
+	}
+
+	return trelloCard, nil
+}
+
+// Creates an attachment for an image, with previews sorted by width like the
+// ones from Trello. There's one for each of PreviewWidths smaller than the
+// image, served resized from /images, followed by the original. As with Trello,
+// the last preview is the original once more, which Image.GetPreviews leaves
+// out. The dimensions are those of the upright image, if it has an EXIF
+// orientation.
+func (s *FilesystemSource) newAttachment(rel string) (*trello.Attachment, error) {
+	file, err := os.Open(s.abs(rel))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	config, err := lib.DecodeImageConfig(file)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to decode %s: %s", rel, err))
+	}
+
+	id := encodeFilesystemID(rel)
+	url := path.Join("/files", id)
+
+	previews := make([]trello.AttachmentPreview, 0, len(PreviewWidths)+2)
+
+	for _, w := range PreviewWidths {
+		if w < config.Width {
+			previews = append(previews, trello.AttachmentPreview{
+				ID:     fmt.Sprintf("%s-%d", id, w),
+				URL:    path.Join("/images", id, strconv.Itoa(w)),
+				Width:  w,
+				Height: (config.Height*w + config.Width/2) / config.Width,
+				Scaled: true,
+			})
+		}
+	}
+
+	original := trello.AttachmentPreview{
+		ID:     id,
+		URL:    url,
+		Width:  config.Width,
+		Height: config.Height,
+	}
+
+	return &trello.Attachment{
+		ID:       id,
+		Name:     path.Base(rel),
+		IsUpload: true,
+		Previews: append(previews, original, original),
+		URL:      url,
+	}, nil
+}
+
+func isImageFile(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".jpg", ".jpeg", ".png", ".gif":
+		return true
+	}
+
+	return false
+}
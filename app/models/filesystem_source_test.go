@@ -0,0 +1,259 @@
+package models
+
+import (
+	"context"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+// Creates the following tree of directories and images in a temporary
+// directory:
+//
+//	Family/
+//	  2019/
+//	    Summer/
+//	      a.png
+//	      b.png
+//	    portrait.png
+//	    notes.txt
+//	  Empty/
+func createTestTree(t *testing.T) string {
+	root, err := ioutil.TempDir("", "gallo")
+	assert.NilError(t, err)
+
+	writeImage := func(name string, width, height int) {
+		file, err := os.Create(filepath.Join(root, name))
+		assert.NilError(t, err)
+		defer file.Close()
+
+		err = png.Encode(file, image.NewRGBA(image.Rect(0, 0, width, height)))
+		assert.NilError(t, err)
+	}
+
+	assert.NilError(t, os.MkdirAll(filepath.Join(root, "Family", "2019", "Summer"), 0755))
+	assert.NilError(t, os.MkdirAll(filepath.Join(root, "Family", "Empty"), 0755))
+
+	writeImage("Family/2019/Summer/a.png", 40, 30)
+	writeImage("Family/2019/Summer/b.png", 30, 40)
+	writeImage("Family/2019/portrait.png", 20, 30)
+
+	err = ioutil.WriteFile(filepath.Join(root, "Family", "2019", "notes.txt"), []byte("foo"), 0644)
+	assert.NilError(t, err)
+
+	return root
+}
+
+// -----------------------------------------------------------------------------
+
+func TestFilesystemSourceGetBoards(t *testing.T) {
+	root := createTestTree(t)
+	defer os.RemoveAll(root)
+
+	source := NewFilesystemSource(root)
+
+	boards, err := source.GetBoards()
+	assert.NilError(t, err)
+	assert.Equal(t, len(boards), 1)
+	assert.Equal(t, boards[0].Name, "Family")
+
+	t.Run("Lists are sideloaded", func(t *testing.T) {
+		assert.Equal(t, len(boards[0].Lists), 2)
+		assert.Equal(t, boards[0].Lists[0].Name, "2019")
+		assert.Equal(t, boards[0].Lists[1].Name, "Empty")
+	})
+
+	t.Run("Only lists with cards are valid", func(t *testing.T) {
+		lists, err := boards[0].GetValidLists(context.Background())
+		assert.NilError(t, err)
+		assert.Equal(t, len(lists), 1)
+		assert.Equal(t, lists[0].Name, "2019")
+	})
+}
+
+func TestFilesystemSourceGetListCards(t *testing.T) {
+	root := createTestTree(t)
+	defer os.RemoveAll(root)
+
+	source := NewFilesystemSource(root)
+
+	list, err := source.GetList(encodeFilesystemID("Family/2019"))
+	assert.NilError(t, err)
+
+	cards, err := list.GetCards()
+	assert.NilError(t, err)
+	assert.Equal(t, len(cards), 2)
+
+	t.Run("Directory card", func(t *testing.T) {
+		assert.Equal(t, cards[0].Name, "Summer")
+		assert.Equal(t, len(cards[0].GetImages()), 2)
+		assert.Equal(t, cards[0].CoverImage.Name, "a.png")
+		assert.Equal(t, cards[0].CoverImage.GetWidth(), 40)
+		assert.Equal(t, cards[0].CoverImage.GetHeight(), 30)
+	})
+
+	t.Run("Single image card", func(t *testing.T) {
+		assert.Equal(t, cards[1].Name, "portrait")
+		assert.Equal(t, len(cards[1].GetImages()), 1)
+		assert.Equal(t, cards[1].List.Name, "2019")
+	})
+}
+
+func TestFilesystemSourceGetListCardsPage(t *testing.T) {
+	root := createTestTree(t)
+	defer os.RemoveAll(root)
+
+	source := NewFilesystemSource(root)
+
+	list, err := source.GetList(encodeFilesystemID("Family/2019"))
+	assert.NilError(t, err)
+
+	page, err := list.GetCardsPage("", 1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(page.Cards), 1)
+	assert.Equal(t, page.Cards[0].Name, "Summer")
+	assert.Equal(t, page.Next, page.Cards[0].ID())
+
+	page, err = list.GetCardsPage(page.Next, 1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(page.Cards), 1)
+	assert.Equal(t, page.Cards[0].Name, "portrait")
+	assert.Equal(t, page.Next, "")
+
+	t.Run("Unknown cursor", func(t *testing.T) {
+		_, err := list.GetCardsPage(encodeFilesystemID("Family/2019/Winter"), 1)
+		assert.ErrorContains(t, err, "Unknown card")
+	})
+}
+
+func TestFilesystemSourceGetCard(t *testing.T) {
+	root := createTestTree(t)
+	defer os.RemoveAll(root)
+
+	source := NewFilesystemSource(root)
+
+	t.Run("Valid id", func(t *testing.T) {
+		card, err := source.GetCard(encodeFilesystemID("Family/2019/Summer"))
+		assert.NilError(t, err)
+		assert.Equal(t, card.Name, "Summer")
+		assert.Equal(t, card.List.Name, "2019")
+	})
+
+	t.Run("Wrong depth", func(t *testing.T) {
+		_, err := source.GetCard(encodeFilesystemID("Family/2019"))
+		assert.ErrorContains(t, err, "Invalid id")
+	})
+
+	t.Run("Outside of root", func(t *testing.T) {
+		path, err := source.FilePath(encodeFilesystemID("../../etc/passwd.png"))
+		assert.NilError(t, err)
+		assert.Equal(t, path, filepath.Join(root, "etc", "passwd.png"))
+	})
+}
+
+func TestFilesystemSourceGetBoardsCards(t *testing.T) {
+	root := createTestTree(t)
+	defer os.RemoveAll(root)
+
+	source := NewFilesystemSource(root)
+
+	boards, err := source.GetBoards()
+	assert.NilError(t, err)
+
+	trelloCards, err := source.GetBoardsCards(boards)
+	assert.NilError(t, err)
+	assert.Equal(t, len(trelloCards), 2)
+
+	for _, trelloCard := range trelloCards {
+		assert.Equal(t, trelloCard.IDList, encodeFilesystemID("Family/2019"))
+		assert.Equal(t, len(trelloCard.Attachments), 0)
+	}
+}
+
+func TestFilesystemSourceGetAttachment(t *testing.T) {
+	root := createTestTree(t)
+	defer os.RemoveAll(root)
+
+	source := NewFilesystemSource(root)
+	card := encodeFilesystemID("Family/2019/Summer")
+
+	t.Run("Image on the card", func(t *testing.T) {
+		attachment, err := source.GetAttachment(card, encodeFilesystemID("Family/2019/Summer/a.png"))
+		assert.NilError(t, err)
+		assert.Equal(t, attachment.Name, "a.png")
+	})
+
+	t.Run("Single image card", func(t *testing.T) {
+		id := encodeFilesystemID("Family/2019/portrait.png")
+
+		attachment, err := source.GetAttachment(id, id)
+		assert.NilError(t, err)
+		assert.Equal(t, attachment.Name, "portrait.png")
+	})
+
+	t.Run("Image on another card", func(t *testing.T) {
+		_, err := source.GetAttachment(card, encodeFilesystemID("Family/2019/portrait.png"))
+		assert.Assert(t, IsNotFound(err))
+	})
+
+	t.Run("Missing image", func(t *testing.T) {
+		_, err := source.GetAttachment(card, encodeFilesystemID("Family/2019/Summer/c.png"))
+		assert.Assert(t, IsNotFound(err))
+	})
+
+	t.Run("Not an image", func(t *testing.T) {
+		_, err := source.GetAttachment("", encodeFilesystemID("Family/2019/notes.txt"))
+		assert.Assert(t, IsNotFound(err))
+	})
+}
+
+func TestFilesystemSourcePreviews(t *testing.T) {
+	root := createTestTree(t)
+	defer os.RemoveAll(root)
+
+	previewWidths := PreviewWidths
+	PreviewWidths = []int{10, 20, 100}
+	defer func() { PreviewWidths = previewWidths }()
+
+	source := NewFilesystemSource(root)
+	card := encodeFilesystemID("Family/2019/Summer")
+	id := encodeFilesystemID("Family/2019/Summer/a.png")
+
+	t.Run("Widths smaller than the original, and the original", func(t *testing.T) {
+		attachment, err := source.GetAttachment(card, id)
+		assert.NilError(t, err)
+
+		previews := NewImage(attachment).GetPreviews()
+		assert.Equal(t, len(previews), 3)
+		assert.Equal(t, previews[0].URL, "/images/"+id+"/10")
+		assert.Equal(t, previews[1].Height, 15)
+		assert.Equal(t, previews[2].URL, "/files/"+id)
+		assert.Equal(t, previews[2].Width, 40)
+	})
+
+	openPreview := func(width int) int {
+		preview, err := source.OpenPreview(card, id, width)
+		assert.NilError(t, err)
+		defer preview.Close()
+
+		config, err := png.DecodeConfig(preview)
+		assert.NilError(t, err)
+
+		return config.Width
+	}
+
+	t.Run("Closest width", func(t *testing.T) {
+		assert.Equal(t, openPreview(15), 20)
+		assert.Equal(t, openPreview(20), 20)
+	})
+
+	t.Run("Original when larger than every preview", func(t *testing.T) {
+		assert.Equal(t, openPreview(30), 40)
+		assert.Equal(t, openPreview(1000), 40)
+	})
+}
@@ -1,21 +1,54 @@
 package models
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
 	"sort"
+	"strconv"
 
 	"github.com/adlio/trello"
 )
 
+// ResizeImages makes image previews point to versions of the original image,
+// resized by gallo, instead of the previews rendered by Trello.
+var ResizeImages = false
+
+// PreviewWidths are the widths original images are resized to, when
+// ResizeImages is set. The original width itself is used as well, if it's
+// smaller than the last one.
+var PreviewWidths = []int{150, 300, 600, 1200, 1920}
+
 type Image struct {
 	*trello.Attachment
+
+	// ID of the card the image is attached to
+	CardID string
+
+	// Thumbnail for a low quality placeholder, if the image has been analyzed
+	Thumbnail *Thumbnail
+
+	// Images composed into this one, if it's a collage cover
+	Parts []Image
 }
 
 func NewImage(attachment *trello.Attachment) Image {
-	image := Image{attachment}
+	image := Image{Attachment: attachment}
 
 	return image
 }
 
+// GetEdgeColor returns the edge color of the image, or DefaultEdgeColor if it
+// isn't known.
+func (i Image) GetEdgeColor() string {
+	if i.Attachment == nil || i.EdgeColor == "" {
+		return DefaultEdgeColor
+	}
+
+	return i.EdgeColor
+}
+
 func (i Image) GetWidth() int {
 	previews := i.GetPreviews()
 	return previews[len(previews)-1].Width
@@ -31,7 +64,74 @@ func (i Image) GetURL() string {
 	return previews[len(previews)-1].URL
 }
 
+// MarshalJSON exposes the image with the previews a client should choose from,
+// rather than the raw Trello attachment.
+func (i Image) MarshalJSON() ([]byte, error) {
+	if i.Attachment == nil {
+		return []byte("null"), nil
+	}
+
+	previews := i.GetPreviews()
+
+	data := struct {
+		ID        string                     `json:"id"`
+		CardID    string                     `json:"cardId,omitempty"`
+		Name      string                     `json:"name"`
+		Width     int                        `json:"width"`
+		Height    int                        `json:"height"`
+		URL       string                     `json:"url"`
+		EdgeColor string                     `json:"edgeColor"`
+		Previews  []trello.AttachmentPreview `json:"previews"`
+		Thumbnail *Thumbnail                 `json:"thumbnail,omitempty"`
+	}{
+		ID:        i.ID,
+		CardID:    i.CardID,
+		Name:      i.Name,
+		EdgeColor: i.GetEdgeColor(),
+		Previews:  previews,
+		Thumbnail: i.Thumbnail,
+	}
+
+	if len(previews) > 0 {
+		data.Width = i.GetWidth()
+		data.Height = i.GetHeight()
+		data.URL = i.GetURL()
+	}
+
+	return json.Marshal(data)
+}
+
+// GetPreviews returns previews of the image sorted by width ascending.
 func (i Image) GetPreviews() []trello.AttachmentPreview {
+	// Collages are always rendered by gallo
+	if i.IsCollage() {
+		return i.Previews
+	}
+
+	if ResizeImages {
+		return i.resizedPreviews()
+	}
+
+	return i.trelloPreviews()
+}
+
+// IsCollage tells whether the image is a collage of other images.
+func (i Image) IsCollage() bool {
+	return len(i.Parts) > 0
+}
+
+// ResizedURL is the url of the image resized to the given width by gallo.
+func (i Image) ResizedURL(width int) string {
+	u := url.URL{Path: path.Join("/images", i.ID, strconv.Itoa(width))}
+
+	if i.CardID != "" {
+		u.RawQuery = url.Values{"card": []string{i.CardID}}.Encode()
+	}
+
+	return u.String()
+}
+
+func (i Image) trelloPreviews() []trello.AttachmentPreview {
 	previewsCount := len(i.Previews)
 
 	if previewsCount <= 1 {
@@ -49,3 +149,67 @@ func (i Image) GetPreviews() []trello.AttachmentPreview {
 
 	return slicedPreviews
 }
+
+// Previews for each of PreviewWidths, which are smaller than the original.
+func (i Image) resizedPreviews() []trello.AttachmentPreview {
+	width, height := i.originalSize()
+	if width == 0 || height == 0 {
+		return i.trelloPreviews()
+	}
+
+	widths := make([]int, 0)
+
+	for _, w := range PreviewWidths {
+		if w < width {
+			widths = append(widths, w)
+		}
+	}
+
+	if len(PreviewWidths) == 0 || width <= PreviewWidths[len(PreviewWidths)-1] {
+		widths = append(widths, width)
+	}
+
+	previews := make([]trello.AttachmentPreview, len(widths))
+
+	for j, w := range widths {
+		previews[j] = trello.AttachmentPreview{
+			ID:     fmt.Sprintf("%s-%d", i.ID, w),
+			URL:    i.ResizedURL(w),
+			Width:  w,
+			Height: (height*w + width/2) / width,
+			Scaled: w != width,
+		}
+	}
+
+	return previews
+}
+
+// The dimensions of the original image. The last preview from Trello is the
+// largest one, but it might be rotated, so its dimensions are swapped if its
+// orientation differs from the other previews.
+func (i Image) originalSize() (width, height int) {
+	previewsCount := len(i.Previews)
+
+	if previewsCount == 0 {
+		return 0, 0
+	}
+
+	last := i.Previews[previewsCount-1]
+
+	if previewsCount == 1 {
+		return last.Width, last.Height
+	}
+
+	previews := i.trelloPreviews()
+	largest := previews[len(previews)-1]
+
+	if last.Width*last.Height < largest.Width*largest.Height {
+		return largest.Width, largest.Height
+	}
+
+	if (last.Width > last.Height) != (largest.Width > largest.Height) {
+		return last.Height, last.Width
+	}
+
+	return last.Width, last.Height
+}
@@ -0,0 +1,318 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"gallo/lib"
+	"image/jpeg"
+	"io/ioutil"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/adlio/trello"
+)
+
+// DefaultEdgeColor is used for images when their colors can't be determined at
+// all.
+const DefaultEdgeColor = "#000000"
+
+// Images are scaled down to this width before analyzing, since the exact
+// colors of individual pixels don't matter.
+const analysisWidth = 64
+
+// Width and JPEG quality of the thumbnails used for placeholders. They are
+// blurred when shown, so they only need to hold the rough shapes of an image.
+const thumbnailWidth = 24
+const thumbnailQuality = 50
+
+// The maximum number of images analyzed at the same time, both for a request
+// and in the background
+const analysisConcurrency = 4
+
+// The longest time an image is analyzed in the background
+const backgroundAnalysisTimeout = time.Minute
+
+// Thumbnail is a tiny version of an image, embedded as a data URI.
+type Thumbnail struct {
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	URI    string `json:"uri"`
+}
+
+// ImageAnalysis holds the results of analyzing the pixels of an image.
+type ImageAnalysis struct {
+	Edge      string     `json:"edge"`
+	Dominant  string     `json:"dominant"`
+	Thumbnail *Thumbnail `json:"thumbnail"`
+}
+
+// ImageAnalyzer determines colors of images from their pixels, for when Trello
+// hasn't provided an edge color, and creates thumbnails for low quality
+// placeholders. Results are cached per attachment. Images which can't be
+// analyzed are left without, and tried again when asked for the next time.
+type ImageAnalyzer struct {
+	cache lib.BlobCache
+
+	mutex sync.Mutex
+	// IDs of the images being analyzed in the background
+	analyzing map[string]bool
+	// Holds a slot for each image being analyzed in the background
+	background chan struct{}
+}
+
+func NewImageAnalyzer(cache lib.BlobCache) *ImageAnalyzer {
+	return &ImageAnalyzer{
+		cache:      cache,
+		analyzing:  make(map[string]bool),
+		background: make(chan struct{}, analysisConcurrency),
+	}
+}
+
+// A collage is represented by its first image, which is also where its edge
+// color comes from.
+func analyzedImage(image Image) Image {
+	if image.IsCollage() {
+		return image.Parts[0]
+	}
+
+	return image
+}
+
+func analysisKey(image Image) string {
+	return fmt.Sprintf("analysis-%s", image.ID)
+}
+
+// Returns the analysis of an image from the cache, if it's been analyzed.
+func (a *ImageAnalyzer) cached(ctx context.Context, image Image) (*ImageAnalysis, bool) {
+	analysis := &ImageAnalysis{}
+
+	data, err := a.cache.Get(ctx, analysisKey(analyzedImage(image)))
+	if err != nil || json.Unmarshal(data, analysis) != nil {
+		return nil, false
+	}
+
+	return analysis, true
+}
+
+// Analyze returns the analysis of an image, either from the cache or by
+// fetching and analyzing a small version of the attachment from the source in
+// ctx.
+func (a *ImageAnalyzer) Analyze(ctx context.Context, image Image) (*ImageAnalysis, error) {
+	if analysis, ok := a.cached(ctx, image); ok {
+		return analysis, nil
+	}
+
+	image = analyzedImage(image)
+
+	analysis := &ImageAnalysis{}
+
+	preview, err := OpenPreview(ctx, image.CardID, image.ID, analysisWidth)
+	if err != nil {
+		return nil, err
+	}
+	defer preview.Close()
+
+	previewData, err := ioutil.ReadAll(preview)
+	if err != nil {
+		return nil, err
+	}
+
+	img, _, err := lib.DecodeImage(previewData)
+	if err != nil {
+		return nil, err
+	}
+
+	img = lib.Resize(img, analysisWidth)
+
+	analysis.Edge = lib.HexColor(lib.EdgeColor(img))
+	analysis.Dominant = lib.HexColor(lib.DominantColor(img))
+
+	thumbnail := lib.Resize(img, thumbnailWidth)
+
+	buf := new(bytes.Buffer)
+
+	err = jpeg.Encode(buf, thumbnail, &jpeg.Options{Quality: thumbnailQuality})
+	if err != nil {
+		return nil, err
+	}
+
+	analysis.Thumbnail = &Thumbnail{
+		Width:  thumbnail.Bounds().Dx(),
+		Height: thumbnail.Bounds().Dy(),
+		URI: fmt.Sprintf(
+			"data:image/jpeg;base64,%s",
+			base64.StdEncoding.EncodeToString(buf.Bytes()),
+		),
+	}
+
+	data, err := json.Marshal(analysis)
+	if err != nil {
+		return nil, err
+	}
+
+	err = a.cache.Set(ctx, analysisKey(image), data)
+	if err != nil {
+		log.Println(err)
+	}
+
+	return analysis, nil
+}
+
+// FillEdgeColors sets the edge color of each image which doesn't have one,
+// analyzing the ones which haven't been already. Images which can't be
+// analyzed are left without, see Image.GetEdgeColor.
+func (a *ImageAnalyzer) FillEdgeColors(ctx context.Context, images []Image) {
+	a.analyzeAll(ctx, withoutEdgeColor(images), true)
+}
+
+// FillAnalyzedEdgeColors sets the edge color of each image which doesn't have
+// one, if it's been analyzed already. The rest are analyzed in the background,
+// so pages with many images aren't held up by fetching all of them. It returns
+// whether every image was filled, so pages missing some aren't kept.
+func (a *ImageAnalyzer) FillAnalyzedEdgeColors(ctx context.Context, images []Image) bool {
+	return a.analyzeAll(ctx, withoutEdgeColor(images), false)
+}
+
+// FillThumbnails sets the thumbnail of each image, as well as the edge color if
+// it's missing, for the images analyzed already. Like FillAnalyzedEdgeColors,
+// the rest are analyzed in the background, and left without a thumbnail, and it
+// returns whether every image was filled.
+func (a *ImageAnalyzer) FillThumbnails(ctx context.Context, images []*Image) bool {
+	pending := make([]*Image, 0, len(images))
+
+	for i := range images {
+		if images[i].Attachment != nil && images[i].Thumbnail == nil {
+			pending = append(pending, images[i])
+		}
+	}
+
+	return a.analyzeAll(ctx, pending, false)
+}
+
+func withoutEdgeColor(images []Image) []*Image {
+	pending := make([]*Image, 0, len(images))
+
+	for i := range images {
+		if images[i].Attachment != nil && images[i].EdgeColor == "" {
+			pending = append(pending, &images[i])
+		}
+	}
+
+	return pending
+}
+
+// Analyzes images concurrently and applies the results to them. Unless wait is
+// set, only the cached results are applied, and the images without any are
+// analyzed in the background. Returns whether none were left to the background.
+func (a *ImageAnalyzer) analyzeAll(ctx context.Context, images []*Image, wait bool) bool {
+	var wg sync.WaitGroup
+	var later int32
+
+	semaphore := make(chan struct{}, analysisConcurrency)
+
+	// Images can share attachments, which should only be analyzed once
+	shared := make(map[*trello.Attachment][]*Image)
+
+	for i := range images {
+		attachment := images[i].Attachment
+		shared[attachment] = append(shared[attachment], images[i])
+	}
+
+	for _, sharing := range shared {
+		wg.Add(1)
+		semaphore <- struct{}{}
+
+		go func(images []*Image) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			var analysis *ImageAnalysis
+
+			if wait {
+				var err error
+
+				analysis, err = a.Analyze(ctx, *images[0])
+				if err != nil {
+					log.Println(err)
+					return
+				}
+			} else {
+				var ok bool
+
+				analysis, ok = a.cached(ctx, *images[0])
+				if !ok {
+					atomic.StoreInt32(&later, 1)
+					a.analyzeLater(ctx, *images[0])
+					return
+				}
+			}
+
+			if images[0].EdgeColor == "" {
+				images[0].EdgeColor = analysis.Edge
+			}
+
+			for i := range images {
+				images[i].Thumbnail = analysis.Thumbnail
+			}
+		}(sharing)
+	}
+
+	wg.Wait()
+
+	return atomic.LoadInt32(&later) == 0
+}
+
+// Analyzes image in the background with the source in ctx, so the analysis is
+// cached for later requests. Images already being analyzed are skipped, and so
+// is image if there are too many, since it's tried again on the next request.
+func (a *ImageAnalyzer) analyzeLater(ctx context.Context, image Image) {
+	source, err := sourceFromContext(ctx)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	id := analyzedImage(image).ID
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.analyzing[id] {
+		return
+	}
+
+	select {
+	case a.background <- struct{}{}:
+	default:
+		return
+	}
+
+	a.analyzing[id] = true
+
+	go func() {
+		defer func() {
+			a.mutex.Lock()
+			delete(a.analyzing, id)
+			a.mutex.Unlock()
+
+			<-a.background
+		}()
+
+		// The request may be done before the analysis, so it has its own context
+		ctx, cancel := context.WithTimeout(
+			NewSourceContext(context.Background(), source),
+			backgroundAnalysisTimeout,
+		)
+		defer cancel()
+
+		_, err := a.Analyze(ctx, image)
+		if err != nil {
+			log.Println(err)
+		}
+	}()
+}
@@ -0,0 +1,191 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adlio/trello"
+	"github.com/go-redis/cache/v8"
+	"gotest.tools/assert"
+)
+
+// memoryBlobCache is a lib.BlobCache backed by a map
+type memoryBlobCache map[string][]byte
+
+func (c memoryBlobCache) Get(ctx context.Context, key string) ([]byte, error) {
+	if value, ok := c[key]; ok {
+		return value, nil
+	}
+
+	return nil, cache.ErrCacheMiss
+}
+
+func (c memoryBlobCache) Set(ctx context.Context, key string, value []byte) error {
+	c[key] = value
+	return nil
+}
+
+// imageSource is a stubSource where every attachment is the same image
+type imageSource struct {
+	stubSource
+	data  []byte
+	opens int
+}
+
+func (s *imageSource) OpenAttachment(cardID, id string) (io.ReadCloser, error) {
+	s.opens++
+
+	if s.data == nil {
+		return nil, errors.New("attachment not found")
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(s.data)), nil
+}
+
+func (s *imageSource) OpenPreview(cardID, id string, width int) (io.ReadCloser, error) {
+	return s.OpenAttachment(cardID, id)
+}
+
+// A png which is red along the edges and blue in the middle
+func createColorTestImage(t *testing.T) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 10, 10))
+
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 10; x++ {
+			if x == 0 || y == 0 || x == 9 || y == 9 {
+				img.Set(x, y, color.RGBA{255, 0, 0, 255})
+			} else {
+				img.Set(x, y, color.RGBA{0, 0, 255, 255})
+			}
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	assert.NilError(t, png.Encode(buf, img))
+
+	return buf.Bytes()
+}
+
+// -----------------------------------------------------------------------------
+
+func TestImageAnalyzerAnalyze(t *testing.T) {
+	source := &imageSource{data: createColorTestImage(t)}
+	ctx := NewSourceContext(context.Background(), source)
+	analyzer := NewImageAnalyzer(make(memoryBlobCache))
+
+	image := NewImage(&trello.Attachment{ID: "42"})
+
+	analysis, err := analyzer.Analyze(ctx, image)
+	assert.NilError(t, err)
+	assert.Equal(t, analysis.Edge, "#ff0000")
+	assert.Equal(t, analysis.Dominant, "#0000ff")
+
+	t.Run("Thumbnail is a jpeg", func(t *testing.T) {
+		assert.Equal(t, analysis.Thumbnail.Width, 10)
+		assert.Equal(t, analysis.Thumbnail.Height, 10)
+		assert.Assert(t, strings.HasPrefix(analysis.Thumbnail.URI, "data:image/jpeg;base64,"))
+	})
+
+	t.Run("Results are cached", func(t *testing.T) {
+		_, err := analyzer.Analyze(ctx, image)
+		assert.NilError(t, err)
+		assert.Equal(t, source.opens, 1)
+	})
+}
+
+func TestImageAnalyzerFillEdgeColors(t *testing.T) {
+	t.Run("Only missing colors are filled", func(t *testing.T) {
+		source := &imageSource{data: createColorTestImage(t)}
+		ctx := NewSourceContext(context.Background(), source)
+		analyzer := NewImageAnalyzer(make(memoryBlobCache))
+
+		images := []Image{
+			NewImage(&trello.Attachment{ID: "1", EdgeColor: "#abcdef"}),
+			NewImage(&trello.Attachment{ID: "2"}),
+		}
+
+		analyzer.FillEdgeColors(ctx, images)
+
+		assert.Equal(t, images[0].EdgeColor, "#abcdef")
+		assert.Equal(t, images[1].EdgeColor, "#ff0000")
+		assert.Equal(t, source.opens, 1)
+	})
+
+	t.Run("Failures are left without a color", func(t *testing.T) {
+		ctx := NewSourceContext(context.Background(), &imageSource{})
+		analyzer := NewImageAnalyzer(make(memoryBlobCache))
+
+		attachment := &trello.Attachment{ID: "1"}
+		images := []Image{NewImage(attachment)}
+
+		analyzer.FillEdgeColors(ctx, images)
+
+		assert.Equal(t, attachment.EdgeColor, "")
+		assert.Equal(t, images[0].GetEdgeColor(), DefaultEdgeColor)
+	})
+}
+
+// Waits for the images being analyzed in the background by analyzer.
+func waitForAnalyses(t *testing.T, analyzer *ImageAnalyzer) {
+	for n := 0; n < 100; n++ {
+		analyzer.mutex.Lock()
+		analyzing := len(analyzer.analyzing)
+		analyzer.mutex.Unlock()
+
+		if analyzing == 0 {
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatal("Images still being analyzed")
+}
+
+func TestImageAnalyzerFillAnalyzedEdgeColors(t *testing.T) {
+	source := &imageSource{data: createColorTestImage(t)}
+	ctx := NewSourceContext(context.Background(), source)
+	analyzer := NewImageAnalyzer(make(memoryBlobCache))
+
+	images := []Image{NewImage(&trello.Attachment{ID: "1"})}
+
+	assert.Assert(t, !analyzer.FillAnalyzedEdgeColors(ctx, images))
+	assert.Equal(t, images[0].EdgeColor, "")
+
+	waitForAnalyses(t, analyzer)
+
+	assert.Assert(t, analyzer.FillAnalyzedEdgeColors(ctx, images))
+	assert.Equal(t, images[0].EdgeColor, "#ff0000")
+	assert.Equal(t, source.opens, 1)
+}
+
+func TestImageAnalyzerFillThumbnails(t *testing.T) {
+	source := &imageSource{data: createColorTestImage(t)}
+	ctx := NewSourceContext(context.Background(), source)
+	analyzer := NewImageAnalyzer(make(memoryBlobCache))
+
+	attachment := &trello.Attachment{ID: "1"}
+	first := NewImage(attachment)
+	second := NewImage(attachment)
+
+	assert.Assert(t, !analyzer.FillThumbnails(ctx, []*Image{&first, &second}))
+	assert.Assert(t, first.Thumbnail == nil)
+
+	waitForAnalyses(t, analyzer)
+
+	assert.Assert(t, analyzer.FillThumbnails(ctx, []*Image{&first, &second}))
+
+	assert.Assert(t, first.Thumbnail != nil)
+	assert.Equal(t, first.Thumbnail, second.Thumbnail)
+	assert.Equal(t, attachment.EdgeColor, "#ff0000")
+	assert.Equal(t, source.opens, 1)
+}
@@ -46,7 +46,7 @@ func TestGetters(t *testing.T) {
 func TestGetPreviews(t *testing.T) {
 	t.Run("No attachments, no panic", func(t *testing.T) {
 		image := Image{
-			&trello.Attachment{
+			Attachment: &trello.Attachment{
 				Previews: []trello.AttachmentPreview{},
 			},
 		}
@@ -56,3 +56,64 @@ func TestGetPreviews(t *testing.T) {
 		assert.Equal(t, len(previews), 0)
 	})
 }
+
+func TestResizedPreviews(t *testing.T) {
+	ResizeImages = true
+	defer func() { ResizeImages = false }()
+
+	t.Run("Previews up to the original width", func(t *testing.T) {
+		image := Image{
+			Attachment: &trello.Attachment{
+				ID: "42",
+				Previews: []trello.AttachmentPreview{
+					trello.AttachmentPreview{Width: 150, Height: 100},
+					trello.AttachmentPreview{Width: 300, Height: 200},
+					trello.AttachmentPreview{Width: 900, Height: 600},
+				},
+			},
+			CardID: "1",
+		}
+
+		previews := image.GetPreviews()
+
+		assert.Equal(t, len(previews), 4)
+		assert.Equal(t, previews[2].Width, 600)
+		assert.Equal(t, previews[2].Height, 400)
+		assert.Equal(t, previews[2].URL, "/images/42/600?card=1")
+		assert.Equal(t, previews[3].Width, 900)
+		assert.Equal(t, previews[3].Height, 600)
+	})
+
+	t.Run("Rotated last preview", func(t *testing.T) {
+		image := NewImage(
+			&trello.Attachment{
+				ID: "42",
+				Previews: []trello.AttachmentPreview{
+					trello.AttachmentPreview{Width: 150, Height: 100},
+					trello.AttachmentPreview{Width: 600, Height: 900},
+				},
+			},
+		)
+
+		assert.Equal(t, image.GetWidth(), 900)
+		assert.Equal(t, image.GetHeight(), 600)
+		assert.Equal(t, image.GetURL(), "/images/42/900")
+	})
+
+	t.Run("Capped at the largest preview width", func(t *testing.T) {
+		image := NewImage(
+			&trello.Attachment{
+				ID: "42",
+				Previews: []trello.AttachmentPreview{
+					trello.AttachmentPreview{Width: 4000, Height: 3000},
+				},
+			},
+		)
+
+		previews := image.GetPreviews()
+
+		assert.Equal(t, len(previews), len(PreviewWidths))
+		assert.Equal(t, image.GetWidth(), 1920)
+		assert.Equal(t, image.GetHeight(), 1440)
+	})
+}
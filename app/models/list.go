@@ -2,10 +2,10 @@ package models
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"gallo/lib"
-	"math/rand"
 
 	"github.com/adlio/trello"
 )
@@ -16,6 +16,8 @@ type List struct {
 	Cards []*Card
 
 	TrelloList *trello.List
+
+	source Source
 }
 
 func NewList(trelloList *trello.List) (*List, error) {
@@ -30,20 +32,35 @@ func NewList(trelloList *trello.List) (*List, error) {
 	return list, nil
 }
 
+// GetList returns the list with the given id, if it's selected by the list
+// selection of its board in the settings of ctx.
 func GetList(ctx context.Context, id string) (list *List, err error) {
 	defer lib.Track(lib.RunningTime("GetList"))
 
-	client, err := clientFromContext(ctx)
+	source, err := sourceFromContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	trelloList, err := client.GetList(id, trello.Defaults())
+	list, err = source.GetList(id)
 	if err != nil {
 		return nil, err
 	}
 
-	return NewList(trelloList)
+	if !listSelection(ctx, list.TrelloList.IDBoard).Includes(list) {
+		return nil, errors.New(fmt.Sprintf("List %s isn't selected", list.Name))
+	}
+
+	return list, nil
+}
+
+// Sets the source of the list and its cards.
+func (l *List) setSource(source Source) {
+	l.source = source
+
+	for i := range l.Cards {
+		l.Cards[i].setSource(source)
+	}
 }
 
 // Memoized slice of cards on a list, with attachments sideloaded.
@@ -51,43 +68,91 @@ func (l *List) GetCards() ([]*Card, error) {
 	defer lib.Track(lib.RunningTime(fmt.Sprintf("list.GetCards - %s", l.Name)))
 
 	if l.Cards == nil {
-		args := trello.Defaults()
-		args["attachments"] = "true"
+		cards, err := defaultSource(l.source).GetListCards(l)
+		if err != nil {
+			return nil, err
+		}
+
+		l.Cards = cards
+	}
+
+	return l.Cards, nil
+}
+
+// The number of cards on a page of a list, unless another limit is asked for
+const DefaultListPageSize = 100
+
+// The most cards on a page of a list, which is the most Trello returns at once
+const MaxListPageSize = 1000
+
+// ListPage is a page of the cards on a list.
+type ListPage struct {
+	Cards []*Card
+
+	// Cursor of the following page, or empty if this is the last one
+	Next string
+}
+
+// GetCardsPage returns the displayable cards among up to limit cards on the
+// list, which follow the before cursor of a previous page. The first page is
+// returned if before is empty. Since only some cards may be displayable, pages
+// can have fewer cards than limit, even if they aren't the last one.
+func (l *List) GetCardsPage(before string, limit int) (*ListPage, error) {
+	defer lib.Track(lib.RunningTime(fmt.Sprintf("list.GetCardsPage - %s", l.Name)))
+
+	if limit < 1 || limit > MaxListPageSize {
+		return nil, errors.New(fmt.Sprintf("Page size must be between 1 and %d", MaxListPageSize))
+	}
+
+	cards, next, err := defaultSource(l.source).GetListCardsPage(l, before, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ListPage{Cards: cards, Next: next}, nil
+}
+
+// Creates the displayable cards of a list from trelloCards, which are those a
+// cover can be chosen for.
+func newListCards(source Source, list *List, trelloCards []*trello.Card) ([]*Card, error) {
+	cards := make([]*Card, 0)
+
+	for i := range trelloCards {
+		// Re-attach parent list, since that isn't sideloaded for the cards of a
+		// list
+		trelloCards[i].List = list.TrelloList
 
-		if l.TrelloList == nil {
-			return nil, errors.New("TrelloList is nil")
+		// Skip cards without a cover, which are those without any image
+		// attachments, unless covers have to be set explicitly
+		if !hasCover(trelloCards[i]) {
+			continue
 		}
 
-		trelloCards, err := l.TrelloList.GetCards(args)
+		card, err := NewCard(trelloCards[i])
 		if err != nil {
 			return nil, err
 		}
 
-		l.Cards = make([]*Card, 0)
+		card.setSource(source)
 
-		for i := range trelloCards {
-			// Re-attach parent list, since that isn't sideloaded for this endpoint
-			trelloCards[i].List = l.TrelloList
-
-			// Skip if there's no cover, since then there's no image attachments
-			// neither
-			if trelloCards[i].IDAttachmentCover == "" {
-				continue
-			}
+		cards = append(cards, card)
+	}
 
-			card, err := NewCard(trelloCards[i])
-			if err != nil {
-				return nil, err
-			}
+	return cards, nil
+}
 
-			l.Cards = append(l.Cards, card)
-		}
+// GetRandomCard picks one of the cards on the list with strategy.
+func (l *List) GetRandomCard(ctx context.Context, strategy ShuffleStrategy) (*Card, error) {
+	cards, err := l.GetRandomCards(ctx, strategy, 1)
+	if err != nil {
+		return nil, err
 	}
 
-	return l.Cards, nil
+	return cards[0], nil
 }
 
-func (l *List) GetRandomCard() (*Card, error) {
+// GetRandomCards picks up to n different cards on the list with strategy.
+func (l *List) GetRandomCards(ctx context.Context, strategy ShuffleStrategy, n int) ([]*Card, error) {
 	defer lib.Track(lib.RunningTime("GetCards"))
 
 	cards, err := l.GetCards()
@@ -95,7 +160,17 @@ func (l *List) GetRandomCard() (*Card, error) {
 		return nil, err
 	}
 
-	return cards[rand.Intn(len(cards))], nil
+	indices, err := pickCards(ctx, strategy, trelloCards(cards), n)
+	if err != nil {
+		return nil, err
+	}
+
+	picked := make([]*Card, len(indices))
+	for i := range indices {
+		picked[i] = cards[indices[i]]
+	}
+
+	return picked, nil
 }
 
 func (l List) ID() string {
@@ -105,3 +180,13 @@ func (l List) ID() string {
 func (List) PluralName() string {
 	return "lists"
 }
+
+// MarshalJSON exposes the members of a list needed by clients of the API.
+// Cards are left out, since they're only loaded on demand.
+func (l List) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		ID      string `json:"id"`
+		Name    string `json:"name"`
+		BoardID string `json:"boardId"`
+	}{l.ID(), l.Name, l.TrelloList.IDBoard})
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// ListSelection decides which lists of a board are shown. A list is shown if
+// it matches any of the rules, unless it's archived and those are excluded.
+type ListSelection struct {
+	// Whether every list is shown
+	All bool `json:"all"`
+	// Whether lists watched in Trello are shown. This is how lists were
+	// selected before anything else.
+	Watched bool `json:"watched"`
+	// Lists with a name matching this regular expression are shown. An empty
+	// pattern disables the rule.
+	NamePattern string `json:"namePattern"`
+	// Whether archived lists are left out, even if matched by the rules above
+	ExcludeArchived bool `json:"excludeArchived"`
+
+	// NamePattern compiled, when the settings are loaded
+	namePattern *regexp.Regexp
+}
+
+// DefaultListSelection selects watched lists, which aren't archived.
+func DefaultListSelection() ListSelection {
+	return ListSelection{
+		Watched:         true,
+		ExcludeArchived: true,
+	}
+}
+
+// Validate returns an error if the name pattern isn't a valid regular
+// expression.
+func (s ListSelection) Validate() error {
+	if s.NamePattern == "" {
+		return nil
+	}
+
+	_, err := regexp.Compile(s.NamePattern)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Invalid list name pattern: %s", s.NamePattern))
+	}
+
+	return nil
+}
+
+// Returns s with the name pattern compiled, so it isn't compiled again for each
+// list. An invalid pattern is left uncompiled, which disables the rule.
+func (s ListSelection) compile() ListSelection {
+	s.namePattern = nil
+
+	if s.NamePattern != "" {
+		s.namePattern, _ = regexp.Compile(s.NamePattern)
+	}
+
+	return s
+}
+
+// Includes tells whether list is shown.
+func (s ListSelection) Includes(list *List) bool {
+	if s.ExcludeArchived && list.TrelloList.Closed {
+		return false
+	}
+
+	if s.All {
+		return true
+	}
+
+	if s.Watched && list.TrelloList.Subscribed {
+		return true
+	}
+
+	if s.NamePattern != "" {
+		if s.namePattern == nil {
+			s = s.compile()
+		}
+
+		if s.namePattern != nil && s.namePattern.MatchString(list.Name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns the list selection for the board with the given id, from the
+// settings in ctx.
+func listSelection(ctx context.Context, boardID string) ListSelection {
+	return SettingsFromContext(ctx).ListSelection(boardID)
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/adlio/trello"
+	"gotest.tools/assert"
+)
+
+func newSelectionTestList(name string, subscribed, closed bool) *List {
+	return &List{
+		Name: name,
+		TrelloList: &trello.List{
+			Name:       name,
+			Subscribed: subscribed,
+			Closed:     closed,
+		},
+	}
+}
+
+func TestListSelection(t *testing.T) {
+	watched := newSelectionTestList("Summer", true, false)
+	unwatched := newSelectionTestList("Winter", false, false)
+	archived := newSelectionTestList("Spring", true, true)
+
+	t.Run("Default", func(t *testing.T) {
+		selection := DefaultListSelection()
+
+		assert.Assert(t, selection.Includes(watched))
+		assert.Assert(t, !selection.Includes(unwatched))
+		assert.Assert(t, !selection.Includes(archived))
+	})
+
+	t.Run("All", func(t *testing.T) {
+		selection := ListSelection{All: true}
+
+		assert.Assert(t, selection.Includes(watched))
+		assert.Assert(t, selection.Includes(unwatched))
+		assert.Assert(t, selection.Includes(archived))
+
+		selection.ExcludeArchived = true
+		assert.Assert(t, !selection.Includes(archived))
+	})
+
+	t.Run("Name pattern", func(t *testing.T) {
+		selection := ListSelection{NamePattern: "^(Winter|Spring)$"}
+
+		assert.Assert(t, !selection.Includes(watched))
+		assert.Assert(t, selection.Includes(unwatched))
+		assert.Assert(t, selection.Includes(archived))
+	})
+
+	t.Run("Validate", func(t *testing.T) {
+		assert.NilError(t, DefaultListSelection().Validate())
+
+		selection := ListSelection{NamePattern: "("}
+		assert.Error(t, selection.Validate(), "Invalid list name pattern: (")
+	})
+}
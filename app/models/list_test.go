@@ -41,6 +41,13 @@ func TestGetList(t *testing.T) {
 
 	_, err = GetList(defaultContext, "237")
 	assert.ErrorContains(t, err, "list not found")
+
+	// Not selected for its board
+	settings := DefaultSettings()
+	settings.Lists["1235"] = ListSelection{NamePattern: "^Ipsum$"}
+
+	_, err = GetList(NewSettingsContext(defaultContext, settings), "236")
+	assert.ErrorContains(t, err, "isn't selected")
 }
 
 func TestListGetCards(t *testing.T) {
@@ -91,3 +98,51 @@ func TestListGetCards(t *testing.T) {
 		assert.Equal(t, httpmock.GetTotalCallCount(), 1)
 	})
 }
+
+func TestListGetCardsPage(t *testing.T) {
+	httpmock.RegisterResponder(
+		"GET",
+		"https://api.trello.com/1/lists/234?",
+		httpmock.NewBytesResponder(http.StatusOK, testData["testdata/lists-000.json"]),
+	)
+	httpmock.RegisterResponder(
+		"GET",
+		"https://api.trello.com/1/lists/234/cards?attachments=true&limit=1",
+		httpmock.NewBytesResponder(http.StatusOK, testData["testdata/cards-000.json"]),
+	)
+	httpmock.RegisterResponder(
+		"GET",
+		"https://api.trello.com/1/lists/234/cards?attachments=true&before=34&limit=1",
+		httpmock.NewStringResponder(http.StatusOK, "[]"),
+	)
+	defer httpmock.Reset()
+
+	trelloList, err := trelloClient.GetList("234", trello.Defaults())
+	assert.NilError(t, err)
+
+	list, err := NewList(trelloList)
+	assert.NilError(t, err)
+
+	t.Run("Full page has a following page", func(t *testing.T) {
+		page, err := list.GetCardsPage("", 1)
+		assert.NilError(t, err)
+		assert.Equal(t, len(page.Cards), 1)
+		assert.Equal(t, page.Cards[0].TrelloCard.Name, "Foo")
+		assert.Equal(t, page.Next, "34")
+	})
+
+	t.Run("Last page", func(t *testing.T) {
+		page, err := list.GetCardsPage("34", 1)
+		assert.NilError(t, err)
+		assert.Equal(t, len(page.Cards), 0)
+		assert.Equal(t, page.Next, "")
+	})
+
+	t.Run("Page size out of bounds", func(t *testing.T) {
+		_, err := list.GetCardsPage("", 0)
+		assert.ErrorContains(t, err, "Page size must be between 1 and 1000")
+
+		_, err = list.GetCardsPage("", MaxListPageSize+1)
+		assert.ErrorContains(t, err, "Page size must be between 1 and 1000")
+	})
+}
@@ -21,3 +21,14 @@ func clientFromContext(ctx context.Context) (*trello.Client, error) {
 
 	return value.(*trello.Client), nil
 }
+
+// Whether values contains value.
+func containsString(values []string, value string) bool {
+	for i := range values {
+		if values[i] == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,178 @@
+package models
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/adlio/trello"
+)
+
+// PhotoFields are the names of the custom fields of a board, which tell about
+// the photos on a card.
+type PhotoFields struct {
+	// A date field with when the photos were taken
+	Taken string `json:"taken"`
+	// A text or dropdown field with where the photos were taken
+	Location string `json:"location"`
+	// A text field with the people in the photos, separated by commas
+	People string `json:"people"`
+}
+
+// DefaultPhotoFields are the names of the custom fields used for boards, which
+// haven't been set up with other names.
+func DefaultPhotoFields() PhotoFields {
+	return PhotoFields{
+		Taken:    "Taken",
+		Location: "Location",
+		People:   "People",
+	}
+}
+
+// Returns the photo described by the custom field values of a card.
+func (f PhotoFields) photo(values map[string]interface{}) Photo {
+	photo := Photo{}
+
+	switch taken := values[f.Taken].(type) {
+	case time.Time:
+		photo.Taken = &taken
+	case string:
+		if t, err := time.Parse("2006-01-02", strings.TrimSpace(taken)); err == nil {
+			photo.Taken = &t
+		}
+	}
+
+	if location, ok := values[f.Location].(string); ok {
+		photo.Location = strings.TrimSpace(location)
+	}
+
+	if people, ok := values[f.People].(string); ok {
+		for _, person := range strings.Split(people, ",") {
+			if person = strings.TrimSpace(person); person != "" {
+				photo.People = append(photo.People, person)
+			}
+		}
+	}
+
+	return photo
+}
+
+// Photo is what's known about the photos on a card from its custom fields.
+type Photo struct {
+	Taken    *time.Time `json:"taken,omitempty"`
+	Location string     `json:"location,omitempty"`
+	People   []string   `json:"people,omitempty"`
+}
+
+// ShuffleFilter narrows down the cards picked by a shuffle to the ones with
+// photos from a location, or of a person. Empty fields match any card.
+type ShuffleFilter struct {
+	Location string
+	Person   string
+}
+
+// IsEmpty tells whether the filter matches any card.
+func (f ShuffleFilter) IsEmpty() bool {
+	return f.Location == "" && f.Person == ""
+}
+
+// Key identifies the filter, e.g. for keeping a shuffle bag per filter.
+func (f ShuffleFilter) Key() string {
+	return strings.ToLower(f.Location + "|" + f.Person)
+}
+
+// Matches tells whether photo matches the filter. Names are compared without
+// regard to case.
+func (f ShuffleFilter) Matches(photo Photo) bool {
+	if f.Location != "" && !strings.EqualFold(f.Location, photo.Location) {
+		return false
+	}
+
+	if f.Person == "" {
+		return true
+	}
+
+	for _, person := range photo.People {
+		if strings.EqualFold(f.Person, person) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FilteredStrategy picks cards with Strategy among the ones matching Filter.
+// Custom fields are loaded from the source in the context of Pick, a board at a
+// time, as cards of each board are considered.
+type FilteredStrategy struct {
+	Strategy ShuffleStrategy
+	Filter   ShuffleFilter
+
+	// Photos of the cards on the lists loaded so far, by card ID
+	photos map[string]Photo
+	// IDs of the boards loaded so far
+	boards map[string]bool
+}
+
+func NewFilteredStrategy(strategy ShuffleStrategy, filter ShuffleFilter) *FilteredStrategy {
+	return &FilteredStrategy{
+		Strategy: strategy,
+		Filter:   filter,
+		photos:   make(map[string]Photo),
+		boards:   make(map[string]bool),
+	}
+}
+
+func (s *FilteredStrategy) Pick(ctx context.Context, cards []*trello.Card) (int, error) {
+	candidates := make([]*trello.Card, 0)
+	indices := make([]int, 0)
+
+	for i := range cards {
+		photo, err := s.photo(ctx, cards[i])
+		if err != nil {
+			return 0, err
+		}
+
+		if s.Filter.Matches(photo) {
+			candidates = append(candidates, cards[i])
+			indices = append(indices, i)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return 0, errNoCandidates
+	}
+
+	i, err := s.Strategy.Pick(ctx, candidates)
+	if err != nil {
+		return 0, err
+	}
+
+	return indices[i], nil
+}
+
+// Returns the photo of a card, loading the custom fields of the cards on its
+// board first if they haven't been already. Every card of the board may be
+// considered, so they're loaded in one go.
+func (s *FilteredStrategy) photo(ctx context.Context, card *trello.Card) (Photo, error) {
+	if !s.boards[card.IDBoard] {
+		source, err := sourceFromContext(ctx)
+		if err != nil {
+			return Photo{}, err
+		}
+
+		values, err := source.GetCustomFields(card.IDBoard, nil)
+		if err != nil {
+			return Photo{}, err
+		}
+
+		fields := SettingsFromContext(ctx).PhotoFieldsOf(card.IDBoard)
+		for id := range values {
+			s.photos[id] = fields.photo(values[id])
+		}
+
+		s.boards[card.IDBoard] = true
+	}
+
+	return s.photos[card.ID], nil
+}
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/adlio/trello"
+	"gotest.tools/assert"
+)
+
+func TestPhotoFieldsPhoto(t *testing.T) {
+	fields := DefaultPhotoFields()
+	taken := time.Date(2020, time.July, 2, 10, 0, 0, 0, time.UTC)
+
+	photo := fields.photo(map[string]interface{}{
+		"Taken":    taken,
+		"Location": " Skagen ",
+		"People":   "Anna, Bo,, ",
+	})
+
+	assert.Equal(t, *photo.Taken, taken)
+	assert.Equal(t, photo.Location, "Skagen")
+	assert.DeepEqual(t, photo.People, []string{"Anna", "Bo"})
+
+	t.Run("Dates written as text", func(t *testing.T) {
+		photo := fields.photo(map[string]interface{}{"Taken": "2019-12-24"})
+		assert.Equal(t, photo.Taken.Format("2006-01-02"), "2019-12-24")
+	})
+
+	t.Run("No values", func(t *testing.T) {
+		assert.DeepEqual(t, fields.photo(nil), Photo{})
+	})
+}
+
+func TestCardPhotoDate(t *testing.T) {
+	due := time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)
+	taken := time.Date(2019, time.June, 1, 0, 0, 0, 0, time.UTC)
+	activity := time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	card := Card{TrelloCard: &trello.Card{DateLastActivity: &activity}}
+	assert.Equal(t, *card.Date(), activity)
+	assert.Assert(t, card.ShownDate() == nil)
+
+	card.TrelloCard.Due = &due
+	assert.Equal(t, *card.Date(), due)
+	assert.Equal(t, *card.ShownDate(), due)
+
+	card.photo = Photo{Taken: &taken}
+	assert.Equal(t, *card.Date(), taken)
+	assert.Equal(t, *card.ShownDate(), taken)
+}
+
+func TestShuffleFilterMatches(t *testing.T) {
+	photo := Photo{Location: "Skagen", People: []string{"Anna", "Bo"}}
+
+	assert.Assert(t, ShuffleFilter{}.Matches(photo))
+	assert.Assert(t, ShuffleFilter{Location: "skagen"}.Matches(photo))
+	assert.Assert(t, ShuffleFilter{Person: "bo"}.Matches(photo))
+	assert.Assert(t, ShuffleFilter{Location: "Skagen", Person: "Anna"}.Matches(photo))
+	assert.Assert(t, !ShuffleFilter{Location: "Paris"}.Matches(photo))
+	assert.Assert(t, !ShuffleFilter{Person: "Carl"}.Matches(photo))
+	assert.Assert(t, !ShuffleFilter{Person: "Anna"}.Matches(Photo{}))
+}
+
+func TestFilteredStrategy(t *testing.T) {
+	source := stubSource{cards: []*Card{
+		&Card{TrelloCard: &trello.Card{ID: "1"}},
+		&Card{TrelloCard: &trello.Card{ID: "2"}},
+		&Card{TrelloCard: &trello.Card{ID: "3"}},
+	}}
+	source.cards[1].customFields = map[string]interface{}{"Location": "Skagen"}
+
+	ctx := NewSourceContext(context.Background(), source)
+
+	candidates := make([]*trello.Card, len(source.cards))
+	for i := range source.cards {
+		candidates[i] = source.cards[i].TrelloCard
+	}
+
+	strategy := NewFilteredStrategy(UniformByCard{}, ShuffleFilter{Location: "Skagen"})
+
+	for i := 0; i < 10; i++ {
+		picked, err := strategy.Pick(ctx, candidates)
+		assert.NilError(t, err)
+		assert.Equal(t, picked, 1)
+	}
+
+	t.Run("Picking several cards stops when the matching ones run out", func(t *testing.T) {
+		indices, err := pickCards(ctx, strategy, candidates, 3)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, indices, []int{1})
+	})
+
+	t.Run("No matching cards", func(t *testing.T) {
+		strategy := NewFilteredStrategy(UniformByCard{}, ShuffleFilter{Person: "Anna"})
+
+		_, err := strategy.Pick(ctx, candidates)
+		assert.Equal(t, err, errNoCandidates)
+	})
+}
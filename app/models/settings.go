@@ -0,0 +1,400 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gallo/app/constants"
+	"gallo/lib"
+	"log"
+	"time"
+
+	"github.com/go-redis/cache/v8"
+)
+
+// Ways of fitting images to the screen, when showing a card
+const (
+	// Images fill the height of the screen, and are panned across
+	ImageFitCover = "cover"
+	// Images are scaled down to fit entirely on the screen
+	ImageFitContain = "contain"
+)
+
+// DateFormats are the layouts dates can be displayed with, by name
+var DateFormats = map[string]string{
+	"long":  "02 January 2006",
+	"short": "02 Jan 2006",
+	"iso":   "2006-01-02",
+	"year":  "2006",
+}
+
+// DefaultDateFormat is the name of the layout used unless set otherwise
+const DefaultDateFormat = "long"
+
+// Bounds of the number of seconds each image is shown
+const (
+	minShowDuration = 1
+	maxShowDuration = 600
+)
+
+// Settings are the preferences of a user, for how photos are shown.
+type Settings struct {
+	// Version is incremented every time the settings are saved, so anything
+	// rendered with an older version can be told apart.
+	Version int `json:"version"`
+
+	// The number of seconds each image of a card is shown
+	ShowDuration int `json:"showDuration"`
+	// The shuffle strategy used, unless one is given in the url
+	ShuffleStrategy string `json:"shuffleStrategy"`
+	// Whether shuffle pages move on to another card, once all images have
+	// been shown
+	AutoRefresh bool   `json:"autoRefresh"`
+	ImageFit    string `json:"imageFit"`
+	// The name of one of DateFormats
+	DateFormat string `json:"dateFormat"`
+	// Whether the description of a card and the captions of its images are
+	// shown on top of the images
+	ShowCaptions bool `json:"showCaptions"`
+	// Whether the latest comments on a card are shown along with the
+	// description, when captions are
+	ShowComments bool `json:"showComments"`
+	// IDs of the boards shown and shuffled, regardless of BoardMarker and
+	// BoardLabel
+	Boards []string `json:"boards"`
+	// IDs of the boards hidden, regardless of BoardMarker and BoardLabel
+	ExcludedBoards []string `json:"excludedBoards"`
+	// Whether boards with the word "gallo" somewhere in the description are
+	// shown. This is how boards were selected before anything else.
+	BoardMarker bool `json:"boardMarker"`
+	// Boards defining a label with this name are shown. Matching is case
+	// insensitive, and an empty name disables the rule.
+	BoardLabel string `json:"boardLabel"`
+	// Which lists are shown and shuffled, by board ID. Boards left out use
+	// DefaultListSelection.
+	Lists map[string]ListSelection `json:"lists"`
+	// IDs of lists where cards with several images are shown with a collage
+	// cover
+	CollageLists []string `json:"collageLists"`
+	// How the cards on list pages are grouped and ordered
+	Grouping Grouping `json:"grouping"`
+	// Names of the custom fields telling about photos, by board ID. Boards left
+	// out use DefaultPhotoFields.
+	PhotoFields map[string]PhotoFields `json:"photoFields"`
+}
+
+// DefaultSettings are the settings of users, who haven't saved any.
+func DefaultSettings() Settings {
+	return Settings{
+		ShowDuration:    15,
+		ShuffleStrategy: UniformByCardStrategy,
+		AutoRefresh:     true,
+		ImageFit:        ImageFitCover,
+		DateFormat:      DefaultDateFormat,
+		Boards:          []string{},
+		ExcludedBoards:  []string{},
+		BoardMarker:     true,
+		Lists:           map[string]ListSelection{},
+		CollageLists:    []string{},
+		Grouping:        DefaultGrouping(),
+		PhotoFields:     map[string]PhotoFields{},
+	}
+}
+
+// Validate returns an error describing the first invalid setting, if any.
+func (s Settings) Validate() error {
+	if s.ShowDuration < minShowDuration || s.ShowDuration > maxShowDuration {
+		return errors.New(fmt.Sprintf(
+			"Show duration must be between %d and %d seconds",
+			minShowDuration,
+			maxShowDuration,
+		))
+	}
+
+	if _, err := NewShuffleStrategy(s.ShuffleStrategy, nil, nil, ""); err != nil {
+		return err
+	}
+
+	if s.ImageFit != ImageFitCover && s.ImageFit != ImageFitContain {
+		return errors.New(fmt.Sprintf("Unknown image fit: %s", s.ImageFit))
+	}
+
+	if _, ok := DateFormats[s.DateFormat]; !ok {
+		return errors.New(fmt.Sprintf("Unknown date format: %s", s.DateFormat))
+	}
+
+	if err := s.Grouping.Validate(); err != nil {
+		return err
+	}
+
+	for _, selection := range s.Lists {
+		if err := selection.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// IncludesBoard tells whether board is shown. A board is shown if it has been
+// opted in, or if it's marked or labelled as set in the settings, unless it has
+// been opted out.
+func (s Settings) IncludesBoard(board *Board) bool {
+	id := board.ID()
+
+	if containsString(s.ExcludedBoards, id) {
+		return false
+	}
+
+	if containsString(s.Boards, id) {
+		return true
+	}
+
+	if s.BoardMarker && board.hasMarker() {
+		return true
+	}
+
+	if s.BoardLabel != "" && board.hasLabel(s.BoardLabel) {
+		return true
+	}
+
+	return false
+}
+
+// IncludedBoards returns the boards which are shown, in the same order.
+func (s Settings) IncludedBoards(boards []*Board) []*Board {
+	included := make([]*Board, 0, len(boards))
+
+	for i := range boards {
+		if s.IncludesBoard(boards[i]) {
+			included = append(included, boards[i])
+		}
+	}
+
+	return included
+}
+
+// IncludeBoard opts the board with the given id in.
+func (s *Settings) IncludeBoard(id string) {
+	s.ExcludedBoards = withoutID(s.ExcludedBoards, id)
+
+	if !containsString(s.Boards, id) {
+		s.Boards = append(s.Boards, id)
+	}
+}
+
+// ExcludeBoard opts the board with the given id out.
+func (s *Settings) ExcludeBoard(id string) {
+	s.Boards = withoutID(s.Boards, id)
+
+	if !containsString(s.ExcludedBoards, id) {
+		s.ExcludedBoards = append(s.ExcludedBoards, id)
+	}
+}
+
+// Returns ids without any occurrences of id.
+func withoutID(ids []string, id string) []string {
+	result := make([]string, 0, len(ids))
+
+	for i := range ids {
+		if ids[i] != id {
+			result = append(result, ids[i])
+		}
+	}
+
+	return result
+}
+
+// ListSelection returns the list selection of the board with the given id.
+func (s Settings) ListSelection(boardID string) ListSelection {
+	if selection, ok := s.Lists[boardID]; ok {
+		return selection
+	}
+
+	return DefaultListSelection()
+}
+
+// PhotoFieldsOf returns the names of the photo custom fields of the board with
+// the given id.
+func (s Settings) PhotoFieldsOf(boardID string) PhotoFields {
+	if fields, ok := s.PhotoFields[boardID]; ok {
+		return fields
+	}
+
+	return DefaultPhotoFields()
+}
+
+// Collages tells whether cards on the list with the given id are shown with
+// collage covers.
+func (s Settings) Collages(listID string) bool {
+	return containsString(s.CollageLists, listID)
+}
+
+// SetCollages turns collage covers on or off for the list with the given id.
+func (s *Settings) SetCollages(listID string, enabled bool) {
+	s.CollageLists = withoutID(s.CollageLists, listID)
+
+	if enabled {
+		s.CollageLists = append(s.CollageLists, listID)
+	}
+}
+
+// FormatDate formats t with the date format of the settings.
+func (s Settings) FormatDate(t time.Time) string {
+	layout, ok := DateFormats[s.DateFormat]
+	if !ok {
+		layout = DateFormats[DefaultDateFormat]
+	}
+
+	return t.Format(layout)
+}
+
+// SettingsStore keeps the settings of each user in cache, keyed by the member
+// ID of the user.
+type SettingsStore struct {
+	cache lib.BlobCache
+}
+
+func NewSettingsStore(cache lib.BlobCache) *SettingsStore {
+	return &SettingsStore{cache}
+}
+
+func settingsKey(memberID string) string {
+	return fmt.Sprintf("settings-%s", memberID)
+}
+
+// Get returns the settings of a member, or DefaultSettings if none have been
+// saved. If they can't be loaded, DefaultSettings are returned along with the
+// error.
+func (s *SettingsStore) Get(ctx context.Context, memberID string) (Settings, error) {
+	settings := DefaultSettings()
+
+	data, err := s.cache.Get(ctx, settingsKey(memberID))
+	if err == cache.ErrCacheMiss {
+		// Nothing saved yet
+		return settings, nil
+	}
+	if err != nil {
+		return settings, err
+	}
+
+	err = json.Unmarshal(data, &settings)
+	if err != nil {
+		return DefaultSettings(), err
+	}
+
+	for id, selection := range settings.Lists {
+		settings.Lists[id] = selection.compile()
+	}
+
+	return settings, nil
+}
+
+// Save validates and stores the settings of a member. The version of settings
+// is set to one past the version currently stored.
+func (s *SettingsStore) Save(ctx context.Context, memberID string, settings *Settings) error {
+	err := settings.Validate()
+	if err != nil {
+		return err
+	}
+
+	current, err := s.Get(ctx, memberID)
+	if err != nil {
+		return err
+	}
+
+	settings.Version = current.Version + 1
+
+	if settings.Boards == nil {
+		settings.Boards = []string{}
+	}
+
+	if settings.ExcludedBoards == nil {
+		settings.ExcludedBoards = []string{}
+	}
+
+	if settings.Lists == nil {
+		settings.Lists = map[string]ListSelection{}
+	}
+
+	if settings.CollageLists == nil {
+		settings.CollageLists = []string{}
+	}
+
+	if settings.PhotoFields == nil {
+		settings.PhotoFields = map[string]PhotoFields{}
+	}
+
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+
+	return s.cache.Set(ctx, settingsKey(memberID), data)
+}
+
+// GetSettings returns the settings of the current user of the source in ctx.
+// If they can't be loaded, DefaultSettings are returned along with the error.
+func GetSettings(ctx context.Context, store *SettingsStore) (Settings, error) {
+	source, err := sourceFromContext(ctx)
+	if err != nil {
+		return DefaultSettings(), err
+	}
+
+	memberID, err := source.GetMemberID()
+	if err != nil {
+		return DefaultSettings(), err
+	}
+
+	return store.Get(ctx, memberID)
+}
+
+// SaveSettings saves the settings of the current user of the source in ctx.
+// The boards selected by them are watched, so that they are shown as they
+// change. Failing to watch them isn't an error, since they are still shown.
+func SaveSettings(ctx context.Context, store *SettingsStore, settings *Settings) error {
+	source, err := sourceFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	memberID, err := source.GetMemberID()
+	if err != nil {
+		return err
+	}
+
+	err = store.Save(ctx, memberID, settings)
+	if err != nil {
+		return err
+	}
+
+	if WebhookCallbackURL != "" {
+		boards, err := GetBoards(ctx)
+		if err == nil {
+			err = WatchBoards(ctx, store, settings.IncludedBoards(boards))
+		}
+
+		if err != nil {
+			log.Println(err)
+		}
+	}
+
+	return nil
+}
+
+// NewSettingsContext returns a copy of ctx carrying the settings of the current
+// user.
+func NewSettingsContext(ctx context.Context, settings Settings) context.Context {
+	return context.WithValue(ctx, constants.SettingsContextKey, settings)
+}
+
+// SettingsFromContext returns the settings stored in ctx, or DefaultSettings if
+// there are none.
+func SettingsFromContext(ctx context.Context) Settings {
+	if settings, ok := ctx.Value(constants.SettingsContextKey).(Settings); ok {
+		return settings
+	}
+
+	return DefaultSettings()
+}
@@ -0,0 +1,201 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/adlio/trello"
+	"gotest.tools/assert"
+)
+
+func TestSettingsValidate(t *testing.T) {
+	assert.NilError(t, DefaultSettings().Validate())
+
+	settings := DefaultSettings()
+	settings.ShowDuration = 0
+	assert.Error(t, settings.Validate(), "Show duration must be between 1 and 600 seconds")
+
+	settings = DefaultSettings()
+	settings.ShuffleStrategy = "foo"
+	assert.Error(t, settings.Validate(), "Unknown shuffle strategy: foo")
+
+	settings = DefaultSettings()
+	settings.ImageFit = "stretch"
+	assert.Error(t, settings.Validate(), "Unknown image fit: stretch")
+
+	settings = DefaultSettings()
+	settings.DateFormat = "foo"
+	assert.Error(t, settings.Validate(), "Unknown date format: foo")
+
+	settings = DefaultSettings()
+	settings.Grouping.By = "week"
+	assert.Error(t, settings.Validate(), "Unknown grouping: week")
+}
+
+func TestSettingsFormatDate(t *testing.T) {
+	date := time.Date(2020, time.March, 4, 0, 0, 0, 0, time.UTC)
+	settings := DefaultSettings()
+
+	assert.Equal(t, settings.FormatDate(date), "04 March 2020")
+
+	settings.DateFormat = "iso"
+	assert.Equal(t, settings.FormatDate(date), "2020-03-04")
+}
+
+func TestSettingsStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewSettingsStore(make(memoryBlobCache))
+
+	settings, err := store.Get(ctx, "member")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, settings, DefaultSettings())
+
+	settings.ShowDuration = 5
+	assert.NilError(t, store.Save(ctx, "member", &settings))
+	assert.Equal(t, settings.Version, 1)
+
+	settings.ImageFit = "stretch"
+	assert.Error(t, store.Save(ctx, "member", &settings), "Unknown image fit: stretch")
+
+	settings, err = store.Get(ctx, "member")
+	assert.NilError(t, err)
+	assert.Equal(t, settings.ShowDuration, 5)
+	assert.Equal(t, settings.ImageFit, ImageFitCover)
+
+	assert.NilError(t, store.Save(ctx, "member", &settings))
+	assert.Equal(t, settings.Version, 2)
+
+	// Name patterns of list selections are compiled as settings are loaded
+	settings.Lists["a"] = ListSelection{NamePattern: "^ips"}
+	assert.NilError(t, store.Save(ctx, "member", &settings))
+
+	settings, err = store.Get(ctx, "member")
+	assert.NilError(t, err)
+	assert.Assert(t, settings.Lists["a"].namePattern != nil)
+
+	// Settings are kept per member
+	settings, err = store.Get(ctx, "other")
+	assert.NilError(t, err)
+	assert.Equal(t, settings.Version, 0)
+}
+
+// unavailableBlobCache is a lib.BlobCache which can't be reached
+type unavailableBlobCache struct{}
+
+func (c unavailableBlobCache) Get(ctx context.Context, key string) ([]byte, error) {
+	return nil, errors.New("connection refused")
+}
+
+func (c unavailableBlobCache) Set(ctx context.Context, key string, value []byte) error {
+	return errors.New("connection refused")
+}
+
+func TestSettingsStoreUnavailable(t *testing.T) {
+	ctx := context.Background()
+	store := NewSettingsStore(unavailableBlobCache{})
+
+	// Defaults are used, but saved settings aren't taken to be missing
+	settings, err := store.Get(ctx, "member")
+	assert.Error(t, err, "connection refused")
+	assert.DeepEqual(t, settings, DefaultSettings())
+
+	assert.Error(t, store.Save(ctx, "member", &settings), "connection refused")
+	assert.Equal(t, settings.Version, 0)
+}
+
+func TestSettingsFromContext(t *testing.T) {
+	assert.DeepEqual(t, SettingsFromContext(context.Background()), DefaultSettings())
+
+	settings := DefaultSettings()
+	settings.Version = 3
+
+	ctx := NewSettingsContext(context.Background(), settings)
+	assert.Equal(t, SettingsFromContext(ctx).Version, 3)
+}
+
+func TestGetSettings(t *testing.T) {
+	store := NewSettingsStore(make(memoryBlobCache))
+	ctx := NewSourceContext(context.Background(), stubSource{})
+
+	settings := DefaultSettings()
+	settings.AutoRefresh = false
+	assert.NilError(t, SaveSettings(ctx, store, &settings))
+
+	settings, err := GetSettings(ctx, store)
+	assert.NilError(t, err)
+	assert.Equal(t, settings.AutoRefresh, false)
+
+	// Stored by the member ID of the source
+	settings, err = store.Get(ctx, "member")
+	assert.NilError(t, err)
+	assert.Equal(t, settings.Version, 1)
+
+	_, err = GetSettings(context.Background(), store)
+	assert.ErrorContains(t, err, "no source in context")
+}
+
+func TestSettingsCollages(t *testing.T) {
+	settings := DefaultSettings()
+	assert.Assert(t, !settings.Collages("123"))
+
+	settings.SetCollages("123", true)
+	settings.SetCollages("123", true)
+	assert.Assert(t, settings.Collages("123"))
+	assert.DeepEqual(t, settings.CollageLists, []string{"123"})
+
+	settings.SetCollages("123", false)
+	assert.Assert(t, !settings.Collages("123"))
+}
+
+func newSettingsTestBoards() []*Board {
+	labelled := &trello.Board{ID: "c"}
+	labelled.LabelNames.Green = "Photos"
+
+	return []*Board{
+		&Board{TrelloBoard: &trello.Board{ID: "a", Desc: "Shown in gallo"}},
+		&Board{TrelloBoard: &trello.Board{ID: "b", Desc: "Not shown"}},
+		&Board{TrelloBoard: labelled},
+	}
+}
+
+func boardIDs(boards []*Board) []string {
+	ids := make([]string, len(boards))
+
+	for i := range boards {
+		ids[i] = boards[i].ID()
+	}
+
+	return ids
+}
+
+func TestSettingsBoards(t *testing.T) {
+	boards := newSettingsTestBoards()
+
+	t.Run("Description marker", func(t *testing.T) {
+		settings := DefaultSettings()
+		assert.DeepEqual(t, boardIDs(settings.IncludedBoards(boards)), []string{"a"})
+
+		settings.BoardMarker = false
+		assert.DeepEqual(t, boardIDs(settings.IncludedBoards(boards)), []string{})
+	})
+
+	t.Run("Label", func(t *testing.T) {
+		settings := DefaultSettings()
+		settings.BoardLabel = "photos"
+		assert.DeepEqual(t, boardIDs(settings.IncludedBoards(boards)), []string{"a", "c"})
+	})
+
+	t.Run("Opt in and out", func(t *testing.T) {
+		settings := DefaultSettings()
+		settings.IncludeBoard("b")
+		settings.ExcludeBoard("a")
+		assert.DeepEqual(t, boardIDs(settings.IncludedBoards(boards)), []string{"b"})
+
+		settings.IncludeBoard("a")
+		assert.DeepEqual(t, settings.Boards, []string{"b", "a"})
+		assert.DeepEqual(t, settings.ExcludedBoards, []string{})
+		assert.DeepEqual(t, boardIDs(settings.IncludedBoards(boards)), []string{"a", "b"})
+	})
+}
@@ -0,0 +1,356 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gallo/lib"
+	"hash/fnv"
+	"log"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/adlio/trello"
+)
+
+// Names of the shuffle strategies, as used in the strategy query parameter
+const (
+	UniformByCardStrategy     = "uniform-by-card"
+	UniformByListStrategy     = "uniform-by-list"
+	WeightedByRecencyStrategy = "weighted-by-recency"
+	NoRepeatStrategy          = "no-repeat"
+)
+
+// ShuffleStrategyNames lists the names of all shuffle strategies
+var ShuffleStrategyNames = []string{
+	UniformByCardStrategy,
+	UniformByListStrategy,
+	WeightedByRecencyStrategy,
+	NoRepeatStrategy,
+}
+
+// The age at which a card is half as likely to be picked as a new one, with
+// WeightedByRecency
+const recencyHalfLife = 365 * 24 * time.Hour
+
+// Cards without a date are weighted as if they were this many half-lives old
+const undatedHalfLives = 10
+
+// ShuffleStrategy decides how a random card is picked among candidates.
+type ShuffleStrategy interface {
+	// Pick returns the index of the chosen card in cards.
+	Pick(ctx context.Context, cards []*trello.Card) (int, error)
+}
+
+var errNoCandidates = errors.New("No cards to pick from")
+
+// NewSeededRand creates a source of random numbers from a seed of any length,
+// for picking cards reproducibly.
+func NewSeededRand(seed string) *rand.Rand {
+	h := fnv.New64a()
+	h.Write([]byte(seed))
+
+	return rand.New(rand.NewSource(int64(h.Sum64())))
+}
+
+// Returns a random int in [0, n) from rnd, or from the global source of
+// math/rand if rnd is nil.
+func randIntn(rnd *rand.Rand, n int) int {
+	if rnd == nil {
+		return rand.Intn(n)
+	}
+
+	return rnd.Intn(n)
+}
+
+// Returns a random float64 in [0, 1) from rnd, or from the global source of
+// math/rand if rnd is nil.
+func randFloat64(rnd *rand.Rand) float64 {
+	if rnd == nil {
+		return rand.Float64()
+	}
+
+	return rnd.Float64()
+}
+
+// UniformByCard picks any card with equal probability.
+type UniformByCard struct {
+	// Source of random numbers. Nil means the global source of math/rand.
+	Rand *rand.Rand
+}
+
+func (s UniformByCard) Pick(ctx context.Context, cards []*trello.Card) (int, error) {
+	if len(cards) == 0 {
+		return 0, errNoCandidates
+	}
+
+	return randIntn(s.Rand, len(cards)), nil
+}
+
+// UniformByList picks a list with equal probability, and then a card on that
+// list. Cards on small lists are thereby picked more often than cards on large
+// ones.
+type UniformByList struct {
+	// Source of random numbers. Nil means the global source of math/rand.
+	Rand *rand.Rand
+}
+
+func (s UniformByList) Pick(ctx context.Context, cards []*trello.Card) (int, error) {
+	if len(cards) == 0 {
+		return 0, errNoCandidates
+	}
+
+	var listIDs []string
+	indicesByList := make(map[string][]int)
+
+	for i := range cards {
+		if _, ok := indicesByList[cards[i].IDList]; !ok {
+			listIDs = append(listIDs, cards[i].IDList)
+		}
+
+		indicesByList[cards[i].IDList] = append(indicesByList[cards[i].IDList], i)
+	}
+
+	indices := indicesByList[listIDs[randIntn(s.Rand, len(listIDs))]]
+
+	return indices[randIntn(s.Rand, len(indices))], nil
+}
+
+// WeightedByRecency picks recent cards more often than old ones. The weight of
+// a card halves for every recencyHalfLife of its age, going by the same date as
+// Card.Date.
+type WeightedByRecency struct {
+	// The time ages are measured from. Zero means now.
+	Now time.Time
+
+	// Source of random numbers. Nil means the global source of math/rand.
+	Rand *rand.Rand
+}
+
+func (s WeightedByRecency) Pick(ctx context.Context, cards []*trello.Card) (int, error) {
+	if len(cards) == 0 {
+		return 0, errNoCandidates
+	}
+
+	now := s.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	weights := make([]float64, len(cards))
+	var total float64
+
+	for i := range cards {
+		halfLives := float64(undatedHalfLives)
+
+		if date := cardDate(cards[i]); date != nil {
+			halfLives = math.Max(0, float64(now.Sub(*date))/float64(recencyHalfLife))
+		}
+
+		weights[i] = math.Pow(0.5, halfLives)
+		total += weights[i]
+	}
+
+	r := randFloat64(s.Rand) * total
+
+	for i := range weights {
+		r -= weights[i]
+
+		if r < 0 {
+			return i, nil
+		}
+	}
+
+	return len(cards) - 1, nil
+}
+
+// The most cards kept in a ShuffleBag. The ones picked first are dropped from
+// it beyond that.
+const MaxShuffleBagSize = 2000
+
+// ShuffleBag doesn't repeat any card until all of them have been picked. The
+// cards already picked are kept in cache under key, in the order they were
+// picked, so the bag can follow a session across requests. Among the remaining
+// cards, one is picked by Strategy.
+type ShuffleBag struct {
+	Strategy ShuffleStrategy
+
+	cache lib.BlobCache
+	key   string
+}
+
+func NewShuffleBag(strategy ShuffleStrategy, cache lib.BlobCache, key string) *ShuffleBag {
+	return &ShuffleBag{strategy, cache, key}
+}
+
+func (s *ShuffleBag) Pick(ctx context.Context, cards []*trello.Card) (int, error) {
+	if len(cards) == 0 {
+		return 0, errNoCandidates
+	}
+
+	var ids []string
+
+	data, err := s.cache.Get(ctx, s.key)
+	if err == nil {
+		if json.Unmarshal(data, &ids) != nil {
+			ids = nil
+		}
+	}
+
+	remaining, remainingIndices := unpickedCards(cards, ids)
+
+	// Start over once every card has been picked, but keep the latest half of
+	// them in the bag, so they aren't repeated right away
+	if len(remaining) == 0 {
+		ids = emptyShuffleBag(ids, cards, len(cards)/2)
+		remaining, remainingIndices = unpickedCards(cards, ids)
+	}
+
+	i, err := s.Strategy.Pick(ctx, remaining)
+	if err != nil {
+		return 0, err
+	}
+
+	ids = append(ids, remaining[i].ID)
+
+	if len(ids) > MaxShuffleBagSize {
+		ids = ids[len(ids)-MaxShuffleBagSize:]
+	}
+
+	data, err = json.Marshal(ids)
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.cache.Set(ctx, s.key, data)
+	if err != nil {
+		log.Println(err)
+	}
+
+	return remainingIndices[i], nil
+}
+
+// Returns the cards which aren't among the picked ids, along with their
+// indices in cards.
+func unpickedCards(cards []*trello.Card, ids []string) ([]*trello.Card, []int) {
+	picked := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		picked[id] = true
+	}
+
+	var remaining []*trello.Card
+	var remainingIndices []int
+
+	for i := range cards {
+		if !picked[cards[i].ID] {
+			remaining = append(remaining, cards[i])
+			remainingIndices = append(remainingIndices, i)
+		}
+	}
+
+	return remaining, remainingIndices
+}
+
+// Empties the bag of picked ids of cards, except for the last keep of them.
+// Cards which aren't candidates are kept, since the candidates can be a subset
+// of the bag, e.g. when picking the rest of a playlist.
+func emptyShuffleBag(ids []string, cards []*trello.Card, keep int) []string {
+	candidates := make(map[string]bool, len(cards))
+	for i := range cards {
+		candidates[cards[i].ID] = true
+	}
+
+	kept := make([]string, 0, len(ids))
+
+	for i := len(ids) - 1; i >= 0; i-- {
+		if !candidates[ids[i]] {
+			kept = append(kept, ids[i])
+		} else if keep > 0 {
+			kept = append(kept, ids[i])
+			keep--
+		}
+	}
+
+	// Back to the order they were picked in
+	for i, j := 0, len(kept)-1; i < j; i, j = i+1, j-1 {
+		kept[i], kept[j] = kept[j], kept[i]
+	}
+
+	return kept
+}
+
+// NewShuffleStrategy returns the strategy with the given name, using rnd as
+// the source of random numbers. A no-repeat strategy stores its bag in cache
+// under bagKey, and picks uniformly by card among the remaining cards.
+func NewShuffleStrategy(
+	name string,
+	rnd *rand.Rand,
+	cache lib.BlobCache,
+	bagKey string,
+) (ShuffleStrategy, error) {
+	switch name {
+	case UniformByCardStrategy:
+		return UniformByCard{Rand: rnd}, nil
+	case UniformByListStrategy:
+		return UniformByList{Rand: rnd}, nil
+	case WeightedByRecencyStrategy:
+		return WeightedByRecency{Rand: rnd}, nil
+	case NoRepeatStrategy:
+		return NewShuffleBag(UniformByCard{Rand: rnd}, cache, bagKey), nil
+	default:
+		return nil, errors.New(fmt.Sprintf("Unknown shuffle strategy: %s", name))
+	}
+}
+
+// Picks up to n different cards with strategy, and returns their indices in
+// the order they were picked.
+func pickCards(
+	ctx context.Context,
+	strategy ShuffleStrategy,
+	cards []*trello.Card,
+	n int,
+) ([]int, error) {
+	if len(cards) == 0 {
+		return nil, errNoCandidates
+	}
+
+	remaining := make([]*trello.Card, len(cards))
+	remainingIndices := make([]int, len(cards))
+
+	for i := range cards {
+		remaining[i] = cards[i]
+		remainingIndices[i] = i
+	}
+
+	indices := make([]int, 0, n)
+
+	for len(indices) < n && len(remaining) > 0 {
+		i, err := strategy.Pick(ctx, remaining)
+		if err == errNoCandidates && len(indices) > 0 {
+			// Strategies picking among some of the cards can run out early
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		indices = append(indices, remainingIndices[i])
+
+		remaining = append(remaining[:i], remaining[i+1:]...)
+		remainingIndices = append(remainingIndices[:i], remainingIndices[i+1:]...)
+	}
+
+	return indices, nil
+}
+
+// Returns the trello cards of cards, for use with a ShuffleStrategy.
+func trelloCards(cards []*Card) []*trello.Card {
+	trelloCards := make([]*trello.Card, len(cards))
+
+	for i := range cards {
+		trelloCards[i] = cards[i].TrelloCard
+	}
+
+	return trelloCards
+}
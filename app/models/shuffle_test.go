@@ -0,0 +1,195 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/adlio/trello"
+	"gotest.tools/assert"
+)
+
+func newShuffleTestCards() []*trello.Card {
+	now := time.Now()
+	old := now.Add(-100 * recencyHalfLife)
+
+	return []*trello.Card{
+		&trello.Card{ID: "1", IDList: "a", DateLastActivity: &now},
+		&trello.Card{ID: "2", IDList: "a", DateLastActivity: &old},
+		&trello.Card{ID: "3", IDList: "b", DateLastActivity: &old},
+	}
+}
+
+func TestShuffleStrategies(t *testing.T) {
+	strategies := map[string]ShuffleStrategy{
+		UniformByCardStrategy:     UniformByCard{},
+		UniformByListStrategy:     UniformByList{},
+		WeightedByRecencyStrategy: WeightedByRecency{},
+		NoRepeatStrategy:          NewShuffleBag(UniformByCard{}, make(memoryBlobCache), "bag"),
+	}
+
+	for name, strategy := range strategies {
+		t.Run(name, func(t *testing.T) {
+			_, err := strategy.Pick(context.Background(), nil)
+			assert.Error(t, err, "No cards to pick from")
+
+			i, err := strategy.Pick(context.Background(), newShuffleTestCards())
+			assert.NilError(t, err)
+			assert.Assert(t, i >= 0 && i < 3)
+		})
+	}
+}
+
+func TestUniformByList(t *testing.T) {
+	cards := newShuffleTestCards()
+	counts := make(map[string]int)
+
+	for n := 0; n < 1000; n++ {
+		i, err := UniformByList{}.Pick(context.Background(), cards)
+		assert.NilError(t, err)
+
+		counts[cards[i].IDList]++
+	}
+
+	// The only card on list b should be picked about half the time
+	assert.Assert(t, counts["b"] > 400 && counts["b"] < 600, counts)
+}
+
+func TestWeightedByRecency(t *testing.T) {
+	cards := newShuffleTestCards()
+
+	// Old cards have a weight of 2^-100, so they'll practically never be picked
+	for n := 0; n < 100; n++ {
+		i, err := WeightedByRecency{}.Pick(context.Background(), cards)
+		assert.NilError(t, err)
+		assert.Equal(t, cards[i].ID, "1")
+	}
+}
+
+func TestShuffleBag(t *testing.T) {
+	cache := make(memoryBlobCache)
+	cards := newShuffleTestCards()
+
+	var last string
+
+	t.Run("Doesn't repeat until exhausted", func(t *testing.T) {
+		seen := make(map[string]bool)
+
+		for n := 0; n < len(cards); n++ {
+			// A new bag for each pick, like a new request
+			bag := NewShuffleBag(UniformByCard{}, cache, "bag")
+
+			i, err := bag.Pick(context.Background(), cards)
+			assert.NilError(t, err)
+			assert.Assert(t, !seen[cards[i].ID], "%s picked twice", cards[i].ID)
+
+			seen[cards[i].ID] = true
+			last = cards[i].ID
+		}
+	})
+
+	t.Run("Starts over when exhausted, without repeating the latest picks", func(t *testing.T) {
+		bag := NewShuffleBag(UniformByCard{}, cache, "bag")
+
+		i, err := bag.Pick(context.Background(), cards)
+		assert.NilError(t, err)
+		assert.Assert(t, cards[i].ID != last)
+
+		var ids []string
+		assert.NilError(t, json.Unmarshal(cache["bag"], &ids))
+		assert.DeepEqual(t, ids, []string{last, cards[i].ID})
+	})
+
+	t.Run("Keeps cards which aren't candidates when starting over", func(t *testing.T) {
+		cache := make(memoryBlobCache)
+		cache["bag"] = []byte(`["1", "2", "3"]`)
+
+		bag := NewShuffleBag(UniformByCard{}, cache, "bag")
+
+		i, err := bag.Pick(context.Background(), cards[1:])
+		assert.NilError(t, err)
+		assert.Equal(t, cards[1:][i].ID, "2")
+
+		var ids []string
+		assert.NilError(t, json.Unmarshal(cache["bag"], &ids))
+		assert.DeepEqual(t, ids, []string{"1", "3", "2"})
+	})
+
+	t.Run("Drops the first picks beyond the maximum size", func(t *testing.T) {
+		cache := make(memoryBlobCache)
+
+		ids := make([]string, MaxShuffleBagSize)
+		for n := range ids {
+			ids[n] = fmt.Sprintf("old-%d", n)
+		}
+
+		data, err := json.Marshal(ids)
+		assert.NilError(t, err)
+		cache["bag"] = data
+
+		bag := NewShuffleBag(UniformByCard{}, cache, "bag")
+
+		_, err = bag.Pick(context.Background(), cards)
+		assert.NilError(t, err)
+
+		assert.NilError(t, json.Unmarshal(cache["bag"], &ids))
+		assert.Equal(t, len(ids), MaxShuffleBagSize)
+		assert.Equal(t, ids[0], "old-1")
+	})
+}
+
+func TestSeededShuffle(t *testing.T) {
+	cards := newShuffleTestCards()
+
+	pick := func(seed string) []string {
+		strategy := UniformByCard{Rand: NewSeededRand(seed)}
+		ids := make([]string, 5)
+
+		for n := range ids {
+			i, err := strategy.Pick(context.Background(), cards)
+			assert.NilError(t, err)
+
+			ids[n] = cards[i].ID
+		}
+
+		return ids
+	}
+
+	assert.DeepEqual(t, pick("foo"), pick("foo"))
+	assert.DeepEqual(t, pick("foo"), []string{"2", "3", "1", "3", "1"})
+}
+
+func TestNewShuffleStrategy(t *testing.T) {
+	_, err := NewShuffleStrategy("foo", nil, nil, "")
+	assert.Error(t, err, "Unknown shuffle strategy: foo")
+
+	strategy, err := NewShuffleStrategy(UniformByListStrategy, nil, nil, "")
+	assert.NilError(t, err)
+	assert.Equal(t, strategy, UniformByList{})
+}
+
+func TestPickCards(t *testing.T) {
+	ctx := context.Background()
+	cards := newShuffleTestCards()
+
+	_, err := pickCards(ctx, UniformByCard{}, nil, 2)
+	assert.Error(t, err, "No cards to pick from")
+
+	indices, err := pickCards(ctx, UniformByCard{}, cards, 2)
+	assert.NilError(t, err)
+	assert.Equal(t, len(indices), 2)
+	assert.Assert(t, indices[0] != indices[1])
+
+	// No more cards than there are candidates are picked, and none twice
+	indices, err = pickCards(ctx, UniformByCard{}, cards, 5)
+	assert.NilError(t, err)
+	assert.Equal(t, len(indices), 3)
+
+	seen := make(map[int]bool)
+	for _, i := range indices {
+		assert.Assert(t, !seen[i])
+		seen[i] = true
+	}
+}
@@ -0,0 +1,141 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"gallo/app/constants"
+	"io"
+	"os"
+
+	"github.com/adlio/trello"
+)
+
+// Source is the backend from which boards (collections), lists (albums) and
+// cards (photos) along with their image previews are retrieved.
+//
+// Data is still represented by the structs from adlio/trello, which means any
+// Source implementation should populate those, even if the data doesn't
+// originate from Trello.
+type Source interface {
+	// GetMemberID returns the ID of the current user, which e.g. settings are
+	// stored by.
+	GetMemberID() (string, error)
+
+	// GetBoards returns all boards available to the current user, with lists
+	// sideloaded.
+	GetBoards() ([]*Board, error)
+	GetBoard(id string) (*Board, error)
+	GetList(id string) (*List, error)
+	GetCard(id string) (*Card, error)
+
+	GetBoardLists(board *Board) ([]*List, error)
+	// GetBoardCards returns all cards on a board, with attachments sideloaded.
+	GetBoardCards(board *Board) ([]*Card, error)
+	// GetListCards returns all displayable cards on a list, with attachments
+	// sideloaded.
+	GetListCards(list *List) ([]*Card, error)
+	// GetListCardsPage returns the displayable cards among up to limit cards on
+	// a list, which follow the card with the id before, or the first ones if
+	// before is empty. Along with them is the id to pass as before for the
+	// following page, which is empty on the last page.
+	GetListCardsPage(list *List, before string, limit int) ([]*Card, string, error)
+	// GetBoardsCards returns bare cards, without attachments, for all of the
+	// given boards. It is meant for cheaply selecting cards across many boards,
+	// before fetching the full card with GetCard.
+	GetBoardsCards(boards []*Board) ([]*trello.Card, error)
+	// GetCustomFields returns the values of the custom fields of the cards with
+	// the given IDs on a board, or of all of its cards if cardIDs is nil, by
+	// card ID and then by the name of the field.
+	GetCustomFields(boardID string, cardIDs []string) (map[string]map[string]interface{}, error)
+	// GetCardComments returns up to limit of the latest comments on a card,
+	// newest first.
+	GetCardComments(cardID string, limit int) ([]*trello.Action, error)
+
+	// GetAttachment returns an attachment on a card, if the current user can
+	// access it. Otherwise the error is one IsNotFound tells.
+	GetAttachment(cardID, id string) (*trello.Attachment, error)
+	// OpenAttachment opens the original file of an attachment on a card.
+	OpenAttachment(cardID, id string) (io.ReadCloser, error)
+	// OpenPreview opens the smallest version of an attachment, which is at
+	// least the given width, if the source has any. Otherwise the original is
+	// opened.
+	OpenPreview(cardID, id string, width int) (io.ReadCloser, error)
+}
+
+// NewSourceContext returns a copy of ctx in which source is used by model
+// functions like GetBoard, GetList and GetCard.
+func NewSourceContext(ctx context.Context, source Source) context.Context {
+	return context.WithValue(ctx, constants.SourceContextKey, source)
+}
+
+// ErrNotFound is returned by sources for what doesn't exist.
+var ErrNotFound = errors.New("Not found")
+
+// IsNotFound tells whether err is because something doesn't exist, or the
+// current user can't access it, as opposed to the source failing.
+func IsNotFound(err error) bool {
+	return err == ErrNotFound ||
+		trello.IsNotFound(err) ||
+		trello.IsPermissionDenied(err) ||
+		os.IsNotExist(err)
+}
+
+// GetAttachment returns an attachment on a card from the source in ctx, if the
+// current user can access it. Anything derived from an attachment is checked
+// with this, before it's served from a cache.
+func GetAttachment(ctx context.Context, cardID, id string) (*trello.Attachment, error) {
+	source, err := sourceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return source.GetAttachment(cardID, id)
+}
+
+// OpenAttachment opens the original file of an attachment on a card, from the
+// source in ctx.
+func OpenAttachment(ctx context.Context, cardID, id string) (io.ReadCloser, error) {
+	source, err := sourceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return source.OpenAttachment(cardID, id)
+}
+
+// OpenPreview opens the smallest version of an attachment on a card, which is
+// at least the given width, from the source in ctx.
+func OpenPreview(ctx context.Context, cardID, id string, width int) (io.ReadCloser, error) {
+	source, err := sourceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return source.OpenPreview(cardID, id, width)
+}
+
+// sourceFromContext finds the Source stored in ctx. If none has been set, but a
+// Trello client is present, a TrelloSource for that client is returned.
+func sourceFromContext(ctx context.Context) (Source, error) {
+	if source, ok := ctx.Value(constants.SourceContextKey).(Source); ok {
+		return source, nil
+	}
+
+	client, err := clientFromContext(ctx)
+	if err != nil {
+		return nil, errors.New("no source in context")
+	}
+
+	return NewTrelloSource(client), nil
+}
+
+// defaultSource makes models constructed without a source, e.g. directly from
+// structs returned by adlio/trello, fall back to fetching nested resources from
+// Trello.
+func defaultSource(source Source) Source {
+	if source == nil {
+		return &TrelloSource{}
+	}
+
+	return source
+}
@@ -0,0 +1,168 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/adlio/trello"
+	"gotest.tools/assert"
+)
+
+// stubSource is a Source returning canned data, which makes it possible to
+// exercise model functions without mocking http responses.
+type stubSource struct {
+	boards []*Board
+	cards  []*Card
+}
+
+func (s stubSource) GetMemberID() (string, error) {
+	return "member", nil
+}
+
+func (s stubSource) GetBoards() ([]*Board, error) {
+	return s.boards, nil
+}
+
+func (s stubSource) GetBoard(id string) (*Board, error) {
+	for _, board := range s.boards {
+		if board.ID() == id {
+			return board, nil
+		}
+	}
+
+	return nil, errors.New("board not found")
+}
+
+func (s stubSource) GetList(id string) (*List, error) {
+	return nil, errors.New("list not found")
+}
+
+func (s stubSource) GetCard(id string) (*Card, error) {
+	for _, card := range s.cards {
+		if card.ID() == id {
+			return card, nil
+		}
+	}
+
+	return nil, errors.New("card not found")
+}
+
+func (s stubSource) GetBoardLists(board *Board) ([]*List, error) {
+	return []*List{}, nil
+}
+
+func (s stubSource) GetBoardCards(board *Board) ([]*Card, error) {
+	return s.cards, nil
+}
+
+func (s stubSource) GetListCards(list *List) ([]*Card, error) {
+	return s.cards, nil
+}
+
+func (s stubSource) GetListCardsPage(list *List, before string, limit int) ([]*Card, string, error) {
+	start := 0
+	for i := range s.cards {
+		if s.cards[i].ID() == before {
+			start = i + 1
+		}
+	}
+
+	if start+limit >= len(s.cards) {
+		return s.cards[start:], "", nil
+	}
+
+	return s.cards[start : start+limit], s.cards[start+limit-1].ID(), nil
+}
+
+func (s stubSource) GetBoardsCards(boards []*Board) ([]*trello.Card, error) {
+	trelloCards := make([]*trello.Card, len(s.cards))
+
+	for i := range s.cards {
+		trelloCards[i] = s.cards[i].TrelloCard
+	}
+
+	return trelloCards, nil
+}
+
+func (s stubSource) GetCustomFields(boardID string, cardIDs []string) (map[string]map[string]interface{}, error) {
+	values := make(map[string]map[string]interface{})
+
+	for i := range s.cards {
+		values[s.cards[i].ID()] = s.cards[i].customFields
+	}
+
+	return values, nil
+}
+
+func (s stubSource) GetCardComments(cardID string, limit int) ([]*trello.Action, error) {
+	return []*trello.Action{}, nil
+}
+
+func (s stubSource) GetAttachment(cardID, id string) (*trello.Attachment, error) {
+	return &trello.Attachment{ID: id}, nil
+}
+
+func (s stubSource) OpenAttachment(cardID, id string) (io.ReadCloser, error) {
+	return ioutil.NopCloser(strings.NewReader(id)), nil
+}
+
+func (s stubSource) OpenPreview(cardID, id string, width int) (io.ReadCloser, error) {
+	return s.OpenAttachment(cardID, id)
+}
+
+// -----------------------------------------------------------------------------
+
+func Test_sourceFromContext(t *testing.T) {
+	t.Run("No source or client", func(t *testing.T) {
+		_, err := sourceFromContext(context.Background())
+		assert.ErrorContains(t, err, "no source in context")
+	})
+
+	t.Run("Falls back to Trello client", func(t *testing.T) {
+		source, err := sourceFromContext(defaultContext)
+		assert.NilError(t, err)
+		trelloSource, ok := source.(*TrelloSource)
+		assert.Assert(t, ok)
+		assert.Equal(t, trelloSource.client, trelloClient)
+	})
+
+	t.Run("Source set", func(t *testing.T) {
+		in := &stubSource{}
+		ctx := NewSourceContext(defaultContext, in)
+
+		out, err := sourceFromContext(ctx)
+		assert.NilError(t, err)
+		assert.Equal(t, out, Source(in))
+	})
+}
+
+func TestGetBoardFromSource(t *testing.T) {
+	source := stubSource{
+		boards: []*Board{
+			&Board{TrelloBoard: &trello.Board{ID: "1", Desc: "gallo"}},
+			&Board{TrelloBoard: &trello.Board{ID: "2"}},
+		},
+	}
+	ctx := NewSourceContext(context.Background(), source)
+
+	t.Run("Marked board", func(t *testing.T) {
+		board, err := GetBoard(ctx, "1")
+		assert.NilError(t, err)
+		assert.Equal(t, board.ID(), "1")
+	})
+
+	t.Run("Unmarked board", func(t *testing.T) {
+		board, err := GetBoard(ctx, "2")
+		assert.NilError(t, err)
+		assert.Equal(t, board.ID(), "2")
+	})
+
+	t.Run("Missing board", func(t *testing.T) {
+		_, err := GetBoard(ctx, "3")
+		assert.ErrorContains(t, err, "board not found")
+	})
+}
@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"math/rand"
 	"strings"
 	"gallo/lib"
 
@@ -33,22 +32,17 @@ func boardsCardsBatchURLs(boards []*Board) string {
 }
 
 // Retrieve cards from up to ten Boards at once via a batch request
-func getBoardCardsBatchLimited(ctx context.Context, boards []*Board) ([]*trello.Card, error) {
+func getBoardCardsBatchLimited(client *trello.Client, boards []*Board) ([]*trello.Card, error) {
 	if len(boards) > 10 {
 		return nil, errors.New("Max 10 boards should be supplied")
 	}
 
-	client, err := clientFromContext(ctx)
-	if err != nil {
-		return nil, err
-	}
-
 	args := trello.Defaults()
 	args["urls"] = boardsCardsBatchURLs(boards)
 
 	var responses []map[string]interface{}
 
-	err = client.Get("batch", args, &responses)
+	err := client.Get("batch", args, &responses)
 	if err != nil {
 		return nil, err
 	}
@@ -82,7 +76,7 @@ func getBoardCardsBatchLimited(ctx context.Context, boards []*Board) ([]*trello.
 }
 
 // Retrieve cards from multiple Boards
-func getBoardCardsBatch(ctx context.Context, boards []*Board) ([]*trello.Card, error) {
+func getBoardCardsBatch(client *trello.Client, boards []*Board) ([]*trello.Card, error) {
 	defer lib.Track(lib.RunningTime("getBoardCardsBatch"))
 
 	trelloCards := make([]*trello.Card, 0)
@@ -95,7 +89,7 @@ func getBoardCardsBatch(ctx context.Context, boards []*Board) ([]*trello.Card, e
 			j = len(boards)
 		}
 
-		cards, err := getBoardCardsBatchLimited(ctx, boards[i:j])
+		cards, err := getBoardCardsBatchLimited(client, boards[i:j])
 		if err != nil {
 			return nil, err
 		}
@@ -106,12 +100,65 @@ func getBoardCardsBatch(ctx context.Context, boards []*Board) ([]*trello.Card, e
 	return trelloCards, nil
 }
 
-// Determine if a card belongs to a list which is subscribed to (watched)
-func cardOnSubscribedList(card *trello.Card, boards []*Board) bool {
+// Retrieve the custom field items of cards, in batch requests of up to ten
+// cards. Only the IDs and custom field items of the cards returned are set.
+func getCardsCustomFieldItemsBatch(client *trello.Client, cardIDs []string) ([]*trello.Card, error) {
+	defer lib.Track(lib.RunningTime("getCardsCustomFieldItemsBatch"))
+
+	trelloCards := make([]*trello.Card, 0, len(cardIDs))
+
+	for i := 0; i < len(cardIDs); i += 10 {
+		j := i + 10
+
+		if j > len(cardIDs) {
+			j = len(cardIDs)
+		}
+
+		urls := make([]string, 0, j-i)
+		for _, id := range cardIDs[i:j] {
+			urls = append(urls, fmt.Sprintf("/cards/%s/customFieldItems", id))
+		}
+
+		args := trello.Defaults()
+		args["urls"] = strings.Join(urls, ",")
+
+		var responses []map[string]json.RawMessage
+
+		err := client.Get("batch", args, &responses)
+		if err != nil {
+			return nil, err
+		}
+
+		// Responses are in the order of the urls
+		for k, response := range responses {
+			value, ok := response["200"]
+			if !ok || i+k >= j {
+				continue
+			}
+
+			trelloCard := &trello.Card{ID: cardIDs[i+k]}
+
+			err = json.Unmarshal(value, &trelloCard.CustomFieldItems)
+			if err != nil {
+				return nil, err
+			}
+
+			trelloCards = append(trelloCards, trelloCard)
+		}
+	}
+
+	return trelloCards, nil
+}
+
+// Determine if a card belongs to a list which is selected by the settings in
+// ctx
+func cardOnSelectedList(ctx context.Context, card *trello.Card, boards []*Board) bool {
 	for i := range boards {
+		selection := listSelection(ctx, boards[i].ID())
+
 		for j := range boards[i].Lists {
 			if card.IDList == boards[i].Lists[j].TrelloList.ID &&
-				boards[i].Lists[j].TrelloList.Subscribed {
+				selection.Includes(boards[i].Lists[j]) {
 				return true
 			}
 		}
@@ -119,31 +166,92 @@ func cardOnSubscribedList(card *trello.Card, boards []*Board) bool {
 	return false
 }
 
-// Returns a random Card, belonging to a Subscribed List, from any Board. Any
-// card fitting the above criteria can be returned with equal probability.
-func GetRandomCard(ctx context.Context, boards []*Board) (*Card, error) {
+// Returns a random Card, belonging to a selected List, from any Board. The card
+// is picked among the ones fitting the above criteria with strategy.
+func GetRandomCard(ctx context.Context, boards []*Board, strategy ShuffleStrategy) (*Card, error) {
+	cards, err := GetRandomCards(ctx, boards, strategy, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	return cards[0], nil
+}
+
+// Returns up to n different random Cards in the same manner as GetRandomCard.
+func GetRandomCards(
+	ctx context.Context,
+	boards []*Board,
+	strategy ShuffleStrategy,
+	n int,
+) ([]*Card, error) {
+	source, err := sourceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	// Get all cards from provided boards
-	trelloCards, err := getBoardCardsBatch(ctx, boards)
+	trelloCards, err := source.GetBoardsCards(boards)
 	if err != nil {
 		return nil, err
 	}
 
-	// Only consider cards on lists which are subscribed to
+	// Only consider cards on lists which are selected, and which have a cover
 	filteredCards := make([]*trello.Card, 0)
 
 	for i := range trelloCards {
-		if cardOnSubscribedList(trelloCards[i], boards) {
+		if hasCover(trelloCards[i]) && cardOnSelectedList(ctx, trelloCards[i], boards) {
 			filteredCards = append(filteredCards, trelloCards[i])
 		}
 	}
 
-	if len(filteredCards) == 0 {
+	cards := make([]*Card, 0, n)
+
+	// Cards are judged by their number of attachments until they're fetched,
+	// so the picks without a cover after all are left out, and picked again
+	for len(cards) < n && len(filteredCards) > 0 {
+		indices, err := pickCards(ctx, strategy, filteredCards, n-len(cards))
+		if err == errNoCandidates && len(cards) > 0 {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		for _, i := range indices {
+			// Now that we have the card ID, fetch it with attachments sideloaded
+			card, err := source.GetCard(filteredCards[i].ID)
+			if isNoCoverError(err) {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+
+			cards = append(cards, card)
+		}
+
+		filteredCards = removeCards(filteredCards, indices)
+	}
+
+	if len(cards) == 0 {
 		return nil, errors.New("No cards found for GetRandomCard")
 	}
 
-	// Pick one at random
-	trelloCard := filteredCards[rand.Intn(len(filteredCards))]
+	return cards, nil
+}
+
+// Returns cards without the ones at indices.
+func removeCards(cards []*trello.Card, indices []int) []*trello.Card {
+	removed := make(map[int]bool, len(indices))
+	for _, i := range indices {
+		removed[i] = true
+	}
+
+	remaining := make([]*trello.Card, 0, len(cards)-len(indices))
+
+	for i := range cards {
+		if !removed[i] {
+			remaining = append(remaining, cards[i])
+		}
+	}
 
-	// Now that we have the card ID, fetch it with attachments sideloaded
-	return GetCard(ctx, trelloCard.ID)
+	return remaining
 }
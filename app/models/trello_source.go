@@ -0,0 +1,483 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adlio/trello"
+)
+
+// The http client used to download attachments. Attachments can be large, so
+// these responses bypass the caching transport of the Trello client.
+var attachmentClient = &http.Client{Timeout: 30 * time.Second}
+
+// The IDs of the members by token. A token always belongs to the same member,
+// so an ID is only requested the first time its token is used, instead of on
+// every request.
+var memberIDs = struct {
+	sync.Mutex
+	ids map[string]string
+}{ids: map[string]string{}}
+
+// TrelloSource is the Source backed by the Trello API, for the member
+// identified by the token of the client.
+type TrelloSource struct {
+	client *trello.Client
+}
+
+func NewTrelloSource(client *trello.Client) *TrelloSource {
+	return &TrelloSource{client}
+}
+
+// Returns the client, or an error if the source was created without one. Nested
+// resources can still be fetched in that case, since adlio/trello keeps a
+// reference to the client on each struct it returns.
+func (s *TrelloSource) getClient() (*trello.Client, error) {
+	if s.client == nil {
+		return nil, errors.New("Trello client is nil")
+	}
+
+	return s.client, nil
+}
+
+func (s *TrelloSource) GetMemberID() (string, error) {
+	client, err := s.getClient()
+	if err != nil {
+		return "", err
+	}
+
+	memberIDs.Lock()
+	id, ok := memberIDs.ids[client.Token]
+	memberIDs.Unlock()
+
+	if ok {
+		return id, nil
+	}
+
+	member, err := client.GetMember("me", trello.Arguments{"fields": "id"})
+	if err != nil {
+		return "", err
+	}
+
+	memberIDs.Lock()
+	memberIDs.ids[client.Token] = member.ID
+	memberIDs.Unlock()
+
+	return member.ID, nil
+}
+
+func (s *TrelloSource) GetBoards() ([]*Board, error) {
+	client, err := s.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	// Sideload lists as a nested resource by default
+	args := trello.Defaults()
+	args["lists"] = "all"
+
+	trelloBoards, err := client.GetMyBoards(args)
+	if err != nil {
+		return nil, err
+	}
+
+	var boards []*Board
+
+	for i := range trelloBoards {
+		board, err := NewBoard(trelloBoards[i])
+		if err != nil {
+			return nil, err
+		}
+
+		board.setSource(s)
+
+		boards = append(boards, board)
+	}
+
+	return boards, nil
+}
+
+func (s *TrelloSource) GetBoard(id string) (*Board, error) {
+	client, err := s.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	args := trello.Defaults()
+	args["lists"] = "all"
+
+	trelloBoard, err := client.GetBoard(id, args)
+	if err != nil {
+		return nil, err
+	}
+
+	board, err := NewBoard(trelloBoard)
+	if err != nil {
+		return nil, err
+	}
+
+	board.setSource(s)
+
+	return board, nil
+}
+
+func (s *TrelloSource) GetList(id string) (*List, error) {
+	client, err := s.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	trelloList, err := client.GetList(id, trello.Defaults())
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := NewList(trelloList)
+	if err != nil {
+		return nil, err
+	}
+
+	list.setSource(s)
+
+	return list, nil
+}
+
+func (s *TrelloSource) GetCard(id string) (*Card, error) {
+	client, err := s.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	args := trello.Defaults()
+	args["attachments"] = "true"
+	args["list"] = "true"
+
+	trelloCard, err := client.GetCard(id, args)
+	if err != nil {
+		return nil, err
+	}
+
+	card, err := NewCard(trelloCard)
+	if err != nil {
+		return nil, err
+	}
+
+	card.setSource(s)
+
+	return card, nil
+}
+
+func (s *TrelloSource) GetBoardLists(board *Board) ([]*List, error) {
+	if board.TrelloBoard == nil {
+		return nil, errors.New("TrelloBoard is nil")
+	}
+
+	if board.TrelloBoard.Lists == nil {
+		trelloLists, err := board.TrelloBoard.GetLists(trello.Defaults())
+		if err != nil {
+			return nil, err
+		}
+
+		board.TrelloBoard.Lists = trelloLists
+	}
+
+	lists := make([]*List, 0)
+
+	for i := range board.TrelloBoard.Lists {
+		list, err := NewList(board.TrelloBoard.Lists[i])
+		if err != nil {
+			return nil, err
+		}
+
+		list.setSource(s)
+
+		lists = append(lists, list)
+	}
+
+	return lists, nil
+}
+
+func (s *TrelloSource) GetBoardCards(board *Board) ([]*Card, error) {
+	if board.TrelloBoard == nil {
+		return nil, errors.New("TrelloBoard is nil")
+	}
+
+	args := trello.Defaults()
+	args["card_attachments"] = "true"
+
+	trelloCards, err := board.TrelloBoard.GetCards(args)
+	if err != nil {
+		return nil, err
+	}
+
+	cards := make([]*Card, 0)
+
+	for i := range trelloCards {
+		if !hasCover(trelloCards[i]) {
+			continue
+		}
+
+		card, err := NewCard(trelloCards[i])
+		if err != nil {
+			return nil, err
+		}
+
+		card.setSource(s)
+
+		cards = append(cards, card)
+	}
+
+	return cards, nil
+}
+
+func (s *TrelloSource) GetListCards(list *List) ([]*Card, error) {
+	if list.TrelloList == nil {
+		return nil, errors.New("TrelloList is nil")
+	}
+
+	args := trello.Defaults()
+	args["attachments"] = "true"
+
+	trelloCards, err := list.TrelloList.GetCards(args)
+	if err != nil {
+		return nil, err
+	}
+
+	return newListCards(s, list, trelloCards)
+}
+
+// GetListCardsPage pages through the cards on a list from the newest to the
+// oldest, with the before cursor of Trello. Card ids begin with the time they
+// were created, so the following page begins before the smallest id of a page.
+func (s *TrelloSource) GetListCardsPage(list *List, before string, limit int) ([]*Card, string, error) {
+	if list.TrelloList == nil {
+		return nil, "", errors.New("TrelloList is nil")
+	}
+
+	args := trello.Defaults()
+	args["attachments"] = "true"
+	args["limit"] = strconv.Itoa(limit)
+	if before != "" {
+		args["before"] = before
+	}
+
+	trelloCards, err := list.TrelloList.GetCards(args)
+	if err != nil {
+		return nil, "", err
+	}
+
+	next := ""
+
+	// A page which isn't full is the last one
+	if len(trelloCards) >= limit {
+		for i := range trelloCards {
+			if next == "" || trelloCards[i].ID < next {
+				next = trelloCards[i].ID
+			}
+		}
+	}
+
+	cards, err := newListCards(s, list, trelloCards)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return cards, next, nil
+}
+
+func (s *TrelloSource) GetBoardsCards(boards []*Board) ([]*trello.Card, error) {
+	client, err := s.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return getBoardCardsBatch(client, boards)
+}
+
+// GetCustomFields fetches the custom fields of the board, to tell the names of
+// the fields, and then the custom field items of the cards. Items of given
+// cards are fetched in batch requests of up to ten cards.
+func (s *TrelloSource) GetCustomFields(boardID string, cardIDs []string) (map[string]map[string]interface{}, error) {
+	client, err := s.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	var boardFields []*trello.CustomField
+
+	path := fmt.Sprintf("boards/%s/customFields", boardID)
+	err = client.Get(path, trello.Defaults(), &boardFields)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]map[string]interface{})
+
+	if len(boardFields) == 0 {
+		return values, nil
+	}
+
+	var trelloCards []*trello.Card
+
+	if cardIDs == nil {
+		path = fmt.Sprintf("boards/%s/cards", boardID)
+		args := trello.Arguments{
+			"fields":           "id",
+			"customFieldItems": "true",
+		}
+
+		err = client.Get(path, args, &trelloCards)
+	} else {
+		trelloCards, err = getCardsCustomFieldItemsBatch(client, cardIDs)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range trelloCards {
+		values[trelloCards[i].ID] = trelloCards[i].CustomFields(boardFields)
+	}
+
+	return values, nil
+}
+
+func (s *TrelloSource) GetCardComments(cardID string, limit int) ([]*trello.Action, error) {
+	client, err := s.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	var actions []*trello.Action
+
+	path := fmt.Sprintf("cards/%s/actions", cardID)
+	args := trello.Arguments{
+		"filter": "commentCard",
+		"limit":  strconv.Itoa(limit),
+	}
+
+	err = client.Get(path, args, &actions)
+	if err != nil {
+		return nil, err
+	}
+
+	return actions, nil
+}
+
+// WatchBoard registers a webhook for the board, with the token of the client.
+func (s *TrelloSource) WatchBoard(boardID, callbackURL string) error {
+	client, err := s.getClient()
+	if err != nil {
+		return err
+	}
+
+	err = client.CreateWebhook(&trello.Webhook{
+		IDModel:     boardID,
+		Description: "gallo",
+		CallbackURL: callbackURL,
+	})
+
+	// Trello refuses to register the same webhook twice
+	if err != nil && strings.Contains(err.Error(), "already exists") {
+		return nil
+	}
+
+	return err
+}
+
+func (s *TrelloSource) OpenAttachment(cardID, id string) (io.ReadCloser, error) {
+	attachment, err := s.GetAttachment(cardID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.download(attachment.URL)
+}
+
+func (s *TrelloSource) OpenPreview(cardID, id string, width int) (io.ReadCloser, error) {
+	attachment, err := s.GetAttachment(cardID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	previews := NewImage(attachment).trelloPreviews()
+
+	for i := range previews {
+		if previews[i].Width >= width {
+			return s.download(previews[i].URL)
+		}
+	}
+
+	return s.download(attachment.URL)
+}
+
+func (s *TrelloSource) GetAttachment(cardID, id string) (*trello.Attachment, error) {
+	client, err := s.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	var attachment *trello.Attachment
+
+	path := fmt.Sprintf("cards/%s/attachments/%s", cardID, id)
+
+	err = client.Get(path, trello.Defaults(), &attachment)
+	if err != nil {
+		return nil, err
+	}
+
+	return attachment, nil
+}
+
+// Downloads an attachment or preview, with the credentials of the client if
+// it's hosted by Trello.
+func (s *TrelloSource) download(rawURL string) (io.ReadCloser, error) {
+	client, err := s.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	downloadURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", downloadURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Uploaded attachments can only be downloaded with credentials, which
+	// shouldn't be sent along to any other host
+	if downloadURL.Host == "trello.com" {
+		req.Header.Set("Authorization", fmt.Sprintf(
+			"OAuth oauth_consumer_key=\"%s\", oauth_token=\"%s\"",
+			client.Key,
+			client.Token,
+		))
+	}
+
+	resp, err := attachmentClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+
+		return nil, errors.New(fmt.Sprintf(
+			"Failed to download %s, status code: %d",
+			downloadURL.Path,
+			resp.StatusCode,
+		))
+	}
+
+	return resp.Body, nil
+}
@@ -34,7 +34,7 @@ func Test_boardsCardsBatchURLs(t *testing.T) {
 
 func Test_getBoardCardsBatchLimited(t *testing.T) {
 	t.Run("Too many boards", func(t *testing.T) {
-		_, err := getBoardCardsBatchLimited(defaultContext, make([]*Board, 11))
+		_, err := getBoardCardsBatchLimited(trelloClient, make([]*Board, 11))
 
 		assert.Error(t, err, "Max 10 boards should be supplied")
 	})
@@ -53,7 +53,7 @@ func Test_getBoardCardsBatchLimited(t *testing.T) {
 			&Board{TrelloBoard: &trello.Board{ID: "4567"}},
 		}
 
-		cards, err := getBoardCardsBatchLimited(defaultContext, boards)
+		cards, err := getBoardCardsBatchLimited(trelloClient, boards)
 
 		assert.NilError(t, err)
 		assert.Equal(t, httpmock.GetTotalCallCount(), 1)
@@ -119,7 +119,7 @@ func Test_getBoardCardsBatch(t *testing.T) {
 			&Board{TrelloBoard: &trello.Board{ID: "11"}},
 		}
 
-		_, err := getBoardCardsBatch(defaultContext, boards)
+		_, err := getBoardCardsBatch(trelloClient, boards)
 
 		assert.NilError(t, err)
 
@@ -127,11 +127,12 @@ func Test_getBoardCardsBatch(t *testing.T) {
 	})
 }
 
-func Test_cardOnSubscribedList(t *testing.T) {
+func Test_cardOnSelectedList(t *testing.T) {
 	boards := []*Board{
 		&Board{
 			Lists: []*List{
 				&List{
+					Name: "lorem",
 					TrelloList: &trello.List{
 						ID:         "0",
 						Name:       "lorem",
@@ -139,12 +140,14 @@ func Test_cardOnSubscribedList(t *testing.T) {
 					},
 				},
 				&List{
+					Name: "ipsum",
 					TrelloList: &trello.List{
 						ID:   "1",
 						Name: "ipsum",
 					},
 				},
 			},
+			TrelloBoard: &trello.Board{ID: "a"},
 		},
 	}
 
@@ -152,13 +155,26 @@ func Test_cardOnSubscribedList(t *testing.T) {
 	badCard := &trello.Card{IDList: "1"}
 
 	assert.Assert(t,
-		cardOnSubscribedList(goodCard, boards),
+		cardOnSelectedList(defaultContext, goodCard, boards),
 		"Card is on a subscribed list",
 	)
 	assert.Assert(t,
-		!cardOnSubscribedList(badCard, boards),
+		!cardOnSelectedList(defaultContext, badCard, boards),
 		"Card is not on a subscribed list",
 	)
+
+	settings := DefaultSettings()
+	settings.Lists["a"] = ListSelection{NamePattern: "^ips"}
+	ctx := NewSettingsContext(defaultContext, settings)
+
+	assert.Assert(t,
+		!cardOnSelectedList(ctx, goodCard, boards),
+		"Card is not on a list matching the name pattern",
+	)
+	assert.Assert(t,
+		cardOnSelectedList(ctx, badCard, boards),
+		"Card is on a list matching the name pattern",
+	)
 }
 
 func TestGetRandomCard(t *testing.T) {
@@ -176,7 +192,7 @@ func TestGetRandomCard(t *testing.T) {
 			&Board{TrelloBoard: &trello.Board{ID: "4567"}},
 		}
 
-		_, err := GetRandomCard(defaultContext, boards)
+		_, err := GetRandomCard(defaultContext, boards, UniformByCard{})
 
 		assert.Error(t, err, "No cards found for GetRandomCard")
 	})
@@ -231,7 +247,7 @@ func TestGetRandomCard(t *testing.T) {
 			},
 		}
 
-		card, err := GetRandomCard(defaultContext, boards)
+		card, err := GetRandomCard(defaultContext, boards, UniformByCard{})
 
 		assert.NilError(t, err)
 
@@ -240,4 +256,72 @@ func TestGetRandomCard(t *testing.T) {
 		assert.Equal(t, httpmock.GetTotalCallCount(), 2)
 		assert.Assert(t, card.Name == "Lorem" || card.Name == "Dolor")
 	})
+	t.Run("Cards with attachments which aren't images are skipped", func(t *testing.T) {
+		httpmock.RegisterResponder(
+			"GET",
+			"https://api.trello.com/1/batch?urls=%2Fboards%2F1234%2Fcards%2C%2Fboards%2F1235%2Fcards",
+			httpmock.NewBytesResponder(http.StatusOK, testData["testdata/batch-001.json"]),
+		)
+		// Card 12 only has a PDF attached
+		httpmock.RegisterResponder(
+			"GET",
+			"https://api.trello.com/1/cards/12?attachments=true&list=true",
+			httpmock.NewBytesResponder(http.StatusOK, testData["testdata/cards-009.json"]),
+		)
+		httpmock.RegisterResponder(
+			"GET",
+			"https://api.trello.com/1/cards/14?attachments=true&list=true",
+			httpmock.NewBytesResponder(http.StatusOK, testData["testdata/cards-005.json"]),
+		)
+		defer httpmock.Reset()
+
+		boards := []*Board{
+			&Board{
+				Lists: []*List{
+					&List{TrelloList: &trello.List{ID: "123", Subscribed: true}},
+				},
+				TrelloBoard: &trello.Board{ID: "1234"},
+			},
+			&Board{
+				Lists: []*List{
+					&List{TrelloList: &trello.List{ID: "125", Subscribed: true}},
+				},
+				TrelloBoard: &trello.Board{ID: "1235"},
+			},
+		}
+
+		for i := 0; i < 5; i++ {
+			card, err := GetRandomCard(defaultContext, boards, UniformByCard{})
+
+			assert.NilError(t, err)
+			assert.Equal(t, card.Name, "Dolor")
+		}
+	})
+	t.Run("Cards without attachments are skipped", func(t *testing.T) {
+		httpmock.RegisterResponder(
+			"GET",
+			"https://api.trello.com/1/batch?urls=%2Fboards%2F1234%2Fcards",
+			httpmock.NewBytesResponder(http.StatusOK, testData["testdata/batch-001.json"]),
+		)
+		defer httpmock.Reset()
+
+		// Only the list of card 13, which has no attachments, is subscribed
+		boards := []*Board{
+			&Board{
+				Lists: []*List{
+					&List{
+						TrelloList: &trello.List{
+							ID:         "124",
+							Subscribed: true,
+						},
+					},
+				},
+				TrelloBoard: &trello.Board{ID: "1234"},
+			},
+		}
+
+		_, err := GetRandomCard(defaultContext, boards, UniformByCard{})
+
+		assert.Error(t, err, "No cards found for GetRandomCard")
+	})
 }
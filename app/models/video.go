@@ -0,0 +1,113 @@
+package models
+
+import (
+	"encoding/json"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/adlio/trello"
+)
+
+// The dimensions assumed for videos, when Trello hasn't rendered any previews
+// telling otherwise
+const (
+	defaultVideoWidth  = 1920
+	defaultVideoHeight = 1080
+)
+
+// Video is an attachment of a card, which is a video. Videos are served by
+// gallo, so they can be played on the card page without Trello credentials.
+type Video struct {
+	*trello.Attachment
+
+	// ID of the card the video is attached to
+	CardID string
+}
+
+func NewVideo(attachment *trello.Attachment) Video {
+	return Video{Attachment: attachment}
+}
+
+// Whether an attachment is a video, judged by its mime type.
+func isVideoAttachment(attachment *trello.Attachment) bool {
+	return strings.HasPrefix(attachment.MimeType, "video/")
+}
+
+// Returns the attachments of a card which are videos, in the order they were
+// attached.
+func cardVideos(trelloCard *trello.Card) []Video {
+	videos := make([]Video, 0)
+
+	for _, attachment := range trelloCard.Attachments {
+		if isVideoAttachment(attachment) {
+			video := NewVideo(attachment)
+			video.CardID = trelloCard.ID
+
+			videos = append(videos, video)
+		}
+	}
+
+	return videos
+}
+
+// URL is where gallo serves the video.
+func (v Video) URL() string {
+	return v.url(path.Join("/videos", v.ID))
+}
+
+// PosterURL is where gallo serves a frame extracted from the video, for use as
+// poster before the video plays.
+func (v Video) PosterURL() string {
+	return v.url(path.Join("/videos", v.ID, "poster"))
+}
+
+func (v Video) url(p string) string {
+	u := url.URL{Path: p}
+
+	query := url.Values{}
+	if v.CardID != "" {
+		query.Set("card", v.CardID)
+	}
+	if v.MimeType != "" {
+		query.Set("type", v.MimeType)
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+// GetPreviews returns the previews of the video rendered by Trello, if there
+// are any. Otherwise the only preview is the poster extracted by gallo, which
+// is assumed to be full HD.
+func (v Video) GetPreviews() []trello.AttachmentPreview {
+	if len(v.Previews) > 0 {
+		return NewImage(v.Attachment).trelloPreviews()
+	}
+
+	return []trello.AttachmentPreview{
+		trello.AttachmentPreview{
+			ID:     v.ID + "-poster",
+			URL:    v.PosterURL(),
+			Width:  defaultVideoWidth,
+			Height: defaultVideoHeight,
+		},
+	}
+}
+
+// MarshalJSON exposes the video with its urls, rather than the raw Trello
+// attachment.
+func (v Video) MarshalJSON() ([]byte, error) {
+	if v.Attachment == nil {
+		return []byte("null"), nil
+	}
+
+	return json.Marshal(struct {
+		ID       string                     `json:"id"`
+		CardID   string                     `json:"cardId,omitempty"`
+		Name     string                     `json:"name"`
+		MimeType string                     `json:"mimeType"`
+		URL      string                     `json:"url"`
+		Previews []trello.AttachmentPreview `json:"previews"`
+	}{v.ID, v.CardID, v.Name, v.MimeType, v.URL(), v.GetPreviews()})
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/adlio/trello"
+	"gotest.tools/assert"
+)
+
+func createVideoTestCard() *trello.Card {
+	return &trello.Card{
+		ID: "34",
+		Attachments: []*trello.Attachment{
+			&trello.Attachment{
+				ID:       "a",
+				MimeType: "image/jpeg",
+				Previews: []trello.AttachmentPreview{trello.AttachmentPreview{}},
+			},
+			&trello.Attachment{ID: "b", MimeType: "video/quicktime"},
+			&trello.Attachment{
+				ID:       "c",
+				MimeType: "video/mp4",
+				Previews: []trello.AttachmentPreview{
+					trello.AttachmentPreview{Width: 100, Height: 200, URL: "https://example.com/100.jpg"},
+					trello.AttachmentPreview{},
+				},
+			},
+		},
+	}
+}
+
+// -----------------------------------------------------------------------------
+
+func Test_cardVideos(t *testing.T) {
+	trelloCard := createVideoTestCard()
+
+	videos := cardVideos(trelloCard)
+	assert.Equal(t, len(videos), 2)
+	assert.Equal(t, videos[0].ID, "b")
+	assert.Equal(t, videos[0].CardID, "34")
+	assert.Equal(t, videos[1].ID, "c")
+
+	t.Run("Videos with previews aren't images", func(t *testing.T) {
+		images := cardImages(trelloCard)
+		assert.Equal(t, len(images), 1)
+		assert.Equal(t, images[0].ID, "a")
+	})
+}
+
+func TestVideoURLs(t *testing.T) {
+	video := cardVideos(createVideoTestCard())[0]
+
+	assert.Equal(t, video.URL(), "/videos/b?card=34&type=video%2Fquicktime")
+	assert.Equal(t, video.PosterURL(), "/videos/b/poster?card=34&type=video%2Fquicktime")
+}
+
+func TestVideoGetPreviews(t *testing.T) {
+	videos := cardVideos(createVideoTestCard())
+
+	t.Run("Poster extracted by gallo", func(t *testing.T) {
+		previews := videos[0].GetPreviews()
+		assert.Equal(t, len(previews), 1)
+		assert.Equal(t, previews[0].URL, videos[0].PosterURL())
+		assert.Equal(t, previews[0].Width, defaultVideoWidth)
+	})
+
+	t.Run("Previews rendered by Trello", func(t *testing.T) {
+		previews := videos[1].GetPreviews()
+		assert.Equal(t, len(previews), 1)
+		assert.Equal(t, previews[0].URL, "https://example.com/100.jpg")
+	})
+}
+
+func TestVideoMarshalJSON(t *testing.T) {
+	data, err := json.Marshal(cardVideos(createVideoTestCard())[0])
+	assert.NilError(t, err)
+
+	var decoded map[string]interface{}
+	assert.NilError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, decoded["url"], "/videos/b?card=34&type=video%2Fquicktime")
+	assert.Equal(t, decoded["mimeType"], "video/quicktime")
+}
@@ -0,0 +1,254 @@
+package models
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gallo/lib"
+	"log"
+	"time"
+
+	"github.com/adlio/trello"
+)
+
+// WebhookCallbackURL is where Trello posts the actions on boards being watched.
+// If it's empty, boards aren't watched.
+var WebhookCallbackURL = ""
+
+// WebhookSignatureHeader is the header Trello signs the actions it posts with.
+const WebhookSignatureHeader = "X-Trello-Webhook"
+
+// ErrInvalidWebhookSignature is returned for actions not signed by Trello.
+var ErrInvalidWebhookSignature = errors.New("Invalid webhook signature")
+
+// The types of actions, which change what's shown of a board
+var webhookActionTypes = []string{
+	"createCard",
+	"copyCard",
+	"updateCard",
+	"deleteCard",
+	"moveCardToBoard",
+	"moveCardFromBoard",
+	"convertToCardFromCheckItem",
+	"addAttachmentToCard",
+	"deleteAttachmentFromCard",
+	"addLabelToCard",
+	"removeLabelFromCard",
+	"updateCustomFieldItem",
+	"commentCard",
+	"updateComment",
+	"deleteComment",
+	"createList",
+	"updateList",
+	"moveListToBoard",
+	"moveListFromBoard",
+	"updateBoard",
+}
+
+// BoardWatcher is implemented by sources, which can notify gallo about changes
+// to boards.
+type BoardWatcher interface {
+	// WatchBoard has actions on the board with the given id posted to
+	// callbackURL. Watching a board already watched isn't an error.
+	WatchBoard(boardID, callbackURL string) error
+}
+
+// How long the boards watched for a member are remembered. After that, they're
+// all watched again, in case Trello has dropped any of their webhooks, which it
+// does once posting actions to them has failed for a while.
+const watchedBoardsTimeout = 24 * time.Hour
+
+// The boards watched for a member, as remembered in a SettingsStore
+type watchedBoards struct {
+	IDs     []string  `json:"ids"`
+	Watched time.Time `json:"watched"`
+}
+
+func watchedBoardsKey(memberID string) string {
+	return fmt.Sprintf("watched-boards-%s", memberID)
+}
+
+// WatchBoards has the source in ctx post actions on boards to
+// WebhookCallbackURL, if it's set and the source is a BoardWatcher. The boards
+// watched are remembered in store, so only boards which haven't been already
+// are, until watchedBoardsTimeout has passed. All boards are attempted, and the
+// first error is returned.
+func WatchBoards(ctx context.Context, store *SettingsStore, boards []*Board) error {
+	if WebhookCallbackURL == "" {
+		return nil
+	}
+
+	source, err := sourceFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	watcher, ok := source.(BoardWatcher)
+	if !ok {
+		return nil
+	}
+
+	memberID, err := source.GetMemberID()
+	if err != nil {
+		return err
+	}
+
+	watched := watchedBoards{}
+	changed := false
+
+	data, err := store.cache.Get(ctx, watchedBoardsKey(memberID))
+	if err != nil || json.Unmarshal(data, &watched) != nil ||
+		time.Since(watched.Watched) > watchedBoardsTimeout {
+		watched = watchedBoards{IDs: []string{}, Watched: time.Now()}
+		changed = true
+	}
+
+	ids := make([]string, 0, len(boards))
+
+	var firstErr error
+
+	for i := range boards {
+		id := boards[i].ID()
+
+		if !containsString(watched.IDs, id) {
+			// Boards which fail are left out, so they're tried again next time
+			err := watcher.WatchBoard(id, WebhookCallbackURL)
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+
+				continue
+			}
+
+			changed = true
+		}
+
+		ids = append(ids, id)
+	}
+
+	if !changed && len(ids) == len(watched.IDs) {
+		return firstErr
+	}
+
+	watched.IDs = ids
+
+	data, err = json.Marshal(watched)
+	if err == nil {
+		err = store.cache.Set(ctx, watchedBoardsKey(memberID), data)
+	}
+
+	if err != nil {
+		log.Println(err)
+	}
+
+	return firstErr
+}
+
+// VerifyWebhookSignature tells whether signature is the one Trello sends along
+// with body, when posting it to callbackURL. Trello signs the body followed by
+// the callback URL with a base64 encoded HMAC-SHA1, keyed with the secret of
+// the application.
+func VerifyWebhookSignature(secret, callbackURL string, body []byte, signature string) bool {
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write(body)
+	mac.Write([]byte(callbackURL))
+
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// AffectedModelIDs returns the IDs of the boards, lists and cards, which are
+// changed by action. Actions which don't change what's shown affect nothing.
+func AffectedModelIDs(action *trello.Action) []string {
+	ids := make([]string, 0)
+
+	if action == nil || action.Data == nil || !containsString(webhookActionTypes, action.Type) {
+		return ids
+	}
+
+	add := func(id string) {
+		if id != "" && !containsString(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+
+	data := action.Data
+
+	if data.Board != nil {
+		add(data.Board.ID)
+	}
+
+	for _, list := range []*trello.List{data.List, data.ListBefore, data.ListAfter} {
+		if list != nil {
+			add(list.ID)
+		}
+	}
+
+	if data.Card != nil {
+		add(data.Card.ID)
+	}
+
+	return ids
+}
+
+// CachePurger purges the cache entries with any of a set of tags, like
+// lib.TaggedCache.
+type CachePurger interface {
+	Purge(ctx context.Context, tags []string) (int, error)
+}
+
+// WebhookReceiver handles the actions Trello posts for the boards watched, by
+// purging the cache entries tagged with the models they change.
+type WebhookReceiver struct {
+	// Secret of the Trello application, which actions are signed with
+	Secret      string
+	CallbackURL string
+	Caches      []CachePurger
+}
+
+// Receive verifies and handles an action posted by Trello, and returns the
+// IDs of the models it affects.
+func (w *WebhookReceiver) Receive(ctx context.Context, body []byte, signature string) ([]string, error) {
+	if !VerifyWebhookSignature(w.Secret, w.CallbackURL, body, signature) {
+		return nil, ErrInvalidWebhookSignature
+	}
+
+	var request trello.BoardWebhookRequest
+
+	err := json.Unmarshal(body, &request)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Invalid webhook action: %s", err))
+	}
+
+	ids := AffectedModelIDs(request.Action)
+	if len(ids) == 0 {
+		return ids, nil
+	}
+
+	tags := make([]string, len(ids))
+	for i := range ids {
+		tags[i] = lib.ModelTag(ids[i])
+	}
+
+	for _, cache := range w.Caches {
+		purged, err := cache.Purge(ctx, tags)
+		if err != nil {
+			return ids, err
+		}
+
+		log.Println(fmt.Sprintf(
+			"Purged %d cache entries for %s of %v",
+			purged,
+			request.Action.Type,
+			ids,
+		))
+	}
+
+	return ids, nil
+}
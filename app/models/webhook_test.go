@@ -0,0 +1,229 @@
+package models
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/adlio/trello"
+	"github.com/jarcoal/httpmock"
+	"gotest.tools/assert"
+)
+
+const (
+	webhookSecret      = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	webhookCallbackURL = "https://gallo.example.com/webhooks/trello"
+)
+
+// Signs body the way Trello does
+func signWebhook(body []byte) string {
+	mac := hmac.New(sha1.New, []byte(webhookSecret))
+	mac.Write(append(body, []byte(webhookCallbackURL)...))
+
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+type recordingPurger struct {
+	tags [][]string
+	err  error
+}
+
+func (p *recordingPurger) Purge(ctx context.Context, tags []string) (int, error) {
+	p.tags = append(p.tags, tags)
+	return len(tags), p.err
+}
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	body := testData["testdata/webhooks-000.json"]
+	signature := signWebhook(body)
+
+	assert.Assert(t, VerifyWebhookSignature(webhookSecret, webhookCallbackURL, body, signature))
+
+	assert.Assert(t, !VerifyWebhookSignature("other", webhookCallbackURL, body, signature))
+	assert.Assert(t, !VerifyWebhookSignature(webhookSecret, "https://example.com", body, signature))
+	assert.Assert(t, !VerifyWebhookSignature(webhookSecret, webhookCallbackURL, body[1:], signature))
+	assert.Assert(t, !VerifyWebhookSignature(webhookSecret, webhookCallbackURL, body, ""))
+}
+
+func TestAffectedModelIDs(t *testing.T) {
+	tests := []struct {
+		file     string
+		expected []string
+	}{
+		{
+			"testdata/webhooks-000.json",
+			[]string{"5d2a1c8e4f0b6a1d3c9e7f01", "5d2a1c8e4f0b6a1d3c9e7f02", "5d2a1c8e4f0b6a1d3c9e7f03"},
+		},
+		{
+			"testdata/webhooks-001.json",
+			[]string{"5d2a1c8e4f0b6a1d3c9e7f01", "5d2a1c8e4f0b6a1d3c9e7f02", "5d2a1c8e4f0b6a1d3c9e7f04", "5d2a1c8e4f0b6a1d3c9e7f03"},
+		},
+		{"testdata/webhooks-002.json", []string{}},
+	}
+
+	for _, test := range tests {
+		var request trello.BoardWebhookRequest
+
+		err := json.Unmarshal(testData[test.file], &request)
+		assert.NilError(t, err)
+
+		assert.DeepEqual(t, AffectedModelIDs(request.Action), test.expected)
+	}
+
+	assert.DeepEqual(t, AffectedModelIDs(nil), []string{})
+}
+
+func TestWebhookReceiverReceive(t *testing.T) {
+	newReceiver := func(caches ...CachePurger) *WebhookReceiver {
+		return &WebhookReceiver{webhookSecret, webhookCallbackURL, caches}
+	}
+
+	t.Run("Purges the models changed", func(t *testing.T) {
+		first, second := &recordingPurger{}, &recordingPurger{}
+		body := testData["testdata/webhooks-001.json"]
+
+		ids, err := newReceiver(first, second).Receive(context.Background(), body, signWebhook(body))
+		assert.NilError(t, err)
+
+		assert.Equal(t, len(ids), 4)
+
+		tags := []string{
+			"model:5d2a1c8e4f0b6a1d3c9e7f01",
+			"model:5d2a1c8e4f0b6a1d3c9e7f02",
+			"model:5d2a1c8e4f0b6a1d3c9e7f04",
+			"model:5d2a1c8e4f0b6a1d3c9e7f03",
+		}
+		assert.DeepEqual(t, first.tags, [][]string{tags})
+		assert.DeepEqual(t, second.tags, [][]string{tags})
+	})
+
+	t.Run("Ignores actions changing nothing shown", func(t *testing.T) {
+		purger := &recordingPurger{}
+		body := testData["testdata/webhooks-002.json"]
+
+		ids, err := newReceiver(purger).Receive(context.Background(), body, signWebhook(body))
+		assert.NilError(t, err)
+
+		assert.Equal(t, len(ids), 0)
+		assert.Equal(t, len(purger.tags), 0)
+	})
+
+	t.Run("Rejects actions not signed by Trello", func(t *testing.T) {
+		purger := &recordingPurger{}
+		body := testData["testdata/webhooks-000.json"]
+
+		_, err := newReceiver(purger).Receive(context.Background(), body, signWebhook([]byte("{}")))
+		assert.Equal(t, err, ErrInvalidWebhookSignature)
+		assert.Equal(t, len(purger.tags), 0)
+	})
+
+	t.Run("Fails on invalid actions", func(t *testing.T) {
+		body := []byte("not json")
+
+		_, err := newReceiver().Receive(context.Background(), body, signWebhook(body))
+		assert.ErrorContains(t, err, "Invalid webhook action")
+	})
+
+	t.Run("Fails if purging fails", func(t *testing.T) {
+		purger := &recordingPurger{err: errors.New("Redis is down")}
+		body := testData["testdata/webhooks-000.json"]
+
+		_, err := newReceiver(purger).Receive(context.Background(), body, signWebhook(body))
+		assert.ErrorContains(t, err, "Redis is down")
+	})
+}
+
+func TestWatchBoards(t *testing.T) {
+	ctx := NewSourceContext(defaultContext, NewTrelloSource(trelloClient))
+	cache := make(memoryBlobCache)
+	store := NewSettingsStore(cache)
+
+	boards := []*Board{
+		&Board{TrelloBoard: &trello.Board{ID: "1234"}},
+		&Board{TrelloBoard: &trello.Board{ID: "1235"}},
+	}
+
+	// Responds to the requests made for watching boards, and returns the ids
+	// of the boards watched
+	respond := func(t *testing.T) *[]string {
+		watched := []string{}
+
+		httpmock.RegisterResponder(
+			"GET",
+			"https://api.trello.com/1/members/me?fields=id",
+			httpmock.NewStringResponder(http.StatusOK, `{"id":"member"}`),
+		)
+		httpmock.RegisterResponder(
+			"POST",
+			"https://api.trello.com/1/webhooks",
+			func(r *http.Request) (*http.Response, error) {
+				assert.Equal(t, r.URL.Query().Get("callbackURL"), webhookCallbackURL)
+
+				watched = append(watched, r.URL.Query().Get("idModel"))
+
+				if r.URL.Query().Get("idModel") == "1235" {
+					return httpmock.NewStringResponse(
+						http.StatusBadRequest,
+						"A webhook with that callback, model, and token already exists",
+					), nil
+				}
+
+				return httpmock.NewStringResponse(http.StatusOK, `{"id":"4321","active":true}`), nil
+			},
+		)
+
+		return &watched
+	}
+
+	t.Run("Does nothing without a callback url", func(t *testing.T) {
+		defer httpmock.Reset()
+
+		assert.NilError(t, WatchBoards(ctx, store, boards))
+		assert.Equal(t, httpmock.GetTotalCallCount(), 0)
+	})
+
+	WebhookCallbackURL = webhookCallbackURL
+	defer func() { WebhookCallbackURL = "" }()
+
+	t.Run("Registers a webhook for each board", func(t *testing.T) {
+		watched := respond(t)
+		defer httpmock.Reset()
+
+		assert.NilError(t, WatchBoards(ctx, store, boards))
+		assert.DeepEqual(t, *watched, []string{"1234", "1235"})
+	})
+
+	t.Run("Only registers webhooks for boards not watched already", func(t *testing.T) {
+		watched := respond(t)
+		defer httpmock.Reset()
+
+		assert.NilError(t, WatchBoards(ctx, store, boards))
+		assert.DeepEqual(t, *watched, []string{})
+
+		more := append(boards, &Board{TrelloBoard: &trello.Board{ID: "1236"}})
+
+		assert.NilError(t, WatchBoards(ctx, store, more))
+		assert.DeepEqual(t, *watched, []string{"1236"})
+	})
+
+	t.Run("Registers webhooks again after a while", func(t *testing.T) {
+		watched := respond(t)
+		defer httpmock.Reset()
+
+		data, err := json.Marshal(watchedBoards{
+			IDs:     []string{"1234", "1235"},
+			Watched: time.Now().Add(-watchedBoardsTimeout - time.Minute),
+		})
+		assert.NilError(t, err)
+		cache[watchedBoardsKey("member")] = data
+
+		assert.NilError(t, WatchBoards(ctx, store, boards))
+		assert.DeepEqual(t, *watched, []string{"1234", "1235"})
+	})
+}
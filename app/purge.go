@@ -0,0 +1,60 @@
+package gallo
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"gallo/app/controllers"
+	"gallo/lib"
+	"net/url"
+	"strings"
+)
+
+// Collects the values of a flag given several times
+type valuesFlag struct {
+	values url.Values
+	name   string
+}
+
+func (f valuesFlag) String() string {
+	return strings.Join(f.values[f.name], ",")
+}
+
+func (f valuesFlag) Set(value string) error {
+	f.values.Add(f.name, value)
+	return nil
+}
+
+// Purge runs the purge command, which purges cached responses from Trello and
+// rendered pages with any of the tags given by args, e.g.
+//
+//	purge -user 5a1b2c3d4e5f6a7b8c9d0e12 -route /lists/{id}
+func Purge(args []string) error {
+	values := url.Values{}
+
+	flags := flag.NewFlagSet("purge", flag.ContinueOnError)
+	flags.Var(valuesFlag{values, "tag"}, "tag", "a tag as it is, e.g. model:{id}")
+	flags.Var(valuesFlag{values, "model"}, "model", "the ID of a Trello board, list or card")
+	flags.Var(valuesFlag{values, "user"}, "user", "the ID of a Trello member")
+	flags.Var(valuesFlag{values, "route"}, "route", "a route, e.g. /lists/{id} or /1/boards/{id}/cards")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	tags := lib.PurgeTags(values)
+	if len(tags) == 0 {
+		return errors.New("Nothing to purge by")
+	}
+
+	purged, err := controllers.PurgeCaches(context.Background(), tags)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Purged %d cache entries tagged %s\n", purged, strings.Join(tags, ", "))
+
+	return nil
+}
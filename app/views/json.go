@@ -0,0 +1,54 @@
+package views
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// ErrorBody is the body of every failed JSON response.
+type ErrorBody struct {
+	Error ErrorDetails `json:"error"`
+}
+
+type ErrorDetails struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+// ExecuteJSON renders data as JSON with the given status code.
+func ExecuteJSON(w http.ResponseWriter, r *http.Request, status int, data interface{}) {
+	buf := bufferPool.Get()
+	defer bufferPool.Put(buf)
+
+	err := json.NewEncoder(buf).Encode(data)
+	if err != nil {
+		log.Println(err)
+
+		status = http.StatusInternalServerError
+		buf.Reset()
+		json.NewEncoder(buf).Encode(newErrorBody(status, ""))
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+
+	_, err = buf.WriteTo(w)
+	if err != nil {
+		log.Println("Error in views.ExecuteJSON:", err)
+	}
+}
+
+// ExecuteJSONError renders an ErrorBody with the given status code. The status
+// text is used if message is empty.
+func ExecuteJSONError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	ExecuteJSON(w, r, status, newErrorBody(status, message))
+}
+
+func newErrorBody(status int, message string) ErrorBody {
+	if message == "" {
+		message = http.StatusText(status)
+	}
+
+	return ErrorBody{ErrorDetails{status, message}}
+}
@@ -0,0 +1,54 @@
+package views
+
+import (
+	"gallo/lib"
+	"net/http"
+)
+
+const (
+	HTMLContentType = "text/html"
+	JSONContentType = "application/json"
+)
+
+// Content types pages can be rendered as, in order of preference
+var representations = []string{HTMLContentType, JSONContentType}
+
+// Representation is the content type negotiated from the Accept header of r.
+func Representation(r *http.Request) string {
+	return lib.NegotiateContentType(r.Header.Get("Accept"), representations)
+}
+
+func WantsJSON(r *http.Request) bool {
+	return Representation(r) == JSONContentType
+}
+
+// Render executes the template name with data, or renders data as JSON if
+// that's what the client accepts. If data is built from fallbacks, since Trello
+// failed, the Degraded header is set.
+func Render(w http.ResponseWriter, r *http.Request, name string, data interface{}) {
+	w.Header().Add("Vary", "Accept")
+
+	if lib.IsDegraded(r.Context()) {
+		w.Header().Set("Degraded", "True")
+	}
+
+	if WantsJSON(r) {
+		ExecuteJSON(w, r, http.StatusOK, data)
+		return
+	}
+
+	Execute(w, r, name, data)
+}
+
+// RenderError responds with an ErrorBody for JSON clients, or just the status
+// code otherwise.
+func RenderError(w http.ResponseWriter, r *http.Request, status int) {
+	w.Header().Add("Vary", "Accept")
+
+	if WantsJSON(r) {
+		ExecuteJSONError(w, r, status, "")
+		return
+	}
+
+	w.WriteHeader(status)
+}
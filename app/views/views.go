@@ -3,10 +3,13 @@ package views
 import (
 	"gallo/app/constants"
 	"gallo/app/helpers"
+	"gallo/app/models"
+	"gallo/lib"
 	"html/template"
 	"log"
 	"net/http"
 	"path"
+	"time"
 
 	"github.com/gorilla/sessions"
 	"github.com/oxtoacart/bpool"
@@ -32,7 +35,18 @@ func Execute(w http.ResponseWriter, r *http.Request, name string, data interface
 	buf := bufferPool.Get()
 	defer bufferPool.Put(buf)
 
+	settings := models.SettingsFromContext(r.Context())
+
 	requestDependantFuncs := template.FuncMap{
+		"settings": func() models.Settings {
+			return settings
+		},
+		"formatTime": func(t *time.Time) string {
+			return helpers.FormatTimeAs(t, settings)
+		},
+		"isDegraded": func() bool {
+			return lib.IsDegraded(r.Context())
+		},
 		"isLoggedIn": func() bool {
 			session, _ := Store.Get(r, constants.SessionName)
 
@@ -0,0 +1,108 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-redis/cache/v8"
+)
+
+// BlobCache stores opaque binary data, such as encoded images, by key.
+type BlobCache interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte) error
+}
+
+// RedisBlobCache is a BlobCache storing data in Redis.
+type RedisBlobCache struct {
+	cache      RedisCacheProvider
+	expiration time.Duration
+}
+
+func NewRedisBlobCache(rcp RedisCacheProvider, expiration time.Duration) *RedisBlobCache {
+	return &RedisBlobCache{rcp, expiration}
+}
+
+func (c *RedisBlobCache) Get(ctx context.Context, key string) ([]byte, error) {
+	var value []byte
+
+	err := c.cache.Get(ctx, key, &value)
+	if err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
+
+func (c *RedisBlobCache) Set(ctx context.Context, key string, value []byte) error {
+	return c.cache.Set(&cache.Item{
+		Ctx:   ctx,
+		Key:   key,
+		Value: value,
+		TTL:   c.expiration,
+	})
+}
+
+// DiskBlobCache is a BlobCache storing each entry as a file in a directory.
+// File names are the sha256 of the key, so any key can be used.
+type DiskBlobCache struct {
+	dir string
+}
+
+func NewDiskBlobCache(dir string) *DiskBlobCache {
+	return &DiskBlobCache{dir}
+}
+
+func (c *DiskBlobCache) Get(ctx context.Context, key string) ([]byte, error) {
+	return ioutil.ReadFile(c.path(key))
+}
+
+func (c *DiskBlobCache) Set(ctx context.Context, key string, value []byte) error {
+	return c.SetFrom(key, bytes.NewReader(value))
+}
+
+// Open opens the file of the entry with key, so it can be read without holding
+// it in memory.
+func (c *DiskBlobCache) Open(key string) (*os.File, error) {
+	return os.Open(c.path(key))
+}
+
+// SetFrom stores everything read from r as the entry with key, without holding
+// it in memory. Nothing is stored if reading fails.
+func (c *DiskBlobCache) SetFrom(key string, r io.Reader) error {
+	err := os.MkdirAll(c.dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, so concurrent readers never see a
+	// partially written entry
+	tmp, err := ioutil.TempFile(c.dir, "tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), c.path(key))
+}
+
+func (c *DiskBlobCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+}
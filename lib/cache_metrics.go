@@ -0,0 +1,76 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// CacheMetrics counts how the requests of a CachingTransport are answered. The
+// zero value is ready for use.
+type CacheMetrics struct {
+	// Requests answered by a fresh response from the cache
+	hits uint64
+	// Requests answered by an expired response from the cache, which was then
+	// refreshed in the background
+	stale uint64
+	// Requests answered by the server, or by the last known good response if
+	// it failed
+	misses uint64
+	// Conditional requests, which the server answered with 304 Not Modified
+	revalidated uint64
+	// Background refreshes, which failed
+	refreshErrors uint64
+	// Requests answered by the last known good response, because the server
+	// failed
+	fallbacks uint64
+}
+
+func (m *CacheMetrics) add(counter *uint64) {
+	atomic.AddUint64(counter, 1)
+}
+
+// Counts returns the current counts by name.
+func (m *CacheMetrics) Counts() map[string]uint64 {
+	return map[string]uint64{
+		"hit":            atomic.LoadUint64(&m.hits),
+		"stale":          atomic.LoadUint64(&m.stale),
+		"miss":           atomic.LoadUint64(&m.misses),
+		"revalidated":    atomic.LoadUint64(&m.revalidated),
+		"refresh_errors": atomic.LoadUint64(&m.refreshErrors),
+		"fallbacks":      atomic.LoadUint64(&m.fallbacks),
+	}
+}
+
+// WritePrometheus writes the counts to w in the Prometheus text format, with
+// metric names starting with prefix.
+func (m *CacheMetrics) WritePrometheus(w io.Writer, prefix string) error {
+	counts := m.Counts()
+
+	_, err := fmt.Fprintf(
+		w,
+		"# HELP %[1]s_requests_total Requests by how they were answered.\n"+
+			"# TYPE %[1]s_requests_total counter\n"+
+			"%[1]s_requests_total{result=\"hit\"} %[2]d\n"+
+			"%[1]s_requests_total{result=\"stale\"} %[3]d\n"+
+			"%[1]s_requests_total{result=\"miss\"} %[4]d\n"+
+			"# HELP %[1]s_revalidated_total Conditional requests answered with 304 Not Modified.\n"+
+			"# TYPE %[1]s_revalidated_total counter\n"+
+			"%[1]s_revalidated_total %[5]d\n"+
+			"# HELP %[1]s_refresh_errors_total Failed refreshes in the background.\n"+
+			"# TYPE %[1]s_refresh_errors_total counter\n"+
+			"%[1]s_refresh_errors_total %[6]d\n"+
+			"# HELP %[1]s_fallbacks_total Requests answered by the last known good response, because the server failed.\n"+
+			"# TYPE %[1]s_fallbacks_total counter\n"+
+			"%[1]s_fallbacks_total %[7]d\n",
+		prefix,
+		counts["hit"],
+		counts["stale"],
+		counts["miss"],
+		counts["revalidated"],
+		counts["refresh_errors"],
+		counts["fallbacks"],
+	)
+
+	return err
+}
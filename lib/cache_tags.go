@@ -0,0 +1,257 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Trello IDs are 24 hexadecimal digits
+var trelloIDPattern = regexp.MustCompile(`^[0-9a-f]{24}$`)
+
+// The kinds of Trello models, whose IDs are followed in request paths
+var trelloModels = []string{"boards", "lists", "cards"}
+
+// ModelTag is the tag of cache entries depending on the Trello board, list or
+// card with id.
+func ModelTag(id string) string {
+	return "model:" + id
+}
+
+// UserTag is the tag of cache entries of the Trello member with id.
+func UserTag(id string) string {
+	return "user:" + id
+}
+
+// RouteTag is the tag of cache entries of requests matching route, which is
+// the path of a request with any IDs replaced by {id}, e.g. /lists/{id}.
+func RouteTag(route string) string {
+	return "route:" + route
+}
+
+// PurgeTags returns the tags to purge by, as given in values. Values of "tag"
+// are tags as they are, while "model", "user" and "route" are the IDs of Trello
+// models and members, and routes, e.g. /lists/{id}.
+func PurgeTags(values url.Values) []string {
+	tags := make([]string, 0)
+
+	tags = append(tags, values["tag"]...)
+
+	for _, id := range values["model"] {
+		tags = append(tags, ModelTag(id))
+	}
+
+	for _, id := range values["user"] {
+		tags = append(tags, UserTag(id))
+	}
+
+	for _, route := range values["route"] {
+		tags = append(tags, RouteTag(route))
+	}
+
+	return tags
+}
+
+// TrelloModelIDs returns the IDs of the boards, lists and cards a request to
+// the Trello API is about, as found in the path of u. The requests bundled in a
+// batch request are considered as well.
+func TrelloModelIDs(u *url.URL) []string {
+	ids := make([]string, 0)
+
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+
+	for i := 0; i < len(segments)-1; i++ {
+		for _, model := range trelloModels {
+			if segments[i] == model && trelloIDPattern.MatchString(segments[i+1]) {
+				ids = append(ids, segments[i+1])
+			}
+		}
+	}
+
+	if segments[len(segments)-1] == "batch" {
+		for _, rawURL := range strings.Split(u.Query().Get("urls"), ",") {
+			if batched, err := url.Parse(rawURL); err == nil && rawURL != "" {
+				ids = append(ids, TrelloModelIDs(batched)...)
+			}
+		}
+	}
+
+	return ids
+}
+
+// TrelloRoute returns the path of u, with the IDs of Trello models replaced by
+// {id}, e.g. /1/lists/{id}/cards.
+func TrelloRoute(u *url.URL) string {
+	segments := strings.Split(u.Path, "/")
+
+	for i := range segments {
+		if trelloIDPattern.MatchString(segments[i]) {
+			segments[i] = "{id}"
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// CacheTags collects the tags of a response, while it's being built. Requests
+// can be made concurrently, so it's safe for concurrent use.
+type CacheTags struct {
+	mutex sync.Mutex
+	tags  map[string]bool
+	user  string
+}
+
+func NewCacheTags() *CacheTags {
+	return &CacheTags{tags: make(map[string]bool)}
+}
+
+func (t *CacheTags) Add(tags ...string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for _, tag := range tags {
+		t.tags[tag] = true
+	}
+}
+
+// Tags returns the tags added so far, in order, along with the tag of the
+// user, if known.
+func (t *CacheTags) Tags() []string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	tags := make([]string, 0, len(t.tags)+1)
+	for tag := range t.tags {
+		tags = append(tags, tag)
+	}
+
+	if t.user != "" {
+		tags = append(tags, UserTag(t.user))
+	}
+
+	sort.Strings(tags)
+
+	return tags
+}
+
+// SetUser sets the ID of the member the response is built for.
+func (t *CacheTags) SetUser(id string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.user = id
+}
+
+// User returns the ID of the member the response is built for, which is empty
+// until it's known.
+func (t *CacheTags) User() string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.user
+}
+
+type cacheTagsKey struct{}
+
+// NewCacheTagsContext returns a copy of ctx, in which the tags of the response
+// being built are collected in tags.
+func NewCacheTagsContext(ctx context.Context, tags *CacheTags) context.Context {
+	return context.WithValue(ctx, cacheTagsKey{}, tags)
+}
+
+// CacheTagsFromContext returns the tags collected in ctx, or nil if they
+// aren't.
+func CacheTagsFromContext(ctx context.Context) *CacheTags {
+	tags, _ := ctx.Value(cacheTagsKey{}).(*CacheTags)
+	return tags
+}
+
+// CacheTagger is implemented by caches, which keep track of the tags of their
+// entries.
+type CacheTagger interface {
+	Tag(ctx context.Context, key string, tags []string) error
+}
+
+// TaggedCache is a RedisCacheProvider, which keeps track of the tags of its
+// entries, such as the Trello models, user and route each entry depends on.
+// Entries can then be purged by tag, e.g. when a board changes. The keys of
+// the entries with each tag are kept in a Redis set.
+type TaggedCache struct {
+	RedisCacheProvider
+
+	client RedisSetProvider
+	prefix string
+	// How long the set of a tag is kept after an entry was last tagged with
+	// it. It should be at least as long as the entries are kept.
+	expiration time.Duration
+}
+
+func NewTaggedCache(
+	cache RedisCacheProvider,
+	client RedisSetProvider,
+	prefix string,
+	expiration time.Duration,
+) *TaggedCache {
+	return &TaggedCache{cache, client, prefix, expiration}
+}
+
+func (c *TaggedCache) setKey(tag string) string {
+	return fmt.Sprintf("%s-tag-%s", c.prefix, tag)
+}
+
+// Tag records that the entry with key has tags.
+func (c *TaggedCache) Tag(ctx context.Context, key string, tags []string) error {
+	for _, tag := range tags {
+		err := c.client.SAdd(ctx, c.setKey(tag), key).Err()
+		if err != nil {
+			return err
+		}
+
+		if c.expiration > 0 {
+			err = c.client.Expire(ctx, c.setKey(tag), c.expiration).Err()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Purge deletes all entries with any of tags, and returns the number of
+// entries deleted. Entries which have already expired are counted as well.
+func (c *TaggedCache) Purge(ctx context.Context, tags []string) (int, error) {
+	purged := make(map[string]bool)
+
+	for _, tag := range tags {
+		keys, err := c.client.SMembers(ctx, c.setKey(tag)).Result()
+		if err != nil {
+			return len(purged), err
+		}
+
+		for _, key := range keys {
+			if purged[key] {
+				continue
+			}
+
+			err = c.Delete(ctx, key)
+			if err != nil {
+				return len(purged), err
+			}
+
+			purged[key] = true
+		}
+
+		err = c.client.Del(ctx, c.setKey(tag)).Err()
+		if err != nil {
+			return len(purged), err
+		}
+	}
+
+	return len(purged), nil
+}
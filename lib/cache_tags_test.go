@@ -0,0 +1,228 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/go-redis/cache/v8"
+	"github.com/go-redis/redis/v8"
+)
+
+// MockSets keeps Redis sets in memory
+type MockSets struct {
+	sets map[string]map[string]bool
+}
+
+func (m *MockSets) SAdd(ctx context.Context, key string, members ...interface{}) *redis.IntCmd {
+	if m.sets[key] == nil {
+		m.sets[key] = make(map[string]bool)
+	}
+
+	for _, member := range members {
+		m.sets[key][member.(string)] = true
+	}
+
+	return redis.NewIntResult(int64(len(members)), nil)
+}
+
+func (m *MockSets) SMembers(ctx context.Context, key string) *redis.StringSliceCmd {
+	members := make([]string, 0)
+	for member := range m.sets[key] {
+		members = append(members, member)
+	}
+
+	sort.Strings(members)
+
+	return redis.NewStringSliceResult(members, nil)
+}
+
+func (m *MockSets) Del(ctx context.Context, keys ...string) *redis.IntCmd {
+	for _, key := range keys {
+		delete(m.sets, key)
+	}
+
+	return redis.NewIntResult(int64(len(keys)), nil)
+}
+
+func (m *MockSets) Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd {
+	return redis.NewBoolResult(true, nil)
+}
+
+// MockEntries keeps cache entries in memory
+type MockEntries struct {
+	entries map[string]interface{}
+}
+
+func (m *MockEntries) Once(item *cache.Item) error {
+	return errors.New("not implemented")
+}
+
+func (m *MockEntries) Get(ctx context.Context, key string, value interface{}) error {
+	entry, ok := m.entries[key]
+	if !ok {
+		return cache.ErrCacheMiss
+	}
+
+	reflect.ValueOf(value).Elem().Set(reflect.ValueOf(entry))
+
+	return nil
+}
+
+func (m *MockEntries) Set(item *cache.Item) error {
+	m.entries[item.Key] = item.Value
+	return nil
+}
+
+func (m *MockEntries) Delete(ctx context.Context, key string) error {
+	delete(m.entries, key)
+	return nil
+}
+
+func TestTrelloModelIDs(t *testing.T) {
+	board := "5f1b0e6ad0a4a1c1e0c8b001"
+	list := "5f1b0e6ad0a4a1c1e0c8b002"
+	card := "5f1b0e6ad0a4a1c1e0c8b003"
+
+	tests := []struct {
+		rawURL   string
+		expected []string
+	}{
+		{"https://api.trello.com/1/members/me/boards", []string{}},
+		{"https://api.trello.com/1/boards/" + board + "?lists=all", []string{board}},
+		{"https://api.trello.com/1/lists/" + list + "/cards", []string{list}},
+		{"https://api.trello.com/1/cards/" + card + "/attachments/abc", []string{card}},
+		{"https://api.trello.com/1/cards/shortlink", []string{}},
+		{
+			"https://api.trello.com/1/batch?urls=" +
+				url.QueryEscape("/boards/"+board+"/cards,/lists/"+list+"/cards"),
+			[]string{board, list},
+		},
+	}
+
+	for _, test := range tests {
+		u, _ := url.Parse(test.rawURL)
+
+		actual := TrelloModelIDs(u)
+
+		if !reflect.DeepEqual(test.expected, actual) {
+			t.Errorf("Expected %v for %s, actually got %v", test.expected, test.rawURL, actual)
+		}
+	}
+}
+
+func TestTrelloRoute(t *testing.T) {
+	u, _ := url.Parse("https://api.trello.com/1/cards/5f1b0e6ad0a4a1c1e0c8b003/attachments/5f1b0e6ad0a4a1c1e0c8b004?fields=all")
+
+	if actual := TrelloRoute(u); actual != "/1/cards/{id}/attachments/{id}" {
+		t.Errorf("Expected route /1/cards/{id}/attachments/{id}, actually %s", actual)
+	}
+}
+
+func TestTaggedCache(t *testing.T) {
+	ctx := context.Background()
+
+	entries := &MockEntries{map[string]interface{}{
+		"a": []byte("a"),
+		"b": []byte("b"),
+		"c": []byte("c"),
+	}}
+	tagged := NewTaggedCache(entries, &MockSets{make(map[string]map[string]bool)}, "test", time.Hour)
+
+	tagged.Tag(ctx, "a", []string{"board", "list"})
+	tagged.Tag(ctx, "b", []string{"list", "card"})
+	tagged.Tag(ctx, "c", []string{"other"})
+
+	purged, err := tagged.Purge(ctx, []string{"board", "list"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if purged != 2 {
+		t.Errorf("Expected 2 entries purged, actually %d", purged)
+	}
+
+	if _, ok := entries.entries["c"]; !ok || len(entries.entries) != 1 {
+		t.Errorf("Expected only entry c left, actually %v", entries.entries)
+	}
+
+	purged, _ = tagged.Purge(ctx, []string{"list"})
+	if purged != 0 {
+		t.Errorf("Expected the tag list to be gone, actually purged %d", purged)
+	}
+}
+
+func TestRoundTripTags(t *testing.T) {
+	board := "5f1b0e6ad0a4a1c1e0c8b001"
+	member := "5f1b0e6ad0a4a1c1e0c8b009"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/1/members/me" {
+			fmt.Fprintf(w, `{"id":"%s"}`, member)
+		} else {
+			fmt.Fprintf(w, `[{"id":"%s"}]`, board)
+		}
+	}))
+	defer server.Close()
+
+	entries := &MockEntries{make(map[string]interface{})}
+	sets := &MockSets{make(map[string]map[string]bool)}
+
+	transport := NewCachingTransport(NewTaggedCache(entries, sets, "test", time.Hour), time.Minute)
+
+	for _, hit := range []bool{false, true} {
+		collected := NewCacheTags()
+		ctx := NewCacheTagsContext(context.Background(), collected)
+
+		for _, path := range []string{"/1/members/me", "/1/members/me/boards"} {
+			request := httptest.NewRequest("GET", server.URL+path, nil).WithContext(ctx)
+
+			_, err := transport.RoundTrip(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		expected := []string{ModelTag(board), UserTag(member)}
+		if actual := collected.Tags(); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("Expected tags %v with hit %t, actually %v", expected, hit, actual)
+		}
+	}
+
+	for _, tag := range []string{ModelTag(board), UserTag(member), RouteTag("/1/members/me/boards")} {
+		if !sets.sets["test-tag-"+tag][server.URL+"/1/members/me/boards"] {
+			t.Errorf("Expected the boards of the member to be tagged %s, actually %v", tag, sets.sets)
+		}
+	}
+
+	purged, err := transport.Cache.(*TaggedCache).Purge(context.Background(), []string{UserTag(member)})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if purged != 2 || len(entries.entries) != 0 {
+		t.Errorf("Expected the responses to be purged, actually %d purged", purged)
+	}
+}
+
+func TestPurgeTags(t *testing.T) {
+	values := url.Values{
+		"tag":   []string{"model:a"},
+		"model": []string{"b"},
+		"user":  []string{"c", "d"},
+		"route": []string{"/lists/{id}"},
+	}
+
+	expected := []string{"model:a", "model:b", "user:c", "user:d", "route:/lists/{id}"}
+
+	if actual := PurgeTags(values); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected tags %v, actually %v", expected, actual)
+	}
+}
@@ -3,27 +3,78 @@ package lib
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"net/http/httputil"
+	"regexp"
+	"sync"
 	"time"
 
 	"github.com/go-redis/cache/v8"
 )
 
+// Boards of a member are listed without their IDs in the path, so responses
+// listing them depend on each of the boards listed instead
+var memberBoardsPattern = regexp.MustCompile(`/members/[^/]+/boards$`)
+
+// The current member is requested first thing, which tells the user everything
+// requested after is for
+var currentMemberPattern = regexp.MustCompile(`/members/me$`)
+
+// How long a response may take to refresh in the background
+const refreshTimeout = 30 * time.Second
+
 // CachingTransport is an implementation of http.RoundTripper which provides a
-// caching wrapper around http.DefaultTransport.RoundTrip.
+// caching wrapper around the RoundTrip of Transport, or http.DefaultTransport
+// if it's nil. Only GET requests are cached. If Cache is a CacheTagger,
+// responses are tagged with the Trello models they are about, their route and
+// user, as far as it's known.
 type CachingTransport struct {
-	Cache      RedisCacheProvider
+	Cache     RedisCacheProvider
+	Transport http.RoundTripper
+	// For how long responses are still served after they expire, while they
+	// are refreshed in the background
+	StaleFor time.Duration
+	// For how long a copy of each successful response is kept, to fall back on
+	// when the server fails. Copies aren't tagged, so they outlive purges.
+	FallbackFor time.Duration
+	// Counts of how requests were answered
+	Metrics CacheMetrics
+
 	expiration time.Duration
+
+	// Keys of the responses being refreshed in the background
+	refreshing      map[string]bool
+	refreshingMutex sync.Mutex
 }
 
 func NewCachingTransport(
 	rcp RedisCacheProvider,
 	expiration time.Duration,
 ) *CachingTransport {
-	return &CachingTransport{rcp, expiration}
+	return &CachingTransport{
+		Cache:      rcp,
+		expiration: expiration,
+		refreshing: make(map[string]bool),
+	}
+}
+
+// cachedResponse is a dump of a response, along with when it was stored or
+// last revalidated.
+type cachedResponse struct {
+	Dump   []byte
+	Stored time.Time
+}
+
+// Reads the cached response as a response to r.
+func (c cachedResponse) read(r *http.Request) (*http.Response, error) {
+	return http.ReadResponse(bufio.NewReader(bytes.NewReader(c.Dump)), r)
 }
 
 // RoundTrip adds caching behaviour to the default http transport, such that if
@@ -31,46 +82,358 @@ func NewCachingTransport(
 // pre-empting a full http request. If a cached response doesn't exist, a
 // regular request is sent to the target server and then the response is cached,
 // before being retured to the caller.
+//
+// Expired responses are still returned for StaleFor, while they are refreshed
+// in the background. Responses are refreshed with a conditional request, if
+// they came with an ETag or Last-Modified header, so unmodified ones are only
+// stored again.
+//
+// If the server fails, by not answering, answering with a server error or
+// because of too many requests, the last known good response is returned
+// instead, as long as it's kept. The Degradation in the context of the request
+// then notes that it's degraded.
+//
+// The Trello models each response is about are added to the CacheTags in the
+// context of the request, if any, whether it's cached or not.
 func (c *CachingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
-	var cachedDump []byte
+	if r.Method != http.MethodGet {
+		return c.transport().RoundTrip(r)
+	}
+
+	var cached cachedResponse
 
-	err := c.Cache.Get(r.Context(), cacheKey(r), &cachedDump)
+	err := c.Cache.Get(r.Context(), cacheKey(r), &cached)
 	if err == nil {
-		log.Println(fmt.Sprintf("Cache hit for %s", r.URL.Path))
+		age := time.Since(cached.Stored)
+
+		if age < c.expiration+c.StaleFor {
+			if age < c.expiration {
+				log.Println(fmt.Sprintf("Cache hit for %s", r.URL.Path))
+				c.Metrics.add(&c.Metrics.hits)
+			} else {
+				log.Println(fmt.Sprintf("Cache stale for %s", r.URL.Path))
+				c.Metrics.add(&c.Metrics.stale)
+
+				c.refreshInBackground(r, cached)
+			}
+
+			resp, err := cached.read(r)
+			if err != nil {
+				return nil, err
+			}
 
-		reader := bufio.NewReader(bytes.NewBuffer(cachedDump))
+			_, err = addTags(r, resp)
+			if err != nil {
+				return nil, err
+			}
 
-		return http.ReadResponse(reader, r)
+			return resp, nil
+		}
 	}
 
 	log.Println(fmt.Sprintf("Cache miss for %s", r.URL.Path))
+	c.Metrics.add(&c.Metrics.misses)
+
+	var resp *http.Response
+
+	// An entry too old to be served may still be revalidated
+	if err != nil {
+		resp, err = c.fetch(r, nil)
+	} else {
+		resp, err = c.fetch(r, &cached)
+	}
+
+	if failure := serverFailure(resp, err); failure != nil {
+		fallback, fallbackErr := c.fallBack(r)
+		if fallbackErr != nil {
+			return resp, err
+		}
+
+		log.Println(fmt.Sprintf("Falling back for %s: %s", r.URL.Path, failure))
+
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		return fallback, nil
+	}
+
+	return resp, err
+}
+
+// Returns the last known good response to r, and notes that the response
+// being built in its context is degraded.
+func (c *CachingTransport) fallBack(r *http.Request) (*http.Response, error) {
+	var fallback cachedResponse
+
+	err := c.Cache.Get(r.Context(), fallbackKey(r), &fallback)
+	if err != nil {
+		return nil, err
+	}
 
-	resp, err := http.DefaultTransport.RoundTrip(r)
+	resp, err := fallback.read(r)
 	if err != nil {
 		return nil, err
 	}
 
-	dump, err := httputil.DumpResponse(resp, true)
+	_, err = addTags(r, resp)
 	if err != nil {
 		return nil, err
 	}
 
+	c.Metrics.add(&c.Metrics.fallbacks)
+	degrade(r.Context())
+
+	return resp, nil
+}
+
+// Requests a response to r from the server, and caches it. If there's a cached
+// response, the request is made conditional on it having changed, and the
+// cached response is returned if it hasn't. Responses from a failing server
+// are returned, but not cached, see serverFailure.
+func (c *CachingTransport) fetch(r *http.Request, cached *cachedResponse) (*http.Response, error) {
+	request := r
+
+	if cached != nil {
+		request = r.Clone(r.Context())
+
+		if validated := setValidators(request, *cached); !validated {
+			cached = nil
+		}
+	}
+
+	resp, err := c.transport().RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if serverFailure(resp, nil) != nil {
+		return resp, nil
+	}
+
+	var dump []byte
+
+	if cached != nil && resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+
+		log.Println(fmt.Sprintf("Cache revalidated for %s", r.URL.Path))
+		c.Metrics.add(&c.Metrics.revalidated)
+
+		dump = cached.Dump
+
+		resp, err = cached.read(r)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		dump, err = httputil.DumpResponse(resp, true)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	err = c.Cache.Set(&cache.Item{
 		Ctx:   r.Context(),
 		Key:   cacheKey(r),
-		Value: dump,
-		TTL:   c.expiration,
+		Value: cachedResponse{dump, time.Now()},
+		TTL:   c.expiration + c.StaleFor,
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
+	if c.FallbackFor > 0 && resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		err = c.Cache.Set(&cache.Item{
+			Ctx:   r.Context(),
+			Key:   fallbackKey(r),
+			Value: cachedResponse{dump, time.Now()},
+			TTL:   c.FallbackFor,
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tags, err := addTags(r, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if tagger, ok := c.Cache.(CacheTagger); ok {
+		err = tagger.Tag(r.Context(), cacheKey(r), tags)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+
 	return resp, nil
 }
 
+// Returns the transport requests are made with.
+func (c *CachingTransport) transport() http.RoundTripper {
+	if c.Transport == nil {
+		return http.DefaultTransport
+	}
+
+	return c.Transport
+}
+
+// Refreshes the cached response to r, unless it's already being refreshed. The
+// refresh outlives r, so it's made with a context of its own, which only knows
+// the user of r.
+func (c *CachingTransport) refreshInBackground(r *http.Request, cached cachedResponse) {
+	key := cacheKey(r)
+
+	c.refreshingMutex.Lock()
+	defer c.refreshingMutex.Unlock()
+
+	if c.refreshing[key] {
+		return
+	}
+
+	c.refreshing[key] = true
+
+	tags := NewCacheTags()
+	if collected := CacheTagsFromContext(r.Context()); collected != nil {
+		tags.SetUser(collected.User())
+	}
+
+	go func() {
+		defer func() {
+			c.refreshingMutex.Lock()
+			defer c.refreshingMutex.Unlock()
+
+			delete(c.refreshing, key)
+		}()
+
+		ctx, cancel := context.WithTimeout(
+			NewCacheTagsContext(context.Background(), tags),
+			refreshTimeout,
+		)
+		defer cancel()
+
+		resp, err := c.fetch(r.Clone(ctx), &cached)
+		if failure := serverFailure(resp, err); failure != nil {
+			log.Println(fmt.Sprintf("Refreshing %s failed: %s", r.URL.Path, failure))
+			c.Metrics.add(&c.Metrics.refreshErrors)
+
+			if resp != nil {
+				resp.Body.Close()
+			}
+
+			return
+		}
+
+		// Only the cached copy matters, but the body must be read all the
+		// same, so the connection can be reused
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+}
+
+// Returns why the server failed to answer, if it did, by not answering at all,
+// with a server error, or because of too many requests. Otherwise it's nil.
+func serverFailure(resp *http.Response, err error) error {
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return errors.New(fmt.Sprintf("Server answered %s", resp.Status))
+	}
+
+	return nil
+}
+
+// Makes request conditional on the cached response having changed, by the
+// validators it came with. If it didn't come with any, false is returned.
+func setValidators(request *http.Request, cached cachedResponse) bool {
+	resp, err := cached.read(request)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+
+	etag := resp.Header.Get("ETag")
+	lastModified := resp.Header.Get("Last-Modified")
+
+	if etag != "" {
+		request.Header.Set("If-None-Match", etag)
+	}
+
+	if lastModified != "" {
+		request.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	return etag != "" || lastModified != ""
+}
+
+// Adds the tags of the Trello models resp is about to the CacheTags in the
+// context of r, and returns them along with the tags of its route and user.
+// The body of resp is read, if it lists boards or is the current member, but
+// left as it was.
+func addTags(r *http.Request, resp *http.Response) ([]string, error) {
+	ids := TrelloModelIDs(r.URL)
+
+	listsBoards := memberBoardsPattern.MatchString(r.URL.Path)
+	isMember := currentMemberPattern.MatchString(r.URL.Path)
+
+	collected := CacheTagsFromContext(r.Context())
+
+	if listsBoards || isMember {
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		var boards []struct {
+			ID string `json:"id"`
+		}
+
+		var member struct {
+			ID string `json:"id"`
+		}
+
+		// Errors come with a body which is neither, and tell nothing
+		if listsBoards && json.Unmarshal(body, &boards) == nil {
+			for i := range boards {
+				ids = append(ids, boards[i].ID)
+			}
+		}
+
+		if isMember && json.Unmarshal(body, &member) == nil && member.ID != "" && collected != nil {
+			collected.SetUser(member.ID)
+		}
+	}
+
+	tags := make([]string, 0, len(ids)+2)
+	for _, id := range ids {
+		tags = append(tags, ModelTag(id))
+	}
+
+	if collected != nil {
+		collected.Add(tags...)
+
+		if user := collected.User(); user != "" {
+			tags = append(tags, UserTag(user))
+		}
+	}
+
+	return append(tags, RouteTag(TrelloRoute(r.URL))), nil
+}
+
 // cacheKey is the full url for the request including query params with key and
 // token
 func cacheKey(r *http.Request) string {
 	return r.URL.String()
 }
+
+// fallbackKey is the key of the last known good response to the request.
+func fallbackKey(r *http.Request) string {
+	return "fallback-" + cacheKey(r)
+}
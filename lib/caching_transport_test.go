@@ -2,6 +2,7 @@ package lib
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -10,6 +11,8 @@ import (
 	"net/http/httptest"
 	"testing"
 	"time"
+
+	"github.com/go-redis/cache/v8"
 )
 
 type MockCache struct {
@@ -18,7 +21,11 @@ type MockCache struct {
 	SetValue string
 }
 
-func (m MockCache) Get(key string) (string, error) {
+func (m MockCache) Once(item *cache.Item) error {
+	return errors.New("not implemented")
+}
+
+func (m MockCache) Get(ctx context.Context, key string, value interface{}) error {
 	if m.Hit {
 		buf := new(bytes.Buffer)
 
@@ -26,14 +33,20 @@ func (m MockCache) Get(key string) (string, error) {
 		t := http.Response{Body: body}
 		t.Write(buf)
 
-		return buf.String(), nil
+		*value.(*cachedResponse) = cachedResponse{buf.Bytes(), time.Now()}
+
+		return nil
 	} else {
-		return "", errors.New("")
+		return errors.New("")
 	}
 }
 
-func (m *MockCache) Set(key string, value string, expiration time.Duration) error {
-	m.SetValue = value
+func (m *MockCache) Set(item *cache.Item) error {
+	m.SetValue = string(item.Value.(cachedResponse).Dump)
+	return nil
+}
+
+func (m *MockCache) Delete(ctx context.Context, key string) error {
 	return nil
 }
 
@@ -49,7 +62,7 @@ func TestRoundTrip(t *testing.T) {
 	expiration := time.Minute // Doesn't matter for this test
 	timestamp := "2006-01-02 15:04:05"
 
-	transport := NewCachingTransport(expiration)
+	transport := NewCachingTransport(nil, expiration)
 
 	// http test server that constructs a simple but properly formatted  http
 	// response
@@ -119,3 +132,227 @@ func TestRoundTrip(t *testing.T) {
 		})
 	})
 }
+
+// Dumps a response with body and etag, as it's cached
+func dumpResponse(body, etag string) []byte {
+	buf := new(bytes.Buffer)
+
+	response := http.Response{
+		StatusCode: http.StatusOK,
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Etag": []string{etag}},
+		Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+	}
+	response.Write(buf)
+
+	return buf.Bytes()
+}
+
+func TestRoundTripStale(t *testing.T) {
+	// The server has a newer version, than the one cached
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v2"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("ETag", `"v2"`)
+		fmt.Fprint(w, "new")
+	}))
+	defer server.Close()
+
+	request := httptest.NewRequest("GET", server.URL, nil)
+
+	newTransport := func(stored time.Time, etag string) (*CachingTransport, *MockEntries) {
+		entries := &MockEntries{map[string]interface{}{
+			cacheKey(request): cachedResponse{dumpResponse("cached", etag), stored},
+		}}
+
+		transport := NewCachingTransport(entries, time.Hour)
+		transport.StaleFor = time.Hour
+
+		return transport, entries
+	}
+
+	t.Run("serves expired responses and refreshes them", func(t *testing.T) {
+		transport, entries := newTransport(time.Now().Add(-90*time.Minute), `"v1"`)
+
+		response, err := transport.RoundTrip(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if actual := bodyToString(response.Body); actual != "cached" {
+			t.Errorf("Expected the stale response, actually got '%s'", actual)
+		}
+
+		// Wait for the refresh to be done
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			transport.refreshingMutex.Lock()
+			refreshing := len(transport.refreshing)
+			transport.refreshingMutex.Unlock()
+
+			if refreshing == 0 {
+				break
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		refreshed, err := entries.entries[cacheKey(request)].(cachedResponse).read(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if actual := bodyToString(refreshed.Body); actual != "new" {
+			t.Errorf("Expected the refreshed response to be cached, actually '%s'", actual)
+		}
+
+		counts := transport.Metrics.Counts()
+		if counts["stale"] != 1 || counts["hit"] != 0 {
+			t.Errorf("Expected a stale response to be counted, actually %v", counts)
+		}
+	})
+
+	t.Run("revalidates responses too old to serve", func(t *testing.T) {
+		stored := time.Now().Add(-3 * time.Hour)
+		transport, entries := newTransport(stored, `"v2"`)
+
+		response, err := transport.RoundTrip(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if actual := bodyToString(response.Body); actual != "cached" {
+			t.Errorf("Expected the revalidated response, actually got '%s'", actual)
+		}
+
+		if !entries.entries[cacheKey(request)].(cachedResponse).Stored.After(stored) {
+			t.Error("Expected the revalidated response to be stored again")
+		}
+
+		counts := transport.Metrics.Counts()
+		if counts["miss"] != 1 || counts["revalidated"] != 1 {
+			t.Errorf("Expected a revalidated miss to be counted, actually %v", counts)
+		}
+	})
+}
+
+func TestRoundTripFallback(t *testing.T) {
+	status := http.StatusOK
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		fmt.Fprint(w, http.StatusText(status))
+	}))
+	defer server.Close()
+
+	newRequest := func() (*http.Request, *Degradation) {
+		degradation := &Degradation{}
+		request := httptest.NewRequest("GET", server.URL, nil)
+
+		return request.WithContext(NewDegradationContext(request.Context(), degradation)), degradation
+	}
+
+	newTransport := func() (*CachingTransport, *MockEntries) {
+		entries := &MockEntries{map[string]interface{}{}}
+
+		transport := NewCachingTransport(entries, time.Hour)
+		transport.FallbackFor = 24 * time.Hour
+
+		return transport, entries
+	}
+
+	t.Run("keeps a copy of successful responses", func(t *testing.T) {
+		transport, entries := newTransport()
+		request, _ := newRequest()
+
+		_, err := transport.RoundTrip(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, ok := entries.entries[fallbackKey(request)]; !ok {
+			t.Error("Expected a copy of the response to be kept")
+		}
+	})
+
+	for _, failing := range []int{http.StatusServiceUnavailable, http.StatusTooManyRequests} {
+		t.Run(fmt.Sprintf("falls back on %d", failing), func(t *testing.T) {
+			transport, entries := newTransport()
+			request, degradation := newRequest()
+
+			entries.entries[fallbackKey(request)] = cachedResponse{
+				dumpResponse("last known good", `"v1"`),
+				time.Now().Add(-48 * time.Hour),
+			}
+
+			status = failing
+			defer func() { status = http.StatusOK }()
+
+			response, err := transport.RoundTrip(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if actual := bodyToString(response.Body); actual != "last known good" {
+				t.Errorf("Expected the last known good response, actually got '%s'", actual)
+			}
+
+			if !degradation.Degraded() {
+				t.Error("Expected the response to be noted as degraded")
+			}
+
+			if _, ok := entries.entries[cacheKey(request)]; ok {
+				t.Error("Expected the failed response not to be cached")
+			}
+
+			if counts := transport.Metrics.Counts(); counts["fallbacks"] != 1 {
+				t.Errorf("Expected a fallback to be counted, actually %v", counts)
+			}
+		})
+	}
+
+	t.Run("falls back when the server is unreachable", func(t *testing.T) {
+		transport, entries := newTransport()
+
+		request := httptest.NewRequest("GET", "http://127.0.0.1:1/unreachable", nil)
+		entries.entries[fallbackKey(request)] = cachedResponse{
+			dumpResponse("last known good", `"v1"`),
+			time.Now(),
+		}
+
+		response, err := transport.RoundTrip(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if actual := bodyToString(response.Body); actual != "last known good" {
+			t.Errorf("Expected the last known good response, actually got '%s'", actual)
+		}
+	})
+
+	t.Run("passes failures on without a copy", func(t *testing.T) {
+		transport, entries := newTransport()
+		request, degradation := newRequest()
+
+		status = http.StatusBadGateway
+		defer func() { status = http.StatusOK }()
+
+		response, err := transport.RoundTrip(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+
+		if response.StatusCode != http.StatusBadGateway {
+			t.Errorf("Expected the failed response, actually got %d", response.StatusCode)
+		}
+
+		if degradation.Degraded() || len(entries.entries) != 0 {
+			t.Error("Expected nothing to be cached or degraded")
+		}
+	})
+}
@@ -0,0 +1,114 @@
+package lib
+
+import (
+	"image"
+	"image/draw"
+)
+
+// MaxCollageImages is the largest number of images composed into a collage.
+const MaxCollageImages = 4
+
+// CollageCells returns the rectangles, which the first n images of a square
+// collage of the given size are placed in. A single image fills the square,
+// two are placed side by side, three as one on the left and two stacked on the
+// right, and four in a grid. Any images beyond MaxCollageImages are left out.
+func CollageCells(n, size int) []image.Rectangle {
+	half := size / 2
+
+	switch {
+	case n <= 0:
+		return []image.Rectangle{}
+	case n == 1:
+		return []image.Rectangle{image.Rect(0, 0, size, size)}
+	case n == 2:
+		return []image.Rectangle{
+			image.Rect(0, 0, half, size),
+			image.Rect(half, 0, size, size),
+		}
+	case n == 3:
+		return []image.Rectangle{
+			image.Rect(0, 0, half, size),
+			image.Rect(half, 0, size, half),
+			image.Rect(half, half, size, size),
+		}
+	default:
+		return []image.Rectangle{
+			image.Rect(0, 0, half, half),
+			image.Rect(half, 0, size, half),
+			image.Rect(0, half, half, size),
+			image.Rect(half, half, size, size),
+		}
+	}
+}
+
+// Collage composes images into a square of the given size, laid out as
+// described by CollageCells. Each image covers its cell entirely, so whatever
+// doesn't fit the aspect ratio of the cell is cropped evenly from both sides.
+func Collage(images []image.Image, size int) image.Image {
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+
+	for i, cell := range CollageCells(len(images), size) {
+		filled := Fill(images[i], cell.Dx(), cell.Dy())
+		draw.Draw(dst, cell, filled, filled.Bounds().Min, draw.Src)
+	}
+
+	return dst
+}
+
+// Fill scales img to cover width x height, keeping the aspect ratio, and crops
+// it around the center to exactly that size.
+func Fill(img image.Image, width, height int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	if w == 0 || h == 0 || width <= 0 || height <= 0 {
+		return image.NewRGBA(image.Rect(0, 0, width, height))
+	}
+
+	// The largest part of img with the aspect ratio of the target
+	cropWidth, cropHeight := w, h
+	if w*height > h*width {
+		cropWidth = (h*width + height/2) / height
+	} else {
+		cropHeight = (w*height + width/2) / width
+	}
+
+	x0 := b.Min.X + (w-cropWidth)/2
+	y0 := b.Min.Y + (h-cropHeight)/2
+
+	cropped := toRGBA(img).SubImage(image.Rect(
+		x0-b.Min.X,
+		y0-b.Min.Y,
+		x0-b.Min.X+cropWidth,
+		y0-b.Min.Y+cropHeight,
+	))
+
+	return scaleNearest(Resize(cropped, width), width, height)
+}
+
+// Scales img to exactly width x height, by picking the nearest pixel. This is
+// only meant for the small adjustments left after Resize, and for images too
+// small to be scaled down.
+func scaleNearest(img image.Image, width, height int) *image.RGBA {
+	src := toRGBA(img)
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+
+	if w == width && h == height {
+		return src
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		sy := y * h / height
+
+		for x := 0; x < width; x++ {
+			sx := x * w / width
+
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4],
+				src.Pix[src.PixOffset(sx, sy):src.PixOffset(sx, sy)+4])
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,105 @@
+package lib
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestCollageCells(t *testing.T) {
+	for n, expected := range map[int][]image.Rectangle{
+		0: {},
+		1: {image.Rect(0, 0, 10, 10)},
+		2: {image.Rect(0, 0, 5, 10), image.Rect(5, 0, 10, 10)},
+		3: {image.Rect(0, 0, 5, 10), image.Rect(5, 0, 10, 5), image.Rect(5, 5, 10, 10)},
+		4: {
+			image.Rect(0, 0, 5, 5),
+			image.Rect(5, 0, 10, 5),
+			image.Rect(0, 5, 5, 10),
+			image.Rect(5, 5, 10, 10),
+		},
+	} {
+		actual := CollageCells(n, 10)
+
+		if len(actual) != len(expected) {
+			t.Fatalf("Expected %d cells for %d images, actually got %d", len(expected), n, len(actual))
+		}
+
+		for i := range expected {
+			if actual[i] != expected[i] {
+				t.Errorf("Expected cell %d of %d to be %v, actually got %v", i, n, expected[i], actual[i])
+			}
+		}
+	}
+
+	if actual := len(CollageCells(5, 10)); actual != MaxCollageImages {
+		t.Errorf("Expected %d cells for 5 images, actually got %d", MaxCollageImages, actual)
+	}
+}
+
+func TestFill(t *testing.T) {
+	// A 4x2 image with a red half to the left and a blue one to the right
+	img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 4; x++ {
+			if x < 2 {
+				img.Set(x, y, color.RGBA{255, 0, 0, 255})
+			} else {
+				img.Set(x, y, color.RGBA{0, 0, 255, 255})
+			}
+		}
+	}
+
+	t.Run("Crops evenly from both sides", func(t *testing.T) {
+		filled := Fill(img, 2, 2)
+
+		if filled.Bounds() != image.Rect(0, 0, 2, 2) {
+			t.Fatalf("Expected bounds %v, actually got %v", image.Rect(0, 0, 2, 2), filled.Bounds())
+		}
+
+		if actual := color.RGBAModel.Convert(filled.At(0, 0)); actual != (color.RGBA{255, 0, 0, 255}) {
+			t.Errorf("Expected red to the left, actually got %v", actual)
+		}
+
+		if actual := color.RGBAModel.Convert(filled.At(1, 0)); actual != (color.RGBA{0, 0, 255, 255}) {
+			t.Errorf("Expected blue to the right, actually got %v", actual)
+		}
+	})
+
+	t.Run("Scales up small images", func(t *testing.T) {
+		filled := Fill(img, 8, 8)
+
+		if filled.Bounds() != image.Rect(0, 0, 8, 8) {
+			t.Fatalf("Expected bounds %v, actually got %v", image.Rect(0, 0, 8, 8), filled.Bounds())
+		}
+	})
+}
+
+func TestCollage(t *testing.T) {
+	red := image.NewUniform(color.RGBA{255, 0, 0, 255})
+	blue := image.NewUniform(color.RGBA{0, 0, 255, 255})
+
+	redImage := image.NewRGBA(image.Rect(0, 0, 3, 3))
+	blueImage := image.NewRGBA(image.Rect(0, 0, 3, 3))
+
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 3; x++ {
+			redImage.Set(x, y, red.C)
+			blueImage.Set(x, y, blue.C)
+		}
+	}
+
+	collage := Collage([]image.Image{redImage, blueImage}, 10)
+
+	if collage.Bounds() != image.Rect(0, 0, 10, 10) {
+		t.Fatalf("Expected bounds %v, actually got %v", image.Rect(0, 0, 10, 10), collage.Bounds())
+	}
+
+	if actual := color.RGBAModel.Convert(collage.At(2, 8)); actual != red.C {
+		t.Errorf("Expected red to the left, actually got %v", actual)
+	}
+
+	if actual := color.RGBAModel.Convert(collage.At(7, 1)); actual != blue.C {
+		t.Errorf("Expected blue to the right, actually got %v", actual)
+	}
+}
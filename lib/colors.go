@@ -0,0 +1,95 @@
+package lib
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// EdgeColor is the average color of the pixels along the border of img.
+func EdgeColor(img image.Image) color.RGBA {
+	b := img.Bounds()
+
+	var sum [3]uint64
+	var n uint64
+
+	add := func(x, y int) {
+		r, g, b, _ := img.At(x, y).RGBA()
+
+		sum[0] += uint64(r >> 8)
+		sum[1] += uint64(g >> 8)
+		sum[2] += uint64(b >> 8)
+		n++
+	}
+
+	for x := b.Min.X; x < b.Max.X; x++ {
+		add(x, b.Min.Y)
+
+		if b.Dy() > 1 {
+			add(x, b.Max.Y-1)
+		}
+	}
+
+	// Corners are already included by the rows above
+	for y := b.Min.Y + 1; y < b.Max.Y-1; y++ {
+		add(b.Min.X, y)
+
+		if b.Dx() > 1 {
+			add(b.Max.X-1, y)
+		}
+	}
+
+	if n == 0 {
+		return color.RGBA{0, 0, 0, 255}
+	}
+
+	return color.RGBA{uint8(sum[0] / n), uint8(sum[1] / n), uint8(sum[2] / n), 255}
+}
+
+// DominantColor finds the most common color of img. Colors are first reduced
+// to a palette of 4096, by keeping the 4 most significant bits of each channel,
+// and the result is the average of the pixels in the most common entry.
+func DominantColor(img image.Image) color.RGBA {
+	b := img.Bounds()
+
+	type bucket struct {
+		count   int
+		r, g, b int
+	}
+
+	var palette [1 << 12]bucket
+	best := -1
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, _ := img.At(x, y).RGBA()
+			r, g, bl = r>>8, g>>8, bl>>8
+
+			i := int(r>>4)<<8 | int(g>>4)<<4 | int(bl>>4)
+
+			palette[i].count++
+			palette[i].r += int(r)
+			palette[i].g += int(g)
+			palette[i].b += int(bl)
+
+			if best < 0 || palette[i].count > palette[best].count {
+				best = i
+			}
+		}
+	}
+
+	if best < 0 {
+		return color.RGBA{0, 0, 0, 255}
+	}
+
+	p := palette[best]
+
+	return color.RGBA{uint8(p.r / p.count), uint8(p.g / p.count), uint8(p.b / p.count), 255}
+}
+
+// HexColor formats a color like "#rrggbb", disregarding alpha.
+func HexColor(c color.Color) string {
+	r, g, b, _ := c.RGBA()
+
+	return fmt.Sprintf("#%02x%02x%02x", r>>8, g>>8, b>>8)
+}
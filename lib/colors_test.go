@@ -0,0 +1,42 @@
+package lib
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestEdgeColor(t *testing.T) {
+	// A 3x3 white image with a black pixel in the center, which isn't on the edge
+	img := image.NewRGBA(image.Rect(0, 0, 3, 3))
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 3; x++ {
+			img.Set(x, y, color.White)
+		}
+	}
+	img.Set(1, 1, color.Black)
+
+	expected := "#ffffff"
+	if actual := HexColor(EdgeColor(img)); actual != expected {
+		t.Errorf("Expected %s, actually got %s", expected, actual)
+	}
+}
+
+func TestDominantColor(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 3, 1))
+	img.Set(0, 0, color.RGBA{200, 0, 0, 255})
+	img.Set(1, 0, color.RGBA{202, 0, 0, 255})
+	img.Set(2, 0, color.RGBA{0, 0, 255, 255})
+
+	expected := "#c90000"
+	if actual := HexColor(DominantColor(img)); actual != expected {
+		t.Errorf("Expected %s, actually got %s", expected, actual)
+	}
+}
+
+func TestHexColor(t *testing.T) {
+	expected := "#0a0b0c"
+	if actual := HexColor(color.RGBA{10, 11, 12, 255}); actual != expected {
+		t.Errorf("Expected %s, actually got %s", expected, actual)
+	}
+}
@@ -0,0 +1,45 @@
+package lib
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Degradation notes whether a response is being built from last known good
+// responses, because the server they came from failed. Requests can be made
+// concurrently, so it's safe for concurrent use.
+type Degradation struct {
+	degraded int32
+}
+
+// Degrade notes that the response is built from a last known good response.
+func (d *Degradation) Degrade() {
+	atomic.StoreInt32(&d.degraded, 1)
+}
+
+// Degraded tells whether the response is built from any last known good
+// responses.
+func (d *Degradation) Degraded() bool {
+	return atomic.LoadInt32(&d.degraded) == 1
+}
+
+type degradationKey struct{}
+
+// NewDegradationContext returns a copy of ctx, in which it's noted in
+// degradation whether the response being built is degraded.
+func NewDegradationContext(ctx context.Context, degradation *Degradation) context.Context {
+	return context.WithValue(ctx, degradationKey{}, degradation)
+}
+
+// IsDegraded tells whether the response being built in ctx is degraded.
+func IsDegraded(ctx context.Context) bool {
+	degradation, ok := ctx.Value(degradationKey{}).(*Degradation)
+	return ok && degradation.Degraded()
+}
+
+// Notes that the response being built in ctx is degraded, if it's noted.
+func degrade(ctx context.Context) {
+	if degradation, ok := ctx.Value(degradationKey{}).(*Degradation); ok {
+		degradation.Degrade()
+	}
+}
@@ -0,0 +1,263 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+
+	// Registers the gif decoder used by image.Decode
+	_ "image/gif"
+)
+
+// The amount of bytes read from the start of a file when looking for EXIF data.
+// The APP1 segment is limited to 64KiB and is placed right after the SOI
+// marker, so this should always cover it.
+const exifHeadSize = 1 << 16
+
+// DecodeImage decodes a JPEG, PNG or GIF image. If the image is a JPEG with an
+// EXIF orientation, it is applied, so the returned image is upright.
+func DecodeImage(data []byte) (image.Image, string, error) {
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+
+	if format == "jpeg" {
+		img = Orient(img, Orientation(data))
+	}
+
+	return img, format, nil
+}
+
+// DecodeImageConfig reads the dimensions of an image, taking EXIF orientation
+// into account, without decoding the entire image.
+func DecodeImageConfig(r io.Reader) (image.Config, error) {
+	head, err := ioutil.ReadAll(io.LimitReader(r, exifHeadSize))
+	if err != nil {
+		return image.Config{}, err
+	}
+
+	config, _, err := image.DecodeConfig(io.MultiReader(bytes.NewReader(head), r))
+	if err != nil {
+		return image.Config{}, err
+	}
+
+	if Orientation(head) >= 5 {
+		config.Width, config.Height = config.Height, config.Width
+	}
+
+	return config, nil
+}
+
+// EncodeImage encodes img as PNG if the original format was PNG, to keep
+// transparency, and as JPEG otherwise.
+func EncodeImage(w io.Writer, img image.Image, format string) error {
+	if format == "png" {
+		return png.Encode(w, img)
+	}
+
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: 85})
+}
+
+// Orientation finds the EXIF orientation tag of JPEG data. If there's no such
+// tag, 1 is returned, which is the default orientation.
+//
+// See https://www.exif.org/Exif2-2.PDF for the details on the format.
+func Orientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return 1
+	}
+
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xff {
+			return 1
+		}
+
+		marker := data[i+1]
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+
+		// Start of scan, the image data follows, so there's no more metadata
+		if marker == 0xda {
+			return 1
+		}
+
+		start, end := i+4, i+2+length
+		if end > len(data) {
+			return 1
+		}
+
+		if marker == 0xe1 && bytes.HasPrefix(data[start:end], []byte("Exif\x00\x00")) {
+			return tiffOrientation(data[start+6 : end])
+		}
+
+		i = end
+	}
+
+	return 1
+}
+
+// Finds the orientation tag in the first IFD of TIFF data
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	offset := int(order.Uint32(tiff[4:]))
+	if offset+2 > len(tiff) {
+		return 1
+	}
+
+	count := int(order.Uint16(tiff[offset:]))
+
+	for i := 0; i < count; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			orientation := int(order.Uint16(tiff[entry+8:]))
+
+			if orientation < 1 || orientation > 8 {
+				return 1
+			}
+
+			return orientation
+		}
+	}
+
+	return 1
+}
+
+// Orient transforms img, such that an image with the given EXIF orientation
+// is shown upright.
+func Orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	src := toRGBA(img)
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+
+			switch orientation {
+			case 2: // Mirrored horizontally
+				sx, sy = w-1-x, y
+			case 3: // Rotated 180°
+				sx, sy = w-1-x, h-1-y
+			case 4: // Mirrored vertically
+				sx, sy = x, h-1-y
+			case 5: // Transposed
+				sx, sy = y, x
+			case 6: // Needs rotating 90° clockwise
+				sx, sy = y, h-1-x
+			case 7: // Transversed
+				sx, sy = w-1-y, h-1-x
+			case 8: // Needs rotating 90° counter clockwise
+				sx, sy = w-1-y, x
+			}
+
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4],
+				src.Pix[src.PixOffset(sx, sy):src.PixOffset(sx, sy)+4])
+		}
+	}
+
+	return dst
+}
+
+// Resize scales img down to the given width, keeping the aspect ratio. Each
+// pixel of the result is the average of the pixels it covers in the original.
+// Images are never scaled up, so if width is greater than or equal to the
+// current width, img is returned as is.
+func Resize(img image.Image, width int) image.Image {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+
+	if width <= 0 || width >= w {
+		return img
+	}
+
+	height := (h*width + w/2) / w
+	if height < 1 {
+		height = 1
+	}
+
+	src := toRGBA(img)
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0, y1 := y*h/height, (y+1)*h/height
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+
+		for x := 0; x < width; x++ {
+			x0, x1 := x*w/width, (x+1)*w/width
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+
+			var sum [4]int
+
+			for sy := y0; sy < y1; sy++ {
+				offset := src.PixOffset(x0, sy)
+
+				for sx := x0; sx < x1; sx++ {
+					for c := 0; c < 4; c++ {
+						sum[c] += int(src.Pix[offset+c])
+					}
+
+					offset += 4
+				}
+			}
+
+			n := (x1 - x0) * (y1 - y0)
+			offset := dst.PixOffset(x, y)
+
+			for c := 0; c < 4; c++ {
+				dst.Pix[offset+c] = uint8(sum[c] / n)
+			}
+		}
+	}
+
+	return dst
+}
+
+// Converts img to RGBA with bounds starting at (0, 0), so pixels can be
+// accessed directly.
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Bounds().Min == (image.Point{}) {
+		return rgba
+	}
+
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+
+	return rgba
+}
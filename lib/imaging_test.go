@@ -0,0 +1,158 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// Creates the start of a JPEG file with an APP1 segment holding EXIF data with
+// the given orientation.
+func exifHead(order binary.ByteOrder, orientation uint16) []byte {
+	tiff := new(bytes.Buffer)
+
+	if order == binary.LittleEndian {
+		tiff.WriteString("II")
+	} else {
+		tiff.WriteString("MM")
+	}
+
+	binary.Write(tiff, order, uint16(42))
+	binary.Write(tiff, order, uint32(8)) // Offset of first IFD
+	binary.Write(tiff, order, uint16(1)) // Number of entries
+	binary.Write(tiff, order, uint16(0x0112))
+	binary.Write(tiff, order, uint16(3)) // SHORT
+	binary.Write(tiff, order, uint32(1))
+	binary.Write(tiff, order, orientation)
+	binary.Write(tiff, order, uint16(0))
+
+	segment := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+
+	head := []byte{0xff, 0xd8, 0xff, 0xe1}
+	head = append(head, byte((len(segment)+2)>>8), byte(len(segment)+2))
+	head = append(head, segment...)
+
+	return head
+}
+
+// A 2x1 image with a red pixel to the left and a blue one to the right
+func createTestImage() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(0, 0, color.RGBA{255, 0, 0, 255})
+	img.Set(1, 0, color.RGBA{0, 0, 255, 255})
+
+	return img
+}
+
+func TestOrientation(t *testing.T) {
+	t.Run("Not a jpeg", func(t *testing.T) {
+		if actual := Orientation([]byte("foo")); actual != 1 {
+			t.Errorf("Expected orientation 1, actually got %d", actual)
+		}
+	})
+
+	t.Run("Without EXIF", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		jpeg.Encode(buf, createTestImage(), nil)
+
+		if actual := Orientation(buf.Bytes()); actual != 1 {
+			t.Errorf("Expected orientation 1, actually got %d", actual)
+		}
+	})
+
+	t.Run("Big endian", func(t *testing.T) {
+		if actual := Orientation(exifHead(binary.BigEndian, 6)); actual != 6 {
+			t.Errorf("Expected orientation 6, actually got %d", actual)
+		}
+	})
+
+	t.Run("Little endian", func(t *testing.T) {
+		if actual := Orientation(exifHead(binary.LittleEndian, 8)); actual != 8 {
+			t.Errorf("Expected orientation 8, actually got %d", actual)
+		}
+	})
+}
+
+func TestOrient(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+
+	t.Run("Rotated clockwise", func(t *testing.T) {
+		img := Orient(createTestImage(), 6)
+
+		if img.Bounds().Dx() != 1 || img.Bounds().Dy() != 2 {
+			t.Fatalf("Expected 1x2 image, actually got %v", img.Bounds())
+		}
+
+		if img.At(0, 0) != red || img.At(0, 1) != blue {
+			t.Errorf("Expected red above blue")
+		}
+	})
+
+	t.Run("Rotated counter clockwise", func(t *testing.T) {
+		img := Orient(createTestImage(), 8)
+
+		if img.At(0, 0) != blue || img.At(0, 1) != red {
+			t.Errorf("Expected blue above red")
+		}
+	})
+
+	t.Run("Mirrored", func(t *testing.T) {
+		img := Orient(createTestImage(), 2)
+
+		if img.At(0, 0) != blue || img.At(1, 0) != red {
+			t.Errorf("Expected blue left of red")
+		}
+	})
+}
+
+func TestResize(t *testing.T) {
+	t.Run("Averages pixels", func(t *testing.T) {
+		img := Resize(createTestImage(), 1)
+
+		if img.Bounds().Dx() != 1 || img.Bounds().Dy() != 1 {
+			t.Fatalf("Expected 1x1 image, actually got %v", img.Bounds())
+		}
+
+		expected := color.RGBA{127, 0, 127, 255}
+		if actual := img.At(0, 0); actual != expected {
+			t.Errorf("Expected %v, actually got %v", expected, actual)
+		}
+	})
+
+	t.Run("Keeps aspect ratio", func(t *testing.T) {
+		img := Resize(image.NewRGBA(image.Rect(0, 0, 400, 300)), 200)
+
+		if img.Bounds().Dx() != 200 || img.Bounds().Dy() != 150 {
+			t.Errorf("Expected 200x150 image, actually got %v", img.Bounds())
+		}
+	})
+
+	t.Run("Doesn't scale up", func(t *testing.T) {
+		original := createTestImage()
+
+		if img := Resize(original, 4); img != original {
+			t.Errorf("Expected the original image")
+		}
+	})
+}
+
+func TestDecodeImageConfig(t *testing.T) {
+	buf := new(bytes.Buffer)
+	jpeg.Encode(buf, createTestImage(), nil)
+
+	// Splice the EXIF segment in after the SOI marker
+	data := append(exifHead(binary.BigEndian, 6), buf.Bytes()[2:]...)
+
+	config, err := DecodeImageConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Width != 1 || config.Height != 2 {
+		t.Errorf("Expected 1x2, actually got %dx%d", config.Width, config.Height)
+	}
+}
@@ -15,6 +15,17 @@ func MustGetEnv(variable string) string {
 	return val
 }
 
+// GetEnv returns the value of an optional environment variable, or fallback if
+// it isn't set. Variables set to nothing, like the optional ones in .env, count
+// as not set.
+func GetEnv(variable, fallback string) string {
+	val, ok := os.LookupEnv(variable)
+	if !ok || val == "" {
+		return fallback
+	}
+	return val
+}
+
 func RunningTime(s string) (string, time.Time) {
 	log.Println("Start: ", s)
 	return s, time.Now()
@@ -0,0 +1,232 @@
+package lib
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The markdown supported by RenderMarkdown is the subset used in Trello card
+// descriptions and comments: paragraphs, headings, lists, quotes, rules, code,
+// emphasis and links.
+var (
+	headingPattern     = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*$`)
+	unorderedPattern   = regexp.MustCompile(`^\s*[-*+]\s+(.*)$`)
+	orderedPattern     = regexp.MustCompile(`^\s*\d+[.)]\s+(.*)$`)
+	quotePattern       = regexp.MustCompile(`^>\s?(.*)$`)
+	rulePattern        = regexp.MustCompile(`^\s*([-*_])(\s*([-*_])){2,}\s*$`)
+	fencePattern       = regexp.MustCompile("^\\s*```")
+	codeSpanPattern    = regexp.MustCompile("`([^`]+)`")
+	linkPattern        = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	bareURLPattern     = regexp.MustCompile(`https?://[^\s<\x00]+`)
+	strongPattern      = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	emphasisPattern    = regexp.MustCompile(`\*([^*\s][^*]*)\*`)
+	underscorePattern  = regexp.MustCompile(`(^|[^\w])_([^_\s][^_]*)_($|[^\w])`)
+	placeholderPattern = regexp.MustCompile("\x00([0-9]+)\x00")
+)
+
+// Headings are rendered this many levels below their markdown level, since
+// they end up inside pages which already have headings of their own.
+const headingOffset = 2
+
+// RenderMarkdown renders markdown as HTML. All of the text is escaped, so the
+// only markup in the result is the one generated for the markdown, and links
+// are only kept for http, https and mailto urls. That makes it safe to render
+// text written by anyone. NUL bytes are dropped, since they mark placeholders
+// while rendering.
+func RenderMarkdown(src string) string {
+	src = strings.Replace(src, "\x00", "", -1)
+	lines := strings.Split(strings.Replace(src, "\r\n", "\n", -1), "\n")
+
+	var out strings.Builder
+
+	// The kind of block currently open, and the lines collected for it
+	block := ""
+	var blockLines []string
+
+	flush := func() {
+		switch block {
+		case "p":
+			rendered := make([]string, len(blockLines))
+			for i := range blockLines {
+				rendered[i] = renderInline(strings.TrimSpace(blockLines[i]))
+			}
+			fmt.Fprintf(&out, "<p>%s</p>\n", strings.Join(rendered, "<br>\n"))
+		case "ul", "ol":
+			fmt.Fprintf(&out, "<%s>\n", block)
+			for i := range blockLines {
+				fmt.Fprintf(&out, "<li>%s</li>\n", renderInline(blockLines[i]))
+			}
+			fmt.Fprintf(&out, "</%s>\n", block)
+		case "blockquote":
+			fmt.Fprintf(&out, "<blockquote>\n%s</blockquote>\n", RenderMarkdown(strings.Join(blockLines, "\n")))
+		case "pre":
+			fmt.Fprintf(&out, "<pre><code>%s</code></pre>\n", html.EscapeString(strings.Join(blockLines, "\n")))
+		}
+
+		block = ""
+		blockLines = nil
+	}
+
+	open := func(kind string) {
+		if block != kind {
+			flush()
+			block = kind
+		}
+	}
+
+	for _, line := range lines {
+		if block == "pre" {
+			if fencePattern.MatchString(line) {
+				flush()
+			} else {
+				blockLines = append(blockLines, line)
+			}
+
+			continue
+		}
+
+		if fencePattern.MatchString(line) {
+			flush()
+			block = "pre"
+			continue
+		}
+
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+
+		if m := headingPattern.FindStringSubmatch(line); m != nil {
+			flush()
+
+			level := len(m[1]) + headingOffset
+			if level > 6 {
+				level = 6
+			}
+
+			fmt.Fprintf(&out, "<h%d>%s</h%d>\n", level, renderInline(m[2]), level)
+			continue
+		}
+
+		if rulePattern.MatchString(line) {
+			flush()
+			out.WriteString("<hr>\n")
+			continue
+		}
+
+		if m := quotePattern.FindStringSubmatch(line); m != nil {
+			open("blockquote")
+			blockLines = append(blockLines, m[1])
+			continue
+		}
+
+		if m := unorderedPattern.FindStringSubmatch(line); m != nil {
+			open("ul")
+			blockLines = append(blockLines, m[1])
+			continue
+		}
+
+		if m := orderedPattern.FindStringSubmatch(line); m != nil {
+			open("ol")
+			blockLines = append(blockLines, m[1])
+			continue
+		}
+
+		// Lines following a list item without a marker continue that item
+		if (block == "ul" || block == "ol") && len(blockLines) > 0 {
+			blockLines[len(blockLines)-1] += " " + strings.TrimSpace(line)
+			continue
+		}
+
+		open("p")
+		blockLines = append(blockLines, line)
+	}
+
+	flush()
+
+	return out.String()
+}
+
+// Renders the inline markdown of a single line. The text is escaped up front,
+// and generated markup is swapped out for placeholders, so later patterns
+// can't match inside it. Placeholders are delimited by NUL bytes, which are
+// dropped from text first, so it can't contain any itself.
+func renderInline(text string) string {
+	escaped := html.EscapeString(strings.Replace(text, "\x00", "", -1))
+	stash := make([]string, 0)
+
+	hold := func(markup string) string {
+		stash = append(stash, markup)
+		return fmt.Sprintf("\x00%d\x00", len(stash)-1)
+	}
+
+	escaped = codeSpanPattern.ReplaceAllStringFunc(escaped, func(m string) string {
+		return hold("<code>" + codeSpanPattern.FindStringSubmatch(m)[1] + "</code>")
+	})
+
+	escaped = linkPattern.ReplaceAllStringFunc(escaped, func(m string) string {
+		parts := linkPattern.FindStringSubmatch(m)
+
+		if !isSafeURL(html.UnescapeString(parts[2])) {
+			return parts[1]
+		}
+
+		return hold(linkMarkup(parts[2], renderEmphasis(parts[1])))
+	})
+
+	escaped = bareURLPattern.ReplaceAllStringFunc(escaped, func(m string) string {
+		// Punctuation ending a sentence isn't part of the url
+		trimmed := strings.TrimRight(m, ".,;:!?)")
+
+		return hold(linkMarkup(trimmed, trimmed)) + m[len(trimmed):]
+	})
+
+	escaped = renderEmphasis(escaped)
+
+	return placeholderPattern.ReplaceAllStringFunc(escaped, func(m string) string {
+		i, err := strconv.Atoi(placeholderPattern.FindStringSubmatch(m)[1])
+		if err != nil || i >= len(stash) {
+			return ""
+		}
+
+		return stash[i]
+	})
+}
+
+func renderEmphasis(text string) string {
+	text = strongPattern.ReplaceAllStringFunc(text, func(m string) string {
+		parts := strongPattern.FindStringSubmatch(m)
+		return "<strong>" + parts[1] + parts[2] + "</strong>"
+	})
+
+	text = emphasisPattern.ReplaceAllString(text, "<em>$1</em>")
+
+	return underscorePattern.ReplaceAllString(text, "$1<em>$2</em>$3")
+}
+
+// Links open outside of gallo, since it's usually shown full screen.
+func linkMarkup(escapedURL, content string) string {
+	return fmt.Sprintf(
+		`<a href="%s" target="_blank" rel="noopener noreferrer">%s</a>`,
+		escapedURL,
+		content,
+	)
+}
+
+func isSafeURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "mailto":
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,73 @@
+package lib
+
+import (
+	"testing"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	for name, tc := range map[string]struct {
+		src      string
+		expected string
+	}{
+		"Paragraphs": {
+			"Foo\nbar\n\nBaz",
+			"<p>Foo<br>\nbar</p>\n<p>Baz</p>\n",
+		},
+		"Headings": {
+			"# Foo\n###### Bar",
+			"<h3>Foo</h3>\n<h6>Bar</h6>\n",
+		},
+		"Lists": {
+			"- Foo\n* Bar\n\n1. Baz",
+			"<ul>\n<li>Foo</li>\n<li>Bar</li>\n</ul>\n<ol>\n<li>Baz</li>\n</ol>\n",
+		},
+		"Quotes": {
+			"> Foo\n> bar",
+			"<blockquote>\n<p>Foo<br>\nbar</p>\n</blockquote>\n",
+		},
+		"Rules": {
+			"Foo\n\n---",
+			"<p>Foo</p>\n<hr>\n",
+		},
+		"Code": {
+			"```\n<b>Foo</b>\n```\n`bar`",
+			"<pre><code>&lt;b&gt;Foo&lt;/b&gt;</code></pre>\n<p><code>bar</code></p>\n",
+		},
+		"Emphasis": {
+			"**Foo** *bar* _baz_ snake_case",
+			"<p><strong>Foo</strong> <em>bar</em> <em>baz</em> snake_case</p>\n",
+		},
+		"Links": {
+			"[Foo](https://example.com/?a=1&b=2) https://example.com.",
+			`<p><a href="https://example.com/?a=1&amp;b=2" target="_blank" rel="noopener noreferrer">Foo</a> ` +
+				`<a href="https://example.com" target="_blank" rel="noopener noreferrer">https://example.com</a>.</p>` + "\n",
+		},
+		"Bare links next to links": {
+			"https://example.com[Foo](https://example.org)",
+			`<p><a href="https://example.com" target="_blank" rel="noopener noreferrer">https://example.com</a>` +
+				`<a href="https://example.org" target="_blank" rel="noopener noreferrer">Foo</a></p>` + "\n",
+		},
+		"Unsafe links": {
+			"[Foo](javascript:alert(1))",
+			"<p>Foo)</p>\n",
+		},
+		"HTML is escaped": {
+			`<script>alert("foo")</script> <img src=x onerror=alert(1)>`,
+			"<p>&lt;script&gt;alert(&#34;foo&#34;)&lt;/script&gt; &lt;img src=x onerror=alert(1)&gt;</p>\n",
+		},
+		"NUL bytes": {
+			"Foo \x007\x00 `bar` \x000\x00",
+			"<p>Foo 7 <code>bar</code> 0</p>\n",
+		},
+		"Empty": {
+			"",
+			"",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if actual := RenderMarkdown(tc.src); actual != tc.expected {
+				t.Errorf("Expected %q, actually got %q", tc.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package lib
+
+import (
+	"strconv"
+	"strings"
+)
+
+// NegotiateContentType picks the entry in offers which is preferred the most by
+// an Accept header. Ties are resolved by the order of offers, and the first
+// offer is returned if none of them are acceptable, or accept is empty.
+func NegotiateContentType(accept string, offers []string) string {
+	if len(offers) == 0 {
+		return ""
+	}
+
+	best := offers[0]
+	bestQ := -1.0
+	bestSpecificity := -1
+
+	for _, mediaRange := range strings.Split(accept, ",") {
+		params := strings.Split(mediaRange, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+
+		q := 1.0
+		for _, param := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) == 2 && kv[0] == "q" {
+				if value, err := strconv.ParseFloat(kv[1], 64); err == nil {
+					q = value
+				}
+			}
+		}
+
+		if q <= 0 {
+			continue
+		}
+
+		for _, offer := range offers {
+			specificity := matchMediaRange(mediaType, offer)
+			if specificity < 0 {
+				continue
+			}
+
+			if q > bestQ || (q == bestQ && specificity > bestSpecificity) {
+				best, bestQ, bestSpecificity = offer, q, specificity
+			}
+
+			// Only the first, and thereby most preferred, offer matching a range
+			// is considered
+			break
+		}
+	}
+
+	return best
+}
+
+// Returns how specific mediaType is when matching offer, i.e. 2 for an exact
+// match, 1 for "type/*" and 0 for "*/*", or -1 if it doesn't match.
+func matchMediaRange(mediaType, offer string) int {
+	switch {
+	case mediaType == offer:
+		return 2
+	case mediaType == "*/*":
+		return 0
+	case strings.HasSuffix(mediaType, "/*") &&
+		strings.HasPrefix(offer, strings.TrimSuffix(mediaType, "*")):
+		return 1
+	default:
+		return -1
+	}
+}
@@ -0,0 +1,28 @@
+package lib
+
+import "testing"
+
+func TestNegotiateContentType(t *testing.T) {
+	offers := []string{"text/html", "application/json"}
+
+	tests := []struct {
+		accept   string
+		expected string
+	}{
+		{"", "text/html"},
+		{"*/*", "text/html"},
+		{"application/json", "application/json"},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "text/html"},
+		{"application/json, text/plain, */*", "application/json"},
+		{"text/html;q=0.5, application/json", "application/json"},
+		{"application/*", "application/json"},
+		{"application/json;q=0", "text/html"},
+		{"image/png", "text/html"},
+	}
+
+	for _, test := range tests {
+		if actual := NegotiateContentType(test.accept, offers); actual != test.expected {
+			t.Errorf("Expected %s for %q, actually got %s", test.expected, test.accept, actual)
+		}
+	}
+}
@@ -0,0 +1,353 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimit is a number of requests allowed in a period.
+type RateLimit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// ErrRateLimitDeadline is returned for requests, which would have to wait for
+// the rate limit until after their deadline.
+var ErrRateLimitDeadline = errors.New("Rate limit would be exceeded before the deadline")
+
+// RateLimitedTransport is an implementation of http.RoundTripper, which keeps
+// requests to the Trello API within its rate limits, and retries requests that
+// failed. It's meant to be shared by every client of an API key.
+//
+// Requests are limited for the API key and for the token they are made with,
+// as given in their query. Requests exceeding either limit wait, until they
+// are within both, in the order they were made. Batch requests count as one
+// request for each of the URLs batched.
+//
+// GET requests are retried after network errors, server errors and 429 Too
+// Many Requests, with a jittered exponential backoff, or as long as the
+// Retry-After header of a 429 response says. Nothing waits past the deadline of
+// the context of a request, instead the last response or error is returned.
+type RateLimitedTransport struct {
+	// The transport requests are made with, http.DefaultTransport if nil
+	Transport http.RoundTripper
+	// How many times a failed request is retried
+	Retries int
+	// How long to wait before the first retry, doubling for each one after, up
+	// to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	perKey   RateLimit
+	perToken RateLimit
+
+	mutex  sync.Mutex
+	keys   map[string]*tokenBucket
+	tokens map[string]*tokenBucket
+}
+
+func NewRateLimitedTransport(
+	transport http.RoundTripper,
+	perKey RateLimit,
+	perToken RateLimit,
+) *RateLimitedTransport {
+	return &RateLimitedTransport{
+		Transport:  transport,
+		Retries:    3,
+		Backoff:    500 * time.Millisecond,
+		MaxBackoff: 8 * time.Second,
+		perKey:     perKey,
+		perToken:   perToken,
+		keys:       make(map[string]*tokenBucket),
+		tokens:     make(map[string]*tokenBucket),
+	}
+}
+
+// RoundTrip makes the request once it's within the rate limits, and retries it
+// if it fails, as described for RateLimitedTransport.
+func (t *RateLimitedTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	transport := t.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := t.wait(r)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := transport.RoundTrip(r)
+		if attempt >= t.Retries || !isRetriable(r, resp, err) {
+			return resp, err
+		}
+
+		delay := t.backoff(attempt)
+
+		if resp != nil && resp.StatusCode == http.StatusTooManyRequests {
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+				delay = retryAfter
+			}
+		}
+
+		if deadline, ok := r.Context().Deadline(); ok && time.Until(deadline) < delay {
+			return resp, err
+		}
+
+		if resp != nil {
+			log.Println(fmt.Sprintf("Retrying %s in %s after %s", r.URL.Path, delay, resp.Status))
+
+			// The body must be read all the same, so the connection can be
+			// reused
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		} else {
+			log.Println(fmt.Sprintf("Retrying %s in %s after %s", r.URL.Path, delay, err))
+		}
+
+		err = sleep(r.Context(), delay)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Waits until r is within the rate limits of its key and token.
+func (t *RateLimitedTransport) wait(r *http.Request) error {
+	query := r.URL.Query()
+	weight := requestWeight(r)
+	now := time.Now()
+
+	buckets := make([]*tokenBucket, 0, 2)
+
+	t.mutex.Lock()
+	if key := query.Get("key"); key != "" {
+		buckets = append(buckets, bucketFor(t.keys, key, t.perKey, now))
+	}
+	if token := query.Get("token"); token != "" {
+		buckets = append(buckets, bucketFor(t.tokens, token, t.perToken, now))
+	}
+	t.mutex.Unlock()
+
+	var delay time.Duration
+
+	for _, bucket := range buckets {
+		if d := bucket.reserve(weight, now); d > delay {
+			delay = d
+		}
+	}
+
+	if delay == 0 {
+		return nil
+	}
+
+	release := func() {
+		for _, bucket := range buckets {
+			bucket.release(weight)
+		}
+	}
+
+	if deadline, ok := r.Context().Deadline(); ok && time.Until(deadline) < delay {
+		release()
+		return ErrRateLimitDeadline
+	}
+
+	log.Println(fmt.Sprintf("Rate limiting %s for %s", r.URL.Path, delay))
+
+	err := sleep(r.Context(), delay)
+	if err != nil {
+		release()
+		return err
+	}
+
+	return nil
+}
+
+// Returns how long to wait before retrying after attempt, which is the backoff
+// of the attempt, less a random part of up to half of it, so retries of
+// requests failing together are spread out.
+func (t *RateLimitedTransport) backoff(attempt int) time.Duration {
+	backoff := t.Backoff << uint(attempt)
+	if backoff > t.MaxBackoff || backoff <= 0 {
+		backoff = t.MaxBackoff
+	}
+
+	half := int64(backoff / 2)
+	if half <= 0 {
+		return backoff
+	}
+
+	return backoff - time.Duration(rand.Int63n(half))
+}
+
+// Returns the bucket of id in buckets, which is created with limit if there's
+// none. Buckets which have been idle long enough to be full are dropped when
+// one is created, since they'd be created the same again.
+func bucketFor(buckets map[string]*tokenBucket, id string, limit RateLimit, now time.Time) *tokenBucket {
+	if bucket, ok := buckets[id]; ok {
+		return bucket
+	}
+
+	for other, bucket := range buckets {
+		if bucket.isFull(now) {
+			delete(buckets, other)
+		}
+	}
+
+	bucket := newTokenBucket(limit, now)
+	buckets[id] = bucket
+
+	return bucket
+}
+
+// Tells whether a failed attempt at r may be retried. Only requests which are
+// safe to repeat are, and not after their context is done.
+func isRetriable(r *http.Request, resp *http.Response, err error) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if r.Context().Err() != nil {
+		return false
+	}
+
+	if err != nil {
+		return true
+	}
+
+	return resp.StatusCode == http.StatusTooManyRequests ||
+		(resp.StatusCode >= 500 && resp.StatusCode != http.StatusNotImplemented)
+}
+
+// Returns the number of requests r counts as, which is the number of URLs in a
+// batch request.
+func requestWeight(r *http.Request) float64 {
+	if !strings.HasSuffix(r.URL.Path, "/batch") {
+		return 1
+	}
+
+	urls := strings.Split(r.URL.Query().Get("urls"), ",")
+
+	return float64(len(urls))
+}
+
+// Parses the value of a Retry-After header, which is either a number of
+// seconds or a date, relative to now.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+
+	if delay := date.Sub(now); delay > 0 {
+		return delay, true
+	}
+
+	return 0, true
+}
+
+// Sleeps for d, unless ctx is done first, in which case its error is returned.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// tokenBucket allows a number of requests in a period, by holding as many
+// tokens, which are refilled evenly over the period. Tokens are reserved ahead
+// of time, so requests waiting for them are let through in order.
+type tokenBucket struct {
+	mutex    sync.Mutex
+	capacity float64
+	// Tokens per second
+	rate    float64
+	tokens  float64
+	updated time.Time
+}
+
+func newTokenBucket(limit RateLimit, now time.Time) *tokenBucket {
+	capacity := float64(limit.Requests)
+
+	return &tokenBucket{
+		capacity: capacity,
+		rate:     capacity / limit.Period.Seconds(),
+		tokens:   capacity,
+		updated:  now,
+	}
+}
+
+// Refills the tokens for the time passed since the last update.
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * b.rate
+		b.updated = now
+	}
+
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+}
+
+// Reserves n tokens, and returns how long to wait until they're there.
+func (b *tokenBucket) reserve(n float64, now time.Time) time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.refill(now)
+	b.tokens -= n
+
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// Releases n tokens, which were reserved but not used.
+func (b *tokenBucket) release(n float64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.tokens += n
+
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+}
+
+func (b *tokenBucket) isFull(now time.Time) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.refill(now)
+
+	return b.tokens >= b.capacity
+}
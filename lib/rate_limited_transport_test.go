@@ -0,0 +1,213 @@
+package lib
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Answers with each of statuses in turn, and with 200 OK after them
+func newStatusServer(statuses ...int) (*httptest.Server, *int32) {
+	var calls int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := int(atomic.AddInt32(&calls, 1))
+
+		if call <= len(statuses) {
+			if statuses[call-1] == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", "0")
+			}
+
+			w.WriteHeader(statuses[call-1])
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	return server, &calls
+}
+
+func newTestRateLimitedTransport() *RateLimitedTransport {
+	limit := RateLimit{Requests: 100, Period: time.Second}
+
+	transport := NewRateLimitedTransport(nil, limit, limit)
+	transport.Backoff = time.Millisecond
+	transport.MaxBackoff = 10 * time.Millisecond
+
+	return transport
+}
+
+func TestRateLimitedTransportRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		statuses []int
+		retries  int
+		expected int
+		calls    int32
+	}{
+		{"retries after 429", "GET", []int{429}, 3, 200, 2},
+		{"retries after server errors", "GET", []int{502, 503, 500}, 3, 200, 4},
+		{"gives up after retrying", "GET", []int{503, 503}, 1, 503, 2},
+		{"doesn't retry client errors", "GET", []int{404}, 3, 404, 1},
+		{"doesn't retry posts", "POST", []int{503}, 3, 503, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, calls := newStatusServer(test.statuses...)
+			defer server.Close()
+
+			transport := newTestRateLimitedTransport()
+			transport.Retries = test.retries
+
+			response, err := transport.RoundTrip(httptest.NewRequest(test.method, server.URL, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			response.Body.Close()
+
+			if response.StatusCode != test.expected {
+				t.Errorf("Expected %d, actually got %d", test.expected, response.StatusCode)
+			}
+
+			if actual := atomic.LoadInt32(calls); actual != test.calls {
+				t.Errorf("Expected %d requests, actually %d", test.calls, actual)
+			}
+		})
+	}
+
+	t.Run("doesn't wait past the deadline", func(t *testing.T) {
+		server, calls := newStatusServer(503)
+		defer server.Close()
+
+		transport := newTestRateLimitedTransport()
+		transport.Backoff = time.Hour
+		transport.MaxBackoff = time.Hour
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		request := httptest.NewRequest("GET", server.URL, nil).WithContext(ctx)
+
+		response, err := transport.RoundTrip(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+
+		if response.StatusCode != http.StatusServiceUnavailable || atomic.LoadInt32(calls) != 1 {
+			t.Errorf("Expected the failed response right away, actually %d", response.StatusCode)
+		}
+	})
+}
+
+func TestRateLimitedTransportLimits(t *testing.T) {
+	server, _ := newStatusServer()
+	defer server.Close()
+
+	// Two requests per token and three per key are allowed in 200ms
+	transport := NewRateLimitedTransport(
+		nil,
+		RateLimit{Requests: 3, Period: 200 * time.Millisecond},
+		RateLimit{Requests: 2, Period: 200 * time.Millisecond},
+	)
+
+	request := func(ctx context.Context, token string) error {
+		u := server.URL + "/1/boards?key=key&token=" + token
+
+		response, err := transport.RoundTrip(httptest.NewRequest("GET", u, nil).WithContext(ctx))
+		if err == nil {
+			response.Body.Close()
+		}
+
+		return err
+	}
+
+	start := time.Now()
+
+	for _, token := range []string{"a", "a", "b"} {
+		if err := request(context.Background(), token); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("Expected requests within the limits right away, took %s", elapsed)
+	}
+
+	t.Run("fails requests which would wait past their deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		if err := request(ctx, "c"); err != ErrRateLimitDeadline {
+			t.Errorf("Expected the deadline to be exceeded, actually %v", err)
+		}
+	})
+
+	t.Run("waits for the limits", func(t *testing.T) {
+		start := time.Now()
+
+		if err := request(context.Background(), "a"); err != nil {
+			t.Fatal(err)
+		}
+
+		if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+			t.Errorf("Expected the request to wait for the limits, took %s", elapsed)
+		}
+	})
+}
+
+func TestRequestWeight(t *testing.T) {
+	batch := "/1/batch?urls=" + url.QueryEscape("/boards/1/cards,/boards/2/cards,/boards/3/cards")
+
+	tests := []struct {
+		path     string
+		expected float64
+	}{
+		{"/1/boards/1/cards", 1},
+		{batch, 3},
+		{"/1/batch", 1},
+	}
+
+	for _, test := range tests {
+		actual := requestWeight(httptest.NewRequest("GET", test.path, nil))
+
+		if actual != test.expected {
+			t.Errorf("Expected %s to weigh %f, actually %f", test.path, test.expected, actual)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{"", 0, false},
+		{"5", 5 * time.Second, true},
+		{"-1", 0, false},
+		{"Wed, 01 Jan 2020 12:00:30 GMT", 30 * time.Second, true},
+		{"Wed, 01 Jan 2020 11:00:00 GMT", 0, true},
+		{"soon", 0, false},
+	}
+
+	for _, test := range tests {
+		actual, ok := parseRetryAfter(test.value, now)
+
+		if actual != test.expected || ok != test.ok {
+			t.Errorf(
+				"Expected '%s' to be %s (%t), actually %s (%t)",
+				test.value, test.expected, test.ok, actual, ok,
+			)
+		}
+	}
+}
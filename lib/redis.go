@@ -18,4 +18,12 @@ type RedisCacheProvider interface {
 	Once(item *cache.Item) error
 	Get(ctx context.Context, key string, value interface{}) error
 	Set(item *cache.Item) error
+	Delete(ctx context.Context, key string) error
+}
+
+type RedisSetProvider interface {
+	SAdd(ctx context.Context, key string, members ...interface{}) *redis.IntCmd
+	SMembers(ctx context.Context, key string) *redis.StringSliceCmd
+	Del(ctx context.Context, keys ...string) *redis.IntCmd
+	Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd
 }
@@ -0,0 +1,44 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+)
+
+// PosterFrame extracts the first frame of the video file at videoPath as a
+// JPEG, with the ffmpeg executable at ffmpegPath. The video is read from a file,
+// rather than piped, since the index of some containers is placed at the end.
+func PosterFrame(ctx context.Context, ffmpegPath string, videoPath string) ([]byte, error) {
+	if ffmpegPath == "" {
+		return nil, errors.New("No ffmpeg available for extracting poster frames")
+	}
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+
+	cmd := exec.CommandContext(
+		ctx,
+		ffmpegPath,
+		"-loglevel", "error",
+		"-i", videoPath,
+		"-frames:v", "1",
+		"-f", "image2",
+		"-c:v", "mjpeg",
+		"pipe:1",
+	)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("ffmpeg failed: %s %s", err, stderr.String()))
+	}
+
+	if stdout.Len() == 0 {
+		return nil, errors.New("ffmpeg extracted no frame")
+	}
+
+	return stdout.Bytes(), nil
+}
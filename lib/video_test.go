@@ -0,0 +1,39 @@
+package lib
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestPosterFrame(t *testing.T) {
+	t.Run("Without ffmpeg", func(t *testing.T) {
+		_, err := PosterFrame(context.Background(), "", "foo.mp4")
+		if err == nil {
+			t.Error("Expected an error without ffmpeg")
+		}
+	})
+
+	t.Run("Invalid video", func(t *testing.T) {
+		ffmpegPath, err := exec.LookPath("ffmpeg")
+		if err != nil {
+			t.Skip("ffmpeg not found")
+		}
+
+		tmp, err := ioutil.TempFile("", "gallo-video-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(tmp.Name())
+
+		tmp.WriteString("foo")
+		tmp.Close()
+
+		_, err = PosterFrame(context.Background(), ffmpegPath, tmp.Name())
+		if err == nil {
+			t.Error("Expected an error for an invalid video")
+		}
+	})
+}
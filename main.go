@@ -1,12 +1,23 @@
 package main
 
 import (
+	"log"
 	"math/rand"
+	"os"
 	"time"
 	gallo "gallo/app"
 )
 
 func main() {
+	// Purge cache entries instead of serving, e.g. ./main purge -user {id}
+	if len(os.Args) > 1 && os.Args[1] == "purge" {
+		if err := gallo.Purge(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
 	// Initialize RNG
 	rand.Seed(time.Now().Unix())
 